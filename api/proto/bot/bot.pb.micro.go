@@ -44,6 +44,8 @@ func NewBotServiceEndpoints() []*api.Endpoint {
 
 type BotService interface {
 	SendMessage(ctx context.Context, in *SendMessageRequest, opts ...client.CallOption) (*SendMessageResponse, error)
+	EditMessage(ctx context.Context, in *EditMessageRequest, opts ...client.CallOption) (*EditMessageResponse, error)
+	DeleteMessage(ctx context.Context, in *DeleteMessageRequest, opts ...client.CallOption) (*DeleteMessageResponse, error)
 	AddProfile(ctx context.Context, in *AddProfileRequest, opts ...client.CallOption) (*AddProfileResponse, error)
 	DeleteProfile(ctx context.Context, in *DeleteProfileRequest, opts ...client.CallOption) (*DeleteProfileResponse, error)
 }
@@ -70,6 +72,26 @@ func (c *botService) SendMessage(ctx context.Context, in *SendMessageRequest, op
 	return out, nil
 }
 
+func (c *botService) EditMessage(ctx context.Context, in *EditMessageRequest, opts ...client.CallOption) (*EditMessageResponse, error) {
+	req := c.c.NewRequest(c.name, "BotService.EditMessage", in)
+	out := new(EditMessageResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *botService) DeleteMessage(ctx context.Context, in *DeleteMessageRequest, opts ...client.CallOption) (*DeleteMessageResponse, error) {
+	req := c.c.NewRequest(c.name, "BotService.DeleteMessage", in)
+	out := new(DeleteMessageResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *botService) AddProfile(ctx context.Context, in *AddProfileRequest, opts ...client.CallOption) (*AddProfileResponse, error) {
 	req := c.c.NewRequest(c.name, "BotService.AddProfile", in)
 	out := new(AddProfileResponse)
@@ -94,6 +116,8 @@ func (c *botService) DeleteProfile(ctx context.Context, in *DeleteProfileRequest
 
 type BotServiceHandler interface {
 	SendMessage(context.Context, *SendMessageRequest, *SendMessageResponse) error
+	EditMessage(context.Context, *EditMessageRequest, *EditMessageResponse) error
+	DeleteMessage(context.Context, *DeleteMessageRequest, *DeleteMessageResponse) error
 	AddProfile(context.Context, *AddProfileRequest, *AddProfileResponse) error
 	DeleteProfile(context.Context, *DeleteProfileRequest, *DeleteProfileResponse) error
 }
@@ -101,6 +125,8 @@ type BotServiceHandler interface {
 func RegisterBotServiceHandler(s server.Server, hdlr BotServiceHandler, opts ...server.HandlerOption) error {
 	type botService interface {
 		SendMessage(ctx context.Context, in *SendMessageRequest, out *SendMessageResponse) error
+		EditMessage(ctx context.Context, in *EditMessageRequest, out *EditMessageResponse) error
+		DeleteMessage(ctx context.Context, in *DeleteMessageRequest, out *DeleteMessageResponse) error
 		AddProfile(ctx context.Context, in *AddProfileRequest, out *AddProfileResponse) error
 		DeleteProfile(ctx context.Context, in *DeleteProfileRequest, out *DeleteProfileResponse) error
 	}
@@ -119,6 +145,14 @@ func (h *botServiceHandler) SendMessage(ctx context.Context, in *SendMessageRequ
 	return h.BotServiceHandler.SendMessage(ctx, in, out)
 }
 
+func (h *botServiceHandler) EditMessage(ctx context.Context, in *EditMessageRequest, out *EditMessageResponse) error {
+	return h.BotServiceHandler.EditMessage(ctx, in, out)
+}
+
+func (h *botServiceHandler) DeleteMessage(ctx context.Context, in *DeleteMessageRequest, out *DeleteMessageResponse) error {
+	return h.BotServiceHandler.DeleteMessage(ctx, in, out)
+}
+
 func (h *botServiceHandler) AddProfile(ctx context.Context, in *AddProfileRequest, out *AddProfileResponse) error {
 	return h.BotServiceHandler.AddProfile(ctx, in, out)
 }
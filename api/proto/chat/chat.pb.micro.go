@@ -43,6 +43,10 @@ func NewChatServiceEndpoints() []*api.Endpoint {
 
 type ChatService interface {
 	SendMessage(ctx context.Context, in *SendMessageRequest, opts ...client.CallOption) (*SendMessageResponse, error)
+	EditMessage(ctx context.Context, in *EditMessageRequest, opts ...client.CallOption) (*EditMessageResponse, error)
+	DeleteMessage(ctx context.Context, in *DeleteMessageRequest, opts ...client.CallOption) (*DeleteMessageResponse, error)
+	UpdateMessageStatus(ctx context.Context, in *UpdateMessageStatusRequest, opts ...client.CallOption) (*UpdateMessageStatusResponse, error)
+	MarkRead(ctx context.Context, in *MarkReadRequest, opts ...client.CallOption) (*MarkReadResponse, error)
 	StartConversation(ctx context.Context, in *StartConversationRequest, opts ...client.CallOption) (*StartConversationResponse, error)
 	CloseConversation(ctx context.Context, in *CloseConversationRequest, opts ...client.CallOption) (*CloseConversationResponse, error)
 	JoinConversation(ctx context.Context, in *JoinConversationRequest, opts ...client.CallOption) (*JoinConversationResponse, error)
@@ -59,6 +63,17 @@ type ChatService interface {
 	DeleteProfile(ctx context.Context, in *DeleteProfileRequest, opts ...client.CallOption) (*DeleteProfileResponse, error)
 	UpdateProfile(ctx context.Context, in *UpdateProfileRequest, opts ...client.CallOption) (*UpdateProfileResponse, error)
 	GetHistoryMessages(ctx context.Context, in *GetHistoryMessagesRequest, opts ...client.CallOption) (*GetHistoryMessagesResponse, error)
+	GetMessageEdits(ctx context.Context, in *GetMessageEditsRequest, opts ...client.CallOption) (*GetMessageEditsResponse, error)
+	GetMessageStatuses(ctx context.Context, in *GetMessageStatusesRequest, opts ...client.CallOption) (*GetMessageStatusesResponse, error)
+	GetConversationEvents(ctx context.Context, in *GetConversationEventsRequest, opts ...client.CallOption) (*GetConversationEventsResponse, error)
+	GetWebhooks(ctx context.Context, in *GetWebhooksRequest, opts ...client.CallOption) (*GetWebhooksResponse, error)
+	GetWebhookByID(ctx context.Context, in *GetWebhookByIDRequest, opts ...client.CallOption) (*GetWebhookByIDResponse, error)
+	CreateWebhook(ctx context.Context, in *CreateWebhookRequest, opts ...client.CallOption) (*CreateWebhookResponse, error)
+	UpdateWebhook(ctx context.Context, in *UpdateWebhookRequest, opts ...client.CallOption) (*UpdateWebhookResponse, error)
+	DeleteWebhook(ctx context.Context, in *DeleteWebhookRequest, opts ...client.CallOption) (*DeleteWebhookResponse, error)
+	GetWebhookDeliveries(ctx context.Context, in *GetWebhookDeliveriesRequest, opts ...client.CallOption) (*GetWebhookDeliveriesResponse, error)
+	GetDomainSetting(ctx context.Context, in *GetDomainSettingRequest, opts ...client.CallOption) (*GetDomainSettingResponse, error)
+	UpdateDomainSetting(ctx context.Context, in *UpdateDomainSettingRequest, opts ...client.CallOption) (*UpdateDomainSettingResponse, error)
 }
 
 type chatService struct {
@@ -83,6 +98,46 @@ func (c *chatService) SendMessage(ctx context.Context, in *SendMessageRequest, o
 	return out, nil
 }
 
+func (c *chatService) EditMessage(ctx context.Context, in *EditMessageRequest, opts ...client.CallOption) (*EditMessageResponse, error) {
+	req := c.c.NewRequest(c.name, "ChatService.EditMessage", in)
+	out := new(EditMessageResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatService) DeleteMessage(ctx context.Context, in *DeleteMessageRequest, opts ...client.CallOption) (*DeleteMessageResponse, error) {
+	req := c.c.NewRequest(c.name, "ChatService.DeleteMessage", in)
+	out := new(DeleteMessageResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatService) UpdateMessageStatus(ctx context.Context, in *UpdateMessageStatusRequest, opts ...client.CallOption) (*UpdateMessageStatusResponse, error) {
+	req := c.c.NewRequest(c.name, "ChatService.UpdateMessageStatus", in)
+	out := new(UpdateMessageStatusResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatService) MarkRead(ctx context.Context, in *MarkReadRequest, opts ...client.CallOption) (*MarkReadResponse, error) {
+	req := c.c.NewRequest(c.name, "ChatService.MarkRead", in)
+	out := new(MarkReadResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *chatService) StartConversation(ctx context.Context, in *StartConversationRequest, opts ...client.CallOption) (*StartConversationResponse, error) {
 	req := c.c.NewRequest(c.name, "ChatService.StartConversation", in)
 	out := new(StartConversationResponse)
@@ -243,10 +298,124 @@ func (c *chatService) GetHistoryMessages(ctx context.Context, in *GetHistoryMess
 	return out, nil
 }
 
+func (c *chatService) GetMessageEdits(ctx context.Context, in *GetMessageEditsRequest, opts ...client.CallOption) (*GetMessageEditsResponse, error) {
+	req := c.c.NewRequest(c.name, "ChatService.GetMessageEdits", in)
+	out := new(GetMessageEditsResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatService) GetMessageStatuses(ctx context.Context, in *GetMessageStatusesRequest, opts ...client.CallOption) (*GetMessageStatusesResponse, error) {
+	req := c.c.NewRequest(c.name, "ChatService.GetMessageStatuses", in)
+	out := new(GetMessageStatusesResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatService) GetConversationEvents(ctx context.Context, in *GetConversationEventsRequest, opts ...client.CallOption) (*GetConversationEventsResponse, error) {
+	req := c.c.NewRequest(c.name, "ChatService.GetConversationEvents", in)
+	out := new(GetConversationEventsResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatService) GetWebhooks(ctx context.Context, in *GetWebhooksRequest, opts ...client.CallOption) (*GetWebhooksResponse, error) {
+	req := c.c.NewRequest(c.name, "ChatService.GetWebhooks", in)
+	out := new(GetWebhooksResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatService) GetWebhookByID(ctx context.Context, in *GetWebhookByIDRequest, opts ...client.CallOption) (*GetWebhookByIDResponse, error) {
+	req := c.c.NewRequest(c.name, "ChatService.GetWebhookByID", in)
+	out := new(GetWebhookByIDResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatService) CreateWebhook(ctx context.Context, in *CreateWebhookRequest, opts ...client.CallOption) (*CreateWebhookResponse, error) {
+	req := c.c.NewRequest(c.name, "ChatService.CreateWebhook", in)
+	out := new(CreateWebhookResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatService) UpdateWebhook(ctx context.Context, in *UpdateWebhookRequest, opts ...client.CallOption) (*UpdateWebhookResponse, error) {
+	req := c.c.NewRequest(c.name, "ChatService.UpdateWebhook", in)
+	out := new(UpdateWebhookResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatService) DeleteWebhook(ctx context.Context, in *DeleteWebhookRequest, opts ...client.CallOption) (*DeleteWebhookResponse, error) {
+	req := c.c.NewRequest(c.name, "ChatService.DeleteWebhook", in)
+	out := new(DeleteWebhookResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatService) GetWebhookDeliveries(ctx context.Context, in *GetWebhookDeliveriesRequest, opts ...client.CallOption) (*GetWebhookDeliveriesResponse, error) {
+	req := c.c.NewRequest(c.name, "ChatService.GetWebhookDeliveries", in)
+	out := new(GetWebhookDeliveriesResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatService) GetDomainSetting(ctx context.Context, in *GetDomainSettingRequest, opts ...client.CallOption) (*GetDomainSettingResponse, error) {
+	req := c.c.NewRequest(c.name, "ChatService.GetDomainSetting", in)
+	out := new(GetDomainSettingResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatService) UpdateDomainSetting(ctx context.Context, in *UpdateDomainSettingRequest, opts ...client.CallOption) (*UpdateDomainSettingResponse, error) {
+	req := c.c.NewRequest(c.name, "ChatService.UpdateDomainSetting", in)
+	out := new(UpdateDomainSettingResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for ChatService service
 
 type ChatServiceHandler interface {
 	SendMessage(context.Context, *SendMessageRequest, *SendMessageResponse) error
+	EditMessage(context.Context, *EditMessageRequest, *EditMessageResponse) error
+	DeleteMessage(context.Context, *DeleteMessageRequest, *DeleteMessageResponse) error
+	UpdateMessageStatus(context.Context, *UpdateMessageStatusRequest, *UpdateMessageStatusResponse) error
+	MarkRead(context.Context, *MarkReadRequest, *MarkReadResponse) error
 	StartConversation(context.Context, *StartConversationRequest, *StartConversationResponse) error
 	CloseConversation(context.Context, *CloseConversationRequest, *CloseConversationResponse) error
 	JoinConversation(context.Context, *JoinConversationRequest, *JoinConversationResponse) error
@@ -263,11 +432,26 @@ type ChatServiceHandler interface {
 	DeleteProfile(context.Context, *DeleteProfileRequest, *DeleteProfileResponse) error
 	UpdateProfile(context.Context, *UpdateProfileRequest, *UpdateProfileResponse) error
 	GetHistoryMessages(context.Context, *GetHistoryMessagesRequest, *GetHistoryMessagesResponse) error
+	GetMessageEdits(context.Context, *GetMessageEditsRequest, *GetMessageEditsResponse) error
+	GetMessageStatuses(context.Context, *GetMessageStatusesRequest, *GetMessageStatusesResponse) error
+	GetConversationEvents(context.Context, *GetConversationEventsRequest, *GetConversationEventsResponse) error
+	GetWebhooks(context.Context, *GetWebhooksRequest, *GetWebhooksResponse) error
+	GetWebhookByID(context.Context, *GetWebhookByIDRequest, *GetWebhookByIDResponse) error
+	CreateWebhook(context.Context, *CreateWebhookRequest, *CreateWebhookResponse) error
+	UpdateWebhook(context.Context, *UpdateWebhookRequest, *UpdateWebhookResponse) error
+	DeleteWebhook(context.Context, *DeleteWebhookRequest, *DeleteWebhookResponse) error
+	GetWebhookDeliveries(context.Context, *GetWebhookDeliveriesRequest, *GetWebhookDeliveriesResponse) error
+	GetDomainSetting(context.Context, *GetDomainSettingRequest, *GetDomainSettingResponse) error
+	UpdateDomainSetting(context.Context, *UpdateDomainSettingRequest, *UpdateDomainSettingResponse) error
 }
 
 func RegisterChatServiceHandler(s server.Server, hdlr ChatServiceHandler, opts ...server.HandlerOption) error {
 	type chatService interface {
 		SendMessage(ctx context.Context, in *SendMessageRequest, out *SendMessageResponse) error
+		EditMessage(ctx context.Context, in *EditMessageRequest, out *EditMessageResponse) error
+		DeleteMessage(ctx context.Context, in *DeleteMessageRequest, out *DeleteMessageResponse) error
+		UpdateMessageStatus(ctx context.Context, in *UpdateMessageStatusRequest, out *UpdateMessageStatusResponse) error
+		MarkRead(ctx context.Context, in *MarkReadRequest, out *MarkReadResponse) error
 		StartConversation(ctx context.Context, in *StartConversationRequest, out *StartConversationResponse) error
 		CloseConversation(ctx context.Context, in *CloseConversationRequest, out *CloseConversationResponse) error
 		JoinConversation(ctx context.Context, in *JoinConversationRequest, out *JoinConversationResponse) error
@@ -284,6 +468,17 @@ func RegisterChatServiceHandler(s server.Server, hdlr ChatServiceHandler, opts .
 		DeleteProfile(ctx context.Context, in *DeleteProfileRequest, out *DeleteProfileResponse) error
 		UpdateProfile(ctx context.Context, in *UpdateProfileRequest, out *UpdateProfileResponse) error
 		GetHistoryMessages(ctx context.Context, in *GetHistoryMessagesRequest, out *GetHistoryMessagesResponse) error
+		GetMessageEdits(ctx context.Context, in *GetMessageEditsRequest, out *GetMessageEditsResponse) error
+		GetMessageStatuses(ctx context.Context, in *GetMessageStatusesRequest, out *GetMessageStatusesResponse) error
+		GetConversationEvents(ctx context.Context, in *GetConversationEventsRequest, out *GetConversationEventsResponse) error
+		GetWebhooks(ctx context.Context, in *GetWebhooksRequest, out *GetWebhooksResponse) error
+		GetWebhookByID(ctx context.Context, in *GetWebhookByIDRequest, out *GetWebhookByIDResponse) error
+		CreateWebhook(ctx context.Context, in *CreateWebhookRequest, out *CreateWebhookResponse) error
+		UpdateWebhook(ctx context.Context, in *UpdateWebhookRequest, out *UpdateWebhookResponse) error
+		DeleteWebhook(ctx context.Context, in *DeleteWebhookRequest, out *DeleteWebhookResponse) error
+		GetWebhookDeliveries(ctx context.Context, in *GetWebhookDeliveriesRequest, out *GetWebhookDeliveriesResponse) error
+		GetDomainSetting(ctx context.Context, in *GetDomainSettingRequest, out *GetDomainSettingResponse) error
+		UpdateDomainSetting(ctx context.Context, in *UpdateDomainSettingRequest, out *UpdateDomainSettingResponse) error
 	}
 	type ChatService struct {
 		chatService
@@ -300,6 +495,22 @@ func (h *chatServiceHandler) SendMessage(ctx context.Context, in *SendMessageReq
 	return h.ChatServiceHandler.SendMessage(ctx, in, out)
 }
 
+func (h *chatServiceHandler) EditMessage(ctx context.Context, in *EditMessageRequest, out *EditMessageResponse) error {
+	return h.ChatServiceHandler.EditMessage(ctx, in, out)
+}
+
+func (h *chatServiceHandler) DeleteMessage(ctx context.Context, in *DeleteMessageRequest, out *DeleteMessageResponse) error {
+	return h.ChatServiceHandler.DeleteMessage(ctx, in, out)
+}
+
+func (h *chatServiceHandler) UpdateMessageStatus(ctx context.Context, in *UpdateMessageStatusRequest, out *UpdateMessageStatusResponse) error {
+	return h.ChatServiceHandler.UpdateMessageStatus(ctx, in, out)
+}
+
+func (h *chatServiceHandler) MarkRead(ctx context.Context, in *MarkReadRequest, out *MarkReadResponse) error {
+	return h.ChatServiceHandler.MarkRead(ctx, in, out)
+}
+
 func (h *chatServiceHandler) StartConversation(ctx context.Context, in *StartConversationRequest, out *StartConversationResponse) error {
 	return h.ChatServiceHandler.StartConversation(ctx, in, out)
 }
@@ -363,3 +574,47 @@ func (h *chatServiceHandler) UpdateProfile(ctx context.Context, in *UpdateProfil
 func (h *chatServiceHandler) GetHistoryMessages(ctx context.Context, in *GetHistoryMessagesRequest, out *GetHistoryMessagesResponse) error {
 	return h.ChatServiceHandler.GetHistoryMessages(ctx, in, out)
 }
+
+func (h *chatServiceHandler) GetMessageEdits(ctx context.Context, in *GetMessageEditsRequest, out *GetMessageEditsResponse) error {
+	return h.ChatServiceHandler.GetMessageEdits(ctx, in, out)
+}
+
+func (h *chatServiceHandler) GetMessageStatuses(ctx context.Context, in *GetMessageStatusesRequest, out *GetMessageStatusesResponse) error {
+	return h.ChatServiceHandler.GetMessageStatuses(ctx, in, out)
+}
+
+func (h *chatServiceHandler) GetConversationEvents(ctx context.Context, in *GetConversationEventsRequest, out *GetConversationEventsResponse) error {
+	return h.ChatServiceHandler.GetConversationEvents(ctx, in, out)
+}
+
+func (h *chatServiceHandler) GetWebhooks(ctx context.Context, in *GetWebhooksRequest, out *GetWebhooksResponse) error {
+	return h.ChatServiceHandler.GetWebhooks(ctx, in, out)
+}
+
+func (h *chatServiceHandler) GetWebhookByID(ctx context.Context, in *GetWebhookByIDRequest, out *GetWebhookByIDResponse) error {
+	return h.ChatServiceHandler.GetWebhookByID(ctx, in, out)
+}
+
+func (h *chatServiceHandler) CreateWebhook(ctx context.Context, in *CreateWebhookRequest, out *CreateWebhookResponse) error {
+	return h.ChatServiceHandler.CreateWebhook(ctx, in, out)
+}
+
+func (h *chatServiceHandler) UpdateWebhook(ctx context.Context, in *UpdateWebhookRequest, out *UpdateWebhookResponse) error {
+	return h.ChatServiceHandler.UpdateWebhook(ctx, in, out)
+}
+
+func (h *chatServiceHandler) DeleteWebhook(ctx context.Context, in *DeleteWebhookRequest, out *DeleteWebhookResponse) error {
+	return h.ChatServiceHandler.DeleteWebhook(ctx, in, out)
+}
+
+func (h *chatServiceHandler) GetWebhookDeliveries(ctx context.Context, in *GetWebhookDeliveriesRequest, out *GetWebhookDeliveriesResponse) error {
+	return h.ChatServiceHandler.GetWebhookDeliveries(ctx, in, out)
+}
+
+func (h *chatServiceHandler) GetDomainSetting(ctx context.Context, in *GetDomainSettingRequest, out *GetDomainSettingResponse) error {
+	return h.ChatServiceHandler.GetDomainSetting(ctx, in, out)
+}
+
+func (h *chatServiceHandler) UpdateDomainSetting(ctx context.Context, in *UpdateDomainSettingRequest, out *UpdateDomainSettingResponse) error {
+	return h.ChatServiceHandler.UpdateDomainSetting(ctx, in, out)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+
+	pb "github.com/matvoy/chat_server/api/proto/bot"
+	pbchat "github.com/matvoy/chat_server/api/proto/chat"
+
+	"github.com/rs/zerolog"
+)
+
+// ChannelAdapter connects a single bot profile with an external messenger
+type ChannelAdapter interface {
+	// Configure reads the profile credentials and prepares the client
+	Configure(profile *pbchat.Profile) error
+	// RegisterWebhook points the messenger updates to the url
+	RegisterWebhook(url string) error
+	// ParseInbound converts webhook request into the incoming messages
+	ParseInbound(r *http.Request) ([]*InboundMessage, error)
+	// Send delivers chat message to the external user
+	// and returns its id in the messenger, empty if the messenger does not report it
+	Send(req *pb.SendMessageRequest) (string, error)
+	// Teardown removes the webhook and releases the client
+	Teardown() error
+}
+
+// MessageEditor is implemented by the adapters of the messengers
+// that allow the bot to change its sent messages
+type MessageEditor interface {
+	EditMessage(req *pb.EditMessageRequest) error
+	DeleteMessage(req *pb.DeleteMessageRequest) error
+}
+
+// InboundMessage is a message received from the external user
+type InboundMessage struct {
+	ExternalID string
+	Username   string
+	Message    *pbchat.Message
+	// Variables are the custom attributes of the user passed to the flow on start
+	Variables map[string]string
+	// Edited message replaces the text of the one with the same Message.ExternalId
+	Edited bool
+	// Status is the delivery report of the sent message, such inbound message has no Message
+	Status *MessageStatus
+}
+
+// MessageStatus is the new state of the message sent to the external user:
+// delivered, read or failed
+type MessageStatus struct {
+	ExternalMessageID string
+	Status            string
+	Cause             string
+}
+
+// AdapterFactory creates not configured adapter
+type AdapterFactory func(log *zerolog.Logger, client pbchat.ChatService) ChannelAdapter
+
+type adapterInfo struct {
+	route   string
+	factory AdapterFactory
+}
+
+var adapters = make(map[string]*adapterInfo)
+
+// RegisterAdapter makes the channel type available for profiles.
+// Webhooks of the channel are served on /{route}/{profile_id}.
+// It is intended to be called from the init function of the adapter file.
+func RegisterAdapter(channelType, route string, factory AdapterFactory) {
+	if _, ok := adapters[channelType]; ok {
+		panic("adapter already registered: " + channelType)
+	}
+	adapters[channelType] = &adapterInfo{
+		route,
+		factory,
+	}
+}
+
+// channelTypes returns registered channel types in stable order
+func channelTypes() []string {
+	types := make([]string, 0, len(adapters))
+	for channelType := range adapters {
+		types = append(types, channelType)
+	}
+	sort.Strings(types)
+	return types
+}
@@ -4,23 +4,42 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"strconv"
 	"strings"
 
 	pb "github.com/matvoy/chat_server/api/proto/bot"
 	pbchat "github.com/matvoy/chat_server/api/proto/chat"
 
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
 )
 
 const (
-	scenarioRoute = "omni/1/scenarios"
-	messageRoute  = "omni/1/advanced"
+	scenarioRoute           = "omni/1/scenarios"
+	messageRoute            = "omni/1/advanced"
+	interactiveButtonsRoute = "whatsapp/1/message/interactive/buttons"
+	interactiveListRoute    = "whatsapp/1/message/interactive/list"
+
+	// whatsapp limits of the interactive messages
+	waMaxButtons      = 3
+	waMaxButtonTitle  = 20
+	waMaxListRows     = 10
+	waMaxListRowTitle = 24
+	waListButtonTitle = "Menu"
+)
+
+// inbound message types of the pressed reply button and list row
+const (
+	waButtonReplyType = "INTERACTIVE_BUTTON_REPLY"
+	waListReplyType   = "INTERACTIVE_LIST_REPLY"
 )
 
+func init() {
+	RegisterAdapter("infobip-whatsapp", "infobip/whatsapp", NewInfobipWAAdapter)
+}
+
 type CreateScenarioRequest struct {
 	Name    string  `json:"name"`
 	Flow    []*Flow `json:"flow"`
@@ -40,12 +59,66 @@ type SendMessageWARequest struct {
 	ScenarioKey  string           `json:"scenarioKey"`
 	Destinations []*Destination   `json:"destinations"`
 	WhatsApp     *WhatsAppMessage `json:"whatsApp"`
+	NotifyURL    string           `json:"notifyUrl,omitempty"`
 }
 
 type WhatsAppMessage struct {
 	Text string `json:"text"`
 }
 
+// SendResponseWA is the response of both the omni and the whatsapp routes,
+// the first keeps the sent messages in the list
+type SendResponseWA struct {
+	MessageID string `json:"messageId"`
+	Messages  []*struct {
+		MessageID string `json:"messageId"`
+	} `json:"messages"`
+}
+
+// InteractiveWARequest is the whatsapp message with the reply buttons or the list
+type InteractiveWARequest struct {
+	From      string                `json:"from"`
+	To        string                `json:"to"`
+	Content   *InteractiveWAContent `json:"content"`
+	NotifyURL string                `json:"notifyUrl,omitempty"`
+}
+
+type InteractiveWAContent struct {
+	Header *InteractiveWAHeader `json:"header,omitempty"`
+	Body   *InteractiveWABody   `json:"body"`
+	Action *InteractiveWAAction `json:"action"`
+}
+
+type InteractiveWAHeader struct {
+	Type     string `json:"type"`
+	MediaURL string `json:"mediaUrl,omitempty"`
+}
+
+type InteractiveWABody struct {
+	Text string `json:"text"`
+}
+
+type InteractiveWAAction struct {
+	Buttons  []*ReplyButtonWA `json:"buttons,omitempty"`
+	Title    string           `json:"title,omitempty"`
+	Sections []*ListSectionWA `json:"sections,omitempty"`
+}
+
+type ReplyButtonWA struct {
+	Type  string `json:"type"`
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+type ListSectionWA struct {
+	Rows []*ListRowWA `json:"rows"`
+}
+
+type ListRowWA struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
 type Destination struct {
 	MessageId string             `json:"messageId,omitempty"`
 	To        *NumberDestination `json:"to"`
@@ -70,6 +143,22 @@ type Result struct {
 	Message         `json:"message"`
 	Contact         `json:"contact"`
 	Price           `json:"price"`
+	// Status and Error are set in the delivery reports, SeenAt in the seen reports
+	Status *ReportStatus `json:"status"`
+	Error  *ReportError  `json:"error"`
+	SeenAt string        `json:"seenAt"`
+}
+
+type ReportStatus struct {
+	GroupName   string `json:"groupName"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type ReportError struct {
+	GroupName   string `json:"groupName"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
 }
 
 type Message struct {
@@ -77,6 +166,9 @@ type Message struct {
 	Text    string `json:"text"`
 	URL     string `json:"url"`
 	Caption string `json:"caption"`
+	// ID and Title are the pressed reply button or list row
+	ID    string `json:"id"`
+	Title string `json:"title"`
 }
 
 type Contact struct {
@@ -88,60 +180,61 @@ type Price struct {
 	Currency        string  `json:"currency"`
 }
 
-type infobipWAClient struct {
+type infobipWAAdapter struct {
+	log         *zerolog.Logger
+	client      pbchat.ChatService
 	apiKey      string
 	scenarioKey string
 	number      string
 	url         string
+	// notifyURL receives the delivery reports of the sent messages
+	notifyURL string
 }
 
-func NewInfobipWAClient(apiKey, scenarioKey, number, url string) *infobipWAClient {
-	return &infobipWAClient{
-		apiKey,
-		scenarioKey,
-		number,
-		url,
+func NewInfobipWAAdapter(log *zerolog.Logger, client pbchat.ChatService) ChannelAdapter {
+	return &infobipWAAdapter{
+		log:    log,
+		client: client,
 	}
 }
 
-func (b *botService) configureInfobipWA(profile *pbchat.Profile) *infobipWAClient {
+func (a *infobipWAAdapter) Configure(profile *pbchat.Profile) error {
 	apiKey, ok := profile.Variables["api_key"]
 	if !ok {
-		b.log.Fatal().Msg("api key not found")
-		return nil
+		return errors.New("api key not found")
 	}
 	number, ok := profile.Variables["number"]
 	if !ok {
-		b.log.Fatal().Msg("api key not found")
-		return nil
+		return errors.New("number not found")
 	}
 	url, ok := profile.Variables["url"]
 	if !ok {
-		b.log.Fatal().Msg("api key not found")
-		return nil
+		return errors.New("url not found")
 	}
-	scenarioKey, _ := profile.Variables["scenario_key"]
+	scenarioKey, ok := profile.Variables["scenario_key"]
 	if !ok {
-		b.log.Debug().Msg("creating scenario")
+		a.log.Debug().Msg("creating scenario")
 		var err error
-		scenarioKey, err = b.createWAScenario(apiKey, number, url)
+		scenarioKey, err = createWAScenario(apiKey, number, url)
 		if err != nil {
-			b.log.Fatal().Msg(err.Error())
-			return nil
+			return err
 		}
 		profile.Variables["scenario_key"] = scenarioKey
-		if _, err := b.client.UpdateProfile(context.Background(), &pbchat.UpdateProfileRequest{
+		if _, err := a.client.UpdateProfile(context.Background(), &pbchat.UpdateProfileRequest{
 			// Id:   profile.Id,
 			Item: profile,
 		}); err != nil {
-			b.log.Fatal().Msg(err.Error())
-			return nil
+			return err
 		}
 	}
-	return NewInfobipWAClient(apiKey, scenarioKey, number, url)
+	a.apiKey = apiKey
+	a.scenarioKey = scenarioKey
+	a.number = number
+	a.url = url
+	return nil
 }
 
-func (b *botService) createWAScenario(apiKey, number, url string) (scenarioKey string, err error) {
+func createWAScenario(apiKey, number, url string) (scenarioKey string, err error) {
 	body, err := json.Marshal(CreateScenarioRequest{
 		Name:    number,
 		Default: true,
@@ -171,7 +264,7 @@ func (b *botService) createWAScenario(apiKey, number, url string) (scenarioKey s
 		return
 	}
 	res.Body.Close()
-	var scenario *CreateScenarioResponse
+	scenario := &CreateScenarioResponse{}
 	err = json.Unmarshal(data, scenario)
 	if err != nil {
 		return
@@ -180,123 +273,288 @@ func (b *botService) createWAScenario(apiKey, number, url string) (scenarioKey s
 	return
 }
 
-func (b *botService) addProfileInfobipWA(req *pb.AddProfileRequest) error {
-	bot := b.configureInfobipWA(req.Profile)
-	b.infobipWABots[req.Profile.Id] = bot
-	b.botMap[req.Profile.Id] = "infobip-whatsapp"
+// RegisterWebhook keeps the url for the delivery reports of the sent messages,
+// the inbound messages and the seen reports are forwarded to the url set up in the infobip portal
+func (a *infobipWAAdapter) RegisterWebhook(url string) error {
+	a.notifyURL = url
 	return nil
 }
 
-func (b *botService) deleteProfileInfobipWA(req *pb.DeleteProfileRequest) error {
-	delete(b.infobipWABots, req.Id)
-	delete(b.botMap, req.Id)
+func (a *infobipWAAdapter) Teardown() error {
 	return nil
 }
 
-func (b *botService) sendMessageInfobipWA(req *pb.SendMessageRequest) error {
-	profile := b.infobipWABots[req.ProfileId]
-	body, err := json.Marshal(SendMessageWARequest{
-		ScenarioKey: profile.scenarioKey,
+func (a *infobipWAAdapter) Send(req *pb.SendMessageRequest) (string, error) {
+	message := req.GetMessage()
+	options, links := waOptions(message.GetButtons(), message.GetQuickReplies())
+	text := joinLines(append([]string{message.GetText()}, links...))
+	// the id of the first sent message identifies the chat message in infobip
+	var externalID string
+	if len(options) > 0 {
+		id, err := a.sendInteractive(req.ExternalUserId, nil, text, options)
+		if err != nil {
+			return "", err
+		}
+		externalID = id
+	} else if message.GetText() != "" || len(message.GetCards()) == 0 {
+		id, err := a.sendText(req.ExternalUserId, text)
+		if err != nil {
+			return "", err
+		}
+		externalID = id
+	}
+	// whatsapp has no carousel, the cards are sent one by one
+	for _, card := range message.GetCards() {
+		options, links := waOptions([]*pbchat.Message_ButtonRow{{Buttons: card.GetButtons()}}, nil)
+		text := joinLines(append([]string{card.GetTitle(), card.GetSubtitle()}, links...))
+		var id string
+		var err error
+		if len(options) == 0 {
+			if card.GetImageUrl() != "" {
+				text += "\n" + card.GetImageUrl()
+			}
+			id, err = a.sendText(req.ExternalUserId, text)
+		} else {
+			var header *InteractiveWAHeader
+			if card.GetImageUrl() != "" {
+				header = &InteractiveWAHeader{
+					Type:     "IMAGE",
+					MediaURL: card.GetImageUrl(),
+				}
+			}
+			id, err = a.sendInteractive(req.ExternalUserId, header, text, options)
+		}
+		if err != nil {
+			return "", err
+		}
+		if externalID == "" {
+			externalID = id
+		}
+	}
+	return externalID, nil
+}
+
+func (a *infobipWAAdapter) sendText(to, text string) (string, error) {
+	return a.post(messageRoute, SendMessageWARequest{
+		ScenarioKey: a.scenarioKey,
 		WhatsApp: &WhatsAppMessage{
-			Text: "webitel " + req.GetMessage().GetText(),
+			Text: "webitel " + text,
 		},
 		Destinations: []*Destination{{
 			To: &NumberDestination{
-				PhoneNumber: req.ExternalUserId,
+				PhoneNumber: to,
 			},
 		}},
+		NotifyURL: a.notifyURL,
 	})
+}
+
+// sendInteractive sends up to waMaxButtons options as the reply buttons and the longer menus as the list
+func (a *infobipWAAdapter) sendInteractive(to string, header *InteractiveWAHeader, text string, options []*ReplyButtonWA) (string, error) {
+	content := &InteractiveWAContent{
+		Header: header,
+		Body: &InteractiveWABody{
+			Text: text,
+		},
+		Action: &InteractiveWAAction{},
+	}
+	route := interactiveButtonsRoute
+	if len(options) <= waMaxButtons {
+		for _, option := range options {
+			option.Title = truncate(option.Title, waMaxButtonTitle)
+		}
+		content.Action.Buttons = options
+	} else {
+		if len(options) > waMaxListRows {
+			a.log.Warn().
+				Int("options", len(options)).
+				Msg("whatsapp list is truncated")
+			options = options[:waMaxListRows]
+		}
+		section := &ListSectionWA{
+			Rows: make([]*ListRowWA, 0, len(options)),
+		}
+		for _, option := range options {
+			section.Rows = append(section.Rows, &ListRowWA{
+				ID:    option.ID,
+				Title: truncate(option.Title, waMaxListRowTitle),
+			})
+		}
+		route = interactiveListRoute
+		// the list has no header image
+		content.Header = nil
+		content.Action.Title = waListButtonTitle
+		content.Action.Sections = []*ListSectionWA{section}
+	}
+	return a.post(route, InteractiveWARequest{
+		From:      a.number,
+		To:        to,
+		Content:   content,
+		NotifyURL: a.notifyURL,
+	})
+}
+
+// post sends the message and returns its infobip id
+func (a *infobipWAAdapter) post(route string, request interface{}) (string, error) {
+	body, err := json.Marshal(request)
 	if err != nil {
-		return err
+		return "", err
 	}
-	infobipReq, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/%s", profile.url, messageRoute), bytes.NewBuffer(body))
+	infobipReq, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/%s", a.url, route), bytes.NewBuffer(body))
 	if err != nil {
-		return err
+		return "", err
 	}
 	infobipReq.Header.Set("Content-Type", "application/json")
-	infobipReq.Header.Set("Authorization", fmt.Sprintf("App %s", profile.apiKey))
+	infobipReq.Header.Set("Authorization", fmt.Sprintf("App %s", a.apiKey))
 
 	infobipRes, err := http.DefaultClient.Do(infobipReq)
 	if err != nil {
-		return err
+		return "", err
 	}
-	_, err = ioutil.ReadAll(infobipRes.Body)
-	return err
-}
-
-func (b *botService) InfobipWAWebhookHandler(w http.ResponseWriter, r *http.Request) {
-	p := strings.TrimPrefix(r.URL.Path, "/infobip/whatsapp/")
-	profileID, err := strconv.ParseInt(p, 10, 64)
+	defer infobipRes.Body.Close()
+	data, err := ioutil.ReadAll(infobipRes.Body)
 	if err != nil {
-		b.log.Error().Msg(err.Error())
-		return
+		return "", err
 	}
-	update := &InfobipWABody{}
-	if err := json.NewDecoder(r.Body).Decode(update); err != nil {
-		log.Error().Msgf("could not decode request body: %s", err)
-		return
+	result := &SendResponseWA{}
+	if err := json.Unmarshal(data, result); err != nil {
+		// the message is sent, only its id is unknown
+		a.log.Warn().Msg(err.Error())
+		return "", nil
 	}
-	if len(update.Results) == 0 ||
-		(Message{}) == update.Results[0].Message {
-		log.Warn().Msg("no data")
-		return
+	if result.MessageID == "" && len(result.Messages) > 0 {
+		return result.Messages[0].MessageID, nil
 	}
-	if update.Results[0].Message.Text == "" {
-		return
+	return result.MessageID, nil
+}
+
+// waOptions converts the postback buttons and the quick replies into the reply options,
+// whatsapp has no url buttons so they are returned as the text links
+func waOptions(rows []*pbchat.Message_ButtonRow, quickReplies []string) ([]*ReplyButtonWA, []string) {
+	var options []*ReplyButtonWA
+	var links []string
+	for _, row := range rows {
+		for _, button := range row.GetButtons() {
+			if button.GetType() == "url" {
+				links = append(links, button.GetText()+": "+button.GetUrl())
+				continue
+			}
+			id := button.GetPayload()
+			if id == "" {
+				id = button.GetText()
+			}
+			options = append(options, &ReplyButtonWA{
+				Type:  "REPLY",
+				ID:    id,
+				Title: button.GetText(),
+			})
+		}
 	}
-	b.log.Debug().
-		Str("from", update.Results[0].From).
-		Str("username", update.Results[0].Contact.Name).
-		Str("text", update.Results[0].Message.Text).
-		Msg("receive message")
-
-	check := &pbchat.CheckSessionRequest{
-		ExternalId: update.Results[0].From,
-		ProfileId:  profileID,
-		Username:   update.Results[0].Contact.Name,
+	for _, reply := range quickReplies {
+		options = append(options, &ReplyButtonWA{
+			Type:  "REPLY",
+			ID:    reply,
+			Title: reply,
+		})
 	}
-	resCheck, err := b.client.CheckSession(context.Background(), check)
-	if err != nil {
-		b.log.Error().Msg(err.Error())
-		return
+	return options, links
+}
+
+// joinLines joins the not empty lines
+func joinLines(lines []string) string {
+	result := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if line != "" {
+			result = append(result, line)
+		}
 	}
-	b.log.Debug().
-		Bool("exists", resCheck.Exists).
-		Str("channel_id", resCheck.ChannelId).
-		Int64("client_id", resCheck.ClientId).
-		Msg("check user")
-
-	if !resCheck.Exists {
-		start := &pbchat.StartConversationRequest{
-			User: &pbchat.User{
-				UserId:     resCheck.ClientId,
-				Type:       "infobip-whatsapp",
-				Connection: p,
-				Internal:   false,
-			},
-			Username: check.Username,
-			DomainId: 1,
+	return strings.Join(result, "\n")
+}
+
+func truncate(value string, limit int) string {
+	if runes := []rune(value); len(runes) > limit {
+		return string(runes[:limit])
+	}
+	return value
+}
+
+func (a *infobipWAAdapter) ParseInbound(r *http.Request) ([]*InboundMessage, error) {
+	update := &InfobipWABody{}
+	if err := json.NewDecoder(r.Body).Decode(update); err != nil {
+		return nil, fmt.Errorf("could not decode request body: %s", err)
+	}
+	result := make([]*InboundMessage, 0, len(update.Results))
+	for _, item := range update.Results {
+		if status := parseWAReport(item); status != nil {
+			if status.Status != "" {
+				result = append(result, &InboundMessage{
+					ExternalID: item.To,
+					Status:     status,
+				})
+			}
+			continue
 		}
-		_, err := b.client.StartConversation(context.Background(), start)
-		if err != nil {
-			b.log.Error().Msg(err.Error())
-			return
+		if item.Message.Type == waButtonReplyType || item.Message.Type == waListReplyType {
+			result = append(result, &InboundMessage{
+				ExternalID: item.From,
+				Username:   item.Contact.Name,
+				Message: &pbchat.Message{
+					Type: "postback",
+					Value: &pbchat.Message_Postback_{
+						Postback: &pbchat.Message_Postback{
+							Payload: item.Message.ID,
+							Text:    item.Message.Title,
+						},
+					},
+				},
+			})
+			continue
 		}
-	} else {
-		textMessage := &pbchat.Message{
-			Type: strings.ToLower(update.Results[0].Message.Type),
-			Value: &pbchat.Message_Text{
-				Text: strings.TrimPrefix(update.Results[0].Message.Text, "webitel "),
+		if (Message{}) == item.Message || item.Message.Text == "" {
+			a.log.Warn().
+				Str("from", item.From).
+				Msg("no data")
+			continue
+		}
+		result = append(result, &InboundMessage{
+			ExternalID: item.From,
+			Username:   item.Contact.Name,
+			Message: &pbchat.Message{
+				Type: strings.ToLower(item.Message.Type),
+				Value: &pbchat.Message_Text{
+					Text: strings.TrimPrefix(item.Message.Text, "webitel "),
+				},
 			},
+		})
+	}
+	return result, nil
+}
+
+// parseWAReport converts the delivery or the seen report, nil means the result is the inbound message.
+// The pending reports have no status, the message is already sent.
+func parseWAReport(item *Result) *MessageStatus {
+	switch {
+	case item.SeenAt != "":
+		return &MessageStatus{
+			ExternalMessageID: item.MessageID,
+			Status:            "read",
 		}
-		message := &pbchat.SendMessageRequest{
-			Message:   textMessage,
-			ChannelId: resCheck.ChannelId,
-			FromFlow:  false,
+	case item.Status != nil:
+		status := &MessageStatus{
+			ExternalMessageID: item.MessageID,
 		}
-		_, err := b.client.SendMessage(context.Background(), message)
-		if err != nil {
-			b.log.Error().Msg(err.Error())
+		switch item.Status.GroupName {
+		case "DELIVERED":
+			status.Status = "delivered"
+		case "UNDELIVERABLE", "EXPIRED", "REJECTED":
+			status.Status = "failed"
+			status.Cause = item.Status.Description
+			if item.Error != nil && item.Error.Description != "" {
+				status.Cause = item.Error.Description
+			}
 		}
+		return status
+	default:
+		return nil
 	}
 }
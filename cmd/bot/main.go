@@ -5,6 +5,7 @@ import (
 
 	pb "github.com/matvoy/chat_server/api/proto/bot"
 	pbchat "github.com/matvoy/chat_server/api/proto/chat"
+	"github.com/matvoy/chat_server/internal/auth"
 
 	"github.com/gorilla/mux"
 	"github.com/micro/cli/v2"
@@ -15,11 +16,12 @@ import (
 )
 
 type Config struct {
-	LogLevel string
-	Webhook  string
-	CertPath string
-	KeyPath  string
-	AppPort  int
+	LogLevel   string
+	Webhook    string
+	CertPath   string
+	KeyPath    string
+	AppPort    int
+	ServiceKey string
 }
 
 var (
@@ -68,6 +70,11 @@ func main() {
 				EnvVars: []string{"KEY_PATH"},
 				Usage:   "SSl key",
 			},
+			&cli.StringFlag{
+				Name:    "service_key",
+				EnvVars: []string{"SERVICE_KEY"},
+				Usage:   "Key to sign the chat server requests: id:secret",
+			},
 		),
 	)
 
@@ -78,14 +85,22 @@ func main() {
 			cfg.CertPath = c.String("cert_path")
 			cfg.KeyPath = c.String("key_path")
 			cfg.AppPort = c.Int("app_port")
+			cfg.ServiceKey = c.String("service_key")
 			// cfg.ConversationTimeout = c.Uint64("conversation_timeout")
 
-			client = pbchat.NewChatService("webitel.chat.server", service.Client())
 			var err error
 			logger, err = NewLogger(cfg.LogLevel)
 			if err != nil {
 				return err
 			}
+			signer, err := auth.NewSigner("webitel.chat.bot", cfg.ServiceKey)
+			if err != nil {
+				logger.Fatal().
+					Str("app", "failed to parse service key").
+					Msg(err.Error())
+				return err
+			}
+			client = pbchat.NewChatService("webitel.chat.server", auth.NewSignWrapper(signer)(service.Client()))
 			return configure()
 		}),
 		micro.AfterStart(
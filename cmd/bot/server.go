@@ -3,32 +3,43 @@ package main
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"sync"
 
 	pb "github.com/matvoy/chat_server/api/proto/bot"
 	pbchat "github.com/matvoy/chat_server/api/proto/chat"
 
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 	"github.com/gorilla/mux"
+	"github.com/micro/go-micro/v2/errors"
 	"github.com/rs/zerolog"
 )
 
 type ChatServer interface {
-	TelegramWebhookHandler(w http.ResponseWriter, r *http.Request)
+	WebhookHandler(w http.ResponseWriter, r *http.Request)
 	SendMessage(ctx context.Context, req *pb.SendMessageRequest, res *pb.SendMessageResponse) error
+	EditMessage(ctx context.Context, req *pb.EditMessageRequest, res *pb.EditMessageResponse) error
+	DeleteMessage(ctx context.Context, req *pb.DeleteMessageRequest, res *pb.DeleteMessageResponse) error
 	AddProfile(ctx context.Context, req *pb.AddProfileRequest, res *pb.AddProfileResponse) error
 	DeleteProfile(ctx context.Context, req *pb.DeleteProfileRequest, res *pb.DeleteProfileResponse) error
 	StartWebhookServer() error
 	StopWebhookServer() error
 }
 
+// profileBot keeps the profile the adapter was configured with,
+// the profile domain is used for the conversations of the bot users
+type profileBot struct {
+	profile *pbchat.Profile
+	adapter ChannelAdapter
+}
+
 type botService struct {
-	log           *zerolog.Logger
-	client        pbchat.ChatService
-	router        *mux.Router
-	telegramBots  map[int64]*tgbotapi.BotAPI
-	infobipWABots map[int64]*infobipWAClient
-	botMap        map[int64]string
+	log    *zerolog.Logger
+	client pbchat.ChatService
+	router *mux.Router
+	mx     sync.RWMutex
+	bots   map[int64]*profileBot
 }
 
 func NewBotService(
@@ -41,61 +52,116 @@ func NewBotService(
 		client: client,
 		router: router,
 	}
-	b.botMap = make(map[int64]string)
-	b.telegramBots = make(map[int64]*tgbotapi.BotAPI)
-	b.infobipWABots = make(map[int64]*infobipWAClient)
+	b.bots = make(map[int64]*profileBot)
 
-	b.router.HandleFunc("/telegram/{profile_id}", b.TelegramWebhookHandler).
-		Methods("POST")
-	b.router.HandleFunc("/infobip/whatsapp/{profile_id}", b.InfobipWAWebhookHandler).
-		Methods("POST")
+	for _, channelType := range channelTypes() {
+		b.router.HandleFunc(fmt.Sprintf("/%s/{profile_id}", adapters[channelType].route), b.WebhookHandler).
+			Methods("POST")
+	}
 
-	res, err := b.client.GetProfiles(context.Background(), &pbchat.GetProfilesRequest{Size: 100})
-	if err != nil || res == nil {
+	profiles, err := b.getAllProfiles()
+	if err != nil {
 		b.log.Fatal().Msg(err.Error())
 		return nil
 	}
 
-	for _, profile := range res.Items {
-		switch profile.Type {
-		case "telegram":
-			{
-				b.botMap[profile.Id] = "telegram"
-				b.telegramBots[profile.Id] = b.configureTelegram(profile)
-			}
-		case "infobip-whatsapp":
-			{
-				b.botMap[profile.Id] = "infobip-whatsapp"
-				b.infobipWABots[profile.Id] = b.configureInfobipWA(profile)
-			}
-		default:
+	for _, profile := range profiles {
+		bot, err := b.newProfileBot(profile)
+		if err != nil {
 			b.log.Warn().
 				Int64("id", profile.Id).
 				Str("type", profile.Type).
 				Str("name", profile.Name).
 				Int64("domain_id", profile.DomainId).
-				Msg("wrong profile type")
+				Msg(err.Error())
+			continue
 		}
+		b.bots[profile.Id] = bot
 	}
 
 	return b
 }
 
+func (b *botService) getAllProfiles() ([]*pbchat.Profile, error) {
+	var profiles []*pbchat.Profile
+	for page := int32(1); ; page++ {
+		res, err := b.client.GetProfiles(context.Background(), &pbchat.GetProfilesRequest{
+			Size: 100,
+			Page: page,
+		})
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, res.Items...)
+		if !res.Next {
+			return profiles, nil
+		}
+	}
+}
+
+func (b *botService) newProfileBot(profile *pbchat.Profile) (*profileBot, error) {
+	info, ok := adapters[profile.Type]
+	if !ok {
+		return nil, fmt.Errorf("wrong profile type")
+	}
+	adapter := info.factory(b.log, b.client)
+	if err := adapter.Configure(profile); err != nil {
+		return nil, err
+	}
+	return &profileBot{
+		profile,
+		adapter,
+	}, nil
+}
+
+func (b *botService) getProfileBot(profileID int64) (*profileBot, bool) {
+	b.mx.RLock()
+	defer b.mx.RUnlock()
+	bot, ok := b.bots[profileID]
+	return bot, ok
+}
+
+func webhookURL(channelType string, profileID int64) string {
+	return fmt.Sprintf("%s/%s/%v", cfg.Webhook, adapters[channelType].route, profileID)
+}
+
+// registerWebhooks sets webhooks for the configured bots.
+// Some messengers check the webhook url while setting it, so the webhook server must be already listening.
+func (b *botService) registerWebhooks() {
+	b.mx.RLock()
+	defer b.mx.RUnlock()
+	for profileID, bot := range b.bots {
+		if err := bot.adapter.RegisterWebhook(webhookURL(bot.profile.Type, profileID)); err != nil {
+			b.log.Error().
+				Int64("profile_id", profileID).
+				Str("type", bot.profile.Type).
+				Msg(err.Error())
+		}
+	}
+}
+
 func (b *botService) StartWebhookServer() error {
 	b.log.Info().
 		Int("port", cfg.AppPort).
 		Msg("webhook started listening on port")
-	return http.ListenAndServe(fmt.Sprintf(":%v", cfg.AppPort), b.router) // srv.ListenAndServeTLS(cfg.CertPath, cfg.KeyPath)
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%v", cfg.AppPort))
+	if err != nil {
+		return err
+	}
+	go b.registerWebhooks()
+	return http.Serve(ln, b.router) // srv.ListenAndServeTLS(cfg.CertPath, cfg.KeyPath)
 }
 
 func (b *botService) StopWebhookServer() error {
 	b.log.Info().
 		Msg("removing webhooks")
-	for k := range b.telegramBots {
-		if _, err := b.telegramBots[k].RemoveWebhook(); err != nil {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	for k, bot := range b.bots {
+		if err := bot.adapter.Teardown(); err != nil {
 			b.log.Error().Msg(err.Error())
 		}
-		delete(b.telegramBots, k)
+		delete(b.bots, k)
 	}
 	return nil
 }
@@ -106,25 +172,76 @@ func (b *botService) SendMessage(ctx context.Context, req *pb.SendMessageRequest
 		Str("type", req.GetMessage().GetType()).
 		Str("user_id", req.GetExternalUserId()).
 		Msg("send message")
-	switch b.botMap[req.ProfileId] {
-	case "telegram":
-		{
-			if err := b.sendMessageTelegram(req); err != nil {
-				b.log.Error().Msg(err.Error())
-				return err
-			}
-		}
-	case "infobip-whatsapp":
-		{
-			if err := b.sendMessageInfobipWA(req); err != nil {
-				b.log.Error().Msg(err.Error())
-				return err
-			}
-		}
+	bot, ok := b.getProfileBot(req.GetProfileId())
+	if !ok {
+		b.log.Warn().
+			Int64("profile_id", req.GetProfileId()).
+			Msg("profile not found")
+		return errors.BadRequest("profile not found", "")
+	}
+	externalID, err := bot.adapter.Send(req)
+	if err != nil {
+		b.log.Error().Msg(err.Error())
+		return err
+	}
+	res.ExternalMessageId = externalID
+	return nil
+}
+
+// EditMessage changes the sent message, the messengers without editing are skipped
+func (b *botService) EditMessage(ctx context.Context, req *pb.EditMessageRequest, res *pb.EditMessageResponse) error {
+	b.log.Debug().
+		Int64("profile_id", req.GetProfileId()).
+		Str("user_id", req.GetExternalUserId()).
+		Str("message_id", req.GetExternalMessageId()).
+		Msg("edit message")
+	editor, err := b.getMessageEditor(req.GetProfileId())
+	if err != nil || editor == nil {
+		return err
+	}
+	if err := editor.EditMessage(req); err != nil {
+		b.log.Error().Msg(err.Error())
+		return err
+	}
+	return nil
+}
+
+// DeleteMessage removes the sent message, the messengers without deleting are skipped
+func (b *botService) DeleteMessage(ctx context.Context, req *pb.DeleteMessageRequest, res *pb.DeleteMessageResponse) error {
+	b.log.Debug().
+		Int64("profile_id", req.GetProfileId()).
+		Str("user_id", req.GetExternalUserId()).
+		Str("message_id", req.GetExternalMessageId()).
+		Msg("delete message")
+	editor, err := b.getMessageEditor(req.GetProfileId())
+	if err != nil || editor == nil {
+		return err
+	}
+	if err := editor.DeleteMessage(req); err != nil {
+		b.log.Error().Msg(err.Error())
+		return err
 	}
 	return nil
 }
 
+func (b *botService) getMessageEditor(profileID int64) (MessageEditor, error) {
+	bot, ok := b.getProfileBot(profileID)
+	if !ok {
+		b.log.Warn().
+			Int64("profile_id", profileID).
+			Msg("profile not found")
+		return nil, errors.BadRequest("profile not found", "")
+	}
+	editor, ok := bot.adapter.(MessageEditor)
+	if !ok {
+		b.log.Debug().
+			Str("type", bot.profile.Type).
+			Msg("messenger does not support editing")
+		return nil, nil
+	}
+	return editor, nil
+}
+
 func (b *botService) AddProfile(ctx context.Context, req *pb.AddProfileRequest, res *pb.AddProfileResponse) error {
 	b.log.Info().
 		Int64("id", req.GetProfile().GetId()).
@@ -132,22 +249,18 @@ func (b *botService) AddProfile(ctx context.Context, req *pb.AddProfileRequest,
 		Str("name", req.GetProfile().GetName()).
 		Int64("domain_id", req.GetProfile().GetDomainId()).
 		Msg("add profile")
-	switch req.Profile.Type {
-	case "telegram":
-		{
-			if err := b.addProfileTelegram(req); err != nil {
-				b.log.Error().Msg(err.Error())
-				return err
-			}
-		}
-	case "infobip-whatsapp":
-		{
-			if err := b.addProfileInfobipWA(req); err != nil {
-				b.log.Error().Msg(err.Error())
-				return err
-			}
-		}
+	bot, err := b.newProfileBot(req.GetProfile())
+	if err != nil {
+		b.log.Error().Msg(err.Error())
+		return err
+	}
+	if err := bot.adapter.RegisterWebhook(webhookURL(bot.profile.Type, req.GetProfile().GetId())); err != nil {
+		b.log.Error().Msg(err.Error())
+		return err
 	}
+	b.mx.Lock()
+	b.bots[req.GetProfile().GetId()] = bot
+	b.mx.Unlock()
 	return nil
 }
 
@@ -155,21 +268,140 @@ func (b *botService) DeleteProfile(ctx context.Context, req *pb.DeleteProfileReq
 	b.log.Info().
 		Int64("id", req.GetId()).
 		Msg("delete profile")
-	switch b.botMap[req.Id] {
-	case "telegram":
-		{
-			if err := b.deleteProfileTelegram(req); err != nil {
-				b.log.Error().Msg(err.Error())
-				return err
-			}
+	bot, ok := b.getProfileBot(req.GetId())
+	if !ok {
+		return nil
+	}
+	if err := bot.adapter.Teardown(); err != nil {
+		b.log.Error().Msg(err.Error())
+		return err
+	}
+	b.mx.Lock()
+	delete(b.bots, req.GetId())
+	b.mx.Unlock()
+	return nil
+}
+
+func (b *botService) WebhookHandler(w http.ResponseWriter, r *http.Request) {
+	p := mux.Vars(r)["profile_id"]
+	profileID, err := strconv.ParseInt(p, 10, 64)
+	if err != nil {
+		b.log.Error().Msg(err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	bot, ok := b.getProfileBot(profileID)
+	if !ok {
+		b.log.Warn().
+			Int64("profile_id", profileID).
+			Msg("profile not found")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	messages, err := bot.adapter.ParseInbound(r)
+	if err != nil {
+		b.log.Error().
+			Int64("profile_id", profileID).
+			Str("type", bot.profile.Type).
+			Msg(err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	for _, m := range messages {
+		b.receiveMessage(bot, m)
+	}
+}
+
+func (b *botService) receiveMessage(bot *profileBot, m *InboundMessage) {
+	if m.Status != nil {
+		b.updateMessageStatus(bot, m)
+		return
+	}
+	b.log.Debug().
+		Str("id", m.ExternalID).
+		Str("username", m.Username).
+		Str("type", m.Message.GetType()).
+		Str("text", m.Message.GetText()).
+		Msg("receive message")
+
+	check := &pbchat.CheckSessionRequest{
+		ExternalId: m.ExternalID,
+		ProfileId:  bot.profile.Id,
+		Username:   m.Username,
+		DomainId:   bot.profile.DomainId,
+	}
+	resCheck, err := b.client.CheckSession(context.Background(), check)
+	if err != nil {
+		b.log.Error().Msg(err.Error())
+		return
+	}
+	b.log.Debug().
+		Bool("exists", resCheck.Exists).
+		Str("channel_id", resCheck.ChannelId).
+		Int64("client_id", resCheck.ClientId).
+		Msg("check user")
+
+	if m.Edited {
+		// the conversation of the edited message may be already closed
+		if !resCheck.Exists {
+			return
+		}
+		edit := &pbchat.EditMessageRequest{
+			ChannelId:  resCheck.ChannelId,
+			ExternalId: m.Message.GetExternalId(),
+			Text:       m.Message.GetText(),
 		}
-	case "infobip-whatsapp":
-		{
-			if err := b.deleteProfileInfobipWA(req); err != nil {
-				b.log.Error().Msg(err.Error())
-				return err
-			}
+		if _, err := b.client.EditMessage(context.Background(), edit); err != nil {
+			b.log.Error().Msg(err.Error())
 		}
+		return
+	}
+
+	if !resCheck.Exists {
+		start := &pbchat.StartConversationRequest{
+			User: &pbchat.User{
+				UserId:     resCheck.ClientId,
+				Type:       bot.profile.Type,
+				Connection: strconv.FormatInt(bot.profile.Id, 10),
+				Internal:   false,
+			},
+			Username:  check.Username,
+			DomainId:  bot.profile.DomainId,
+			Message:   m.Message,
+			Variables: m.Variables,
+		}
+		_, err := b.client.StartConversation(context.Background(), start)
+		if err != nil {
+			b.log.Error().Msg(err.Error())
+			return
+		}
+	} else {
+		message := &pbchat.SendMessageRequest{
+			Message:   m.Message,
+			ChannelId: resCheck.ChannelId,
+			FromFlow:  false,
+		}
+		_, err := b.client.SendMessage(context.Background(), message)
+		if err != nil {
+			b.log.Error().Msg(err.Error())
+		}
+	}
+}
+
+func (b *botService) updateMessageStatus(bot *profileBot, m *InboundMessage) {
+	b.log.Debug().
+		Str("id", m.ExternalID).
+		Str("message_id", m.Status.ExternalMessageID).
+		Str("status", m.Status.Status).
+		Msg("receive message status")
+	status := &pbchat.UpdateMessageStatusRequest{
+		ProfileId:         bot.profile.Id,
+		ExternalUserId:    m.ExternalID,
+		ExternalMessageId: m.Status.ExternalMessageID,
+		Status:            m.Status.Status,
+		Cause:             m.Status.Cause,
+	}
+	if _, err := b.client.UpdateMessageStatus(context.Background(), status); err != nil {
+		b.log.Error().Msg(err.Error())
 	}
-	return nil
 }
@@ -1,11 +1,12 @@
 package main
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -13,23 +14,59 @@ import (
 	pbchat "github.com/matvoy/chat_server/api/proto/chat"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
 )
 
+func init() {
+	RegisterAdapter("telegram", "telegram", NewTelegramAdapter)
+}
+
+const locationURL = "https://www.google.com/maps/place/%v,%v" // latitude, longitude
+
+// botTokenPattern matches the bot token in the path of the telegram api urls
+var botTokenPattern = regexp.MustCompile(`bot\d+:[\w-]+`)
+
 type telegramBody struct {
-	Message struct {
-		MessageID int64       `json:"message_id"`
-		Text      string      `json:"text"`
-		Photo     []PhotoSize `json:"photo"` // image/jpeg
-		From      struct {
-			Username  string `json:"username"`
-			ID        int64  `json:"id"`
-			FirstName string `json:"first_name"`
-			LastName  string `json:"last_name"`
-		} `json:"from"`
+	Message       telegramMessage        `json:"message"`
+	EditedMessage *telegramMessage       `json:"edited_message"`
+	CallbackQuery *telegramCallbackQuery `json:"callback_query"`
+}
+
+type telegramMessage struct {
+	MessageID int64        `json:"message_id"`
+	Text      string       `json:"text"`
+	Caption   string       `json:"caption"`
+	Photo     []PhotoSize  `json:"photo"` // image/jpeg
+	Document  *Document    `json:"document"`
+	Voice     *Document    `json:"voice"`
+	Audio     *Document    `json:"audio"`
+	Video     *Document    `json:"video"`
+	Sticker   *Sticker     `json:"sticker"`
+	Location  *Location    `json:"location"`
+	From      telegramUser `json:"from"`
+	Chat      struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+}
+
+type telegramUser struct {
+	Username     string `json:"username"`
+	ID           int64  `json:"id"`
+	FirstName    string `json:"first_name"`
+	LastName     string `json:"last_name"`
+	LanguageCode string `json:"language_code"`
+}
+
+// telegramCallbackQuery is sent when the user presses the inline button with the callback data
+type telegramCallbackQuery struct {
+	ID      string       `json:"id"`
+	From    telegramUser `json:"from"`
+	Data    string       `json:"data"`
+	Message *struct {
 		Chat struct {
 			ID int64 `json:"id"`
 		} `json:"chat"`
+		ReplyMarkup *tgbotapi.InlineKeyboardMarkup `json:"reply_markup"`
 	} `json:"message"`
 }
 
@@ -41,193 +78,432 @@ type PhotoSize struct {
 	FileSize     int64  `json:"file_size"`
 }
 
-func (b *botService) configureTelegram(profile *pbchat.Profile) *tgbotapi.BotAPI {
+// Document describes telegram document, voice, audio and video attachments
+type Document struct {
+	FileID       string `json:"file_id"`
+	FileUniqueID string `json:"file_unique_id"`
+	FileName     string `json:"file_name"`
+	MimeType     string `json:"mime_type"`
+	FileSize     int64  `json:"file_size"`
+}
+
+type Sticker struct {
+	FileID       string `json:"file_id"`
+	FileUniqueID string `json:"file_unique_id"`
+	IsAnimated   bool   `json:"is_animated"`
+	FileSize     int64  `json:"file_size"`
+}
+
+type Location struct {
+	Longitude float64 `json:"longitude"`
+	Latitude  float64 `json:"latitude"`
+}
+
+type telegramAdapter struct {
+	log *zerolog.Logger
+	bot *tgbotapi.BotAPI
+}
+
+func NewTelegramAdapter(log *zerolog.Logger, client pbchat.ChatService) ChannelAdapter {
+	return &telegramAdapter{
+		log: log,
+	}
+}
+
+func (a *telegramAdapter) Configure(profile *pbchat.Profile) error {
 	token, ok := profile.Variables["token"]
 	if !ok {
-		b.log.Fatal().Msg("token not found")
-		return nil
+		return errors.New("token not found")
 	}
 	bot, err := tgbotapi.NewBotAPI(token)
 	if err != nil {
-		b.log.Fatal().Msg(err.Error())
-		return nil
+		return telegramError(err)
 	}
-	// webhookInfo := tgbotapi.NewWebhookWithCert(fmt.Sprintf("%s/telegram/%v", cfg.TgWebhook, profile.Id), cfg.CertPath)
-	webhookInfo := tgbotapi.NewWebhook(fmt.Sprintf("%s/telegram/%v", cfg.Webhook, profile.Id))
-	_, err = bot.SetWebhook(webhookInfo)
-	if err != nil {
-		b.log.Fatal().Msg(err.Error())
-		return nil
-	}
-	return bot
+	a.bot = bot
+	return nil
 }
 
-func (b *botService) addProfileTelegram(req *pb.AddProfileRequest) error {
-	token, ok := req.Profile.Variables["token"]
-	if !ok {
-		return errors.New("token not found")
-	}
-	bot, err := tgbotapi.NewBotAPI(token)
+func (a *telegramAdapter) RegisterWebhook(url string) error {
+	// webhookInfo := tgbotapi.NewWebhookWithCert(url, cfg.CertPath)
+	webhookInfo := tgbotapi.NewWebhook(url)
+	_, err := a.bot.SetWebhook(webhookInfo)
+	return telegramError(err)
+}
+
+func (a *telegramAdapter) Teardown() error {
+	_, err := a.bot.RemoveWebhook()
+	return telegramError(err)
+}
+
+func (a *telegramAdapter) Send(req *pb.SendMessageRequest) (string, error) {
+	id, err := strconv.ParseInt(req.ExternalUserId, 10, 64)
 	if err != nil {
-		return err
+		return "", err
+	}
+	message := req.GetMessage()
+	markup := telegramReplyMarkup(message)
+	var msg tgbotapi.Chattable
+	if file := message.GetFile(); file != nil {
+		switch mime := file.GetMimeType(); {
+		case strings.HasPrefix(mime, "image/"):
+			photo := tgbotapi.NewPhotoShare(id, file.GetUrl())
+			photo.ReplyMarkup = markup
+			msg = photo
+		case strings.HasPrefix(mime, "audio/"):
+			audio := tgbotapi.NewAudioShare(id, file.GetUrl())
+			audio.ReplyMarkup = markup
+			msg = audio
+		case strings.HasPrefix(mime, "video/"):
+			video := tgbotapi.NewVideoShare(id, file.GetUrl())
+			video.ReplyMarkup = markup
+			msg = video
+		default:
+			document := tgbotapi.NewDocumentShare(id, file.GetUrl())
+			document.ReplyMarkup = markup
+			msg = document
+		}
+	} else if message.GetText() != "" || len(message.GetCards()) == 0 {
+		text := tgbotapi.NewMessage(id, message.GetText())
+		text.ReplyMarkup = markup
+		msg = text
 	}
-	// webhookInfo := tgbotapi.NewWebhookWithCert(fmt.Sprintf("%s/telegram/%v", cfg.TgWebhook, profile.Id), cfg.CertPath)
-	webhookInfo := tgbotapi.NewWebhook(fmt.Sprintf("%s/telegram/%v", cfg.Webhook, req.Profile.Id))
-	_, err = bot.SetWebhook(webhookInfo)
+	// msg.ReplyToMessageID = update.Message.MessageID
+	// the id of the first sent message identifies the chat message in telegram
+	var externalID string
+	if msg != nil {
+		sent, err := a.bot.Send(msg)
+		if err != nil {
+			return "", telegramError(err)
+		}
+		externalID = strconv.Itoa(sent.MessageID)
+	}
+	// telegram has no carousel, the cards are sent one by one
+	for _, card := range message.GetCards() {
+		sent, err := a.bot.Send(telegramCard(id, card))
+		if err != nil {
+			return "", telegramError(err)
+		}
+		if externalID == "" {
+			externalID = strconv.Itoa(sent.MessageID)
+		}
+	}
+	return externalID, nil
+}
+
+// EditMessage changes the text of the sent message
+func (a *telegramAdapter) EditMessage(req *pb.EditMessageRequest) error {
+	chatID, messageID, err := telegramMessageIDs(req.GetExternalUserId(), req.GetExternalMessageId())
 	if err != nil {
 		return err
 	}
-	b.telegramBots[req.Profile.Id] = bot
-	b.botMap[req.Profile.Id] = "telegram"
-	return nil
+	_, err = a.bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, req.GetMessage().GetText()))
+	return telegramError(err)
 }
 
-func (b *botService) deleteProfileTelegram(req *pb.DeleteProfileRequest) error {
-	if _, err := b.telegramBots[req.Id].RemoveWebhook(); err != nil {
+// DeleteMessage removes the sent message, telegram allows it within 48 hours after sending
+func (a *telegramAdapter) DeleteMessage(req *pb.DeleteMessageRequest) error {
+	chatID, messageID, err := telegramMessageIDs(req.GetExternalUserId(), req.GetExternalMessageId())
+	if err != nil {
 		return err
 	}
-	delete(b.telegramBots, req.Id)
-	delete(b.botMap, req.Id)
-	return nil
+	_, err = a.bot.DeleteMessage(tgbotapi.NewDeleteMessage(chatID, messageID))
+	return telegramError(err)
 }
 
-func (b *botService) sendMessageTelegram(req *pb.SendMessageRequest) error {
-	id, err := strconv.ParseInt(req.ExternalUserId, 10, 64)
+func telegramMessageIDs(externalUserID, externalMessageID string) (int64, int, error) {
+	chatID, err := strconv.ParseInt(externalUserID, 10, 64)
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
-	msg := tgbotapi.NewMessage(id, req.GetMessage().GetText())
-	// msg.ReplyToMessageID = update.Message.MessageID
-	_, err = b.telegramBots[req.ProfileId].Send(msg)
+	messageID, err := strconv.Atoi(externalMessageID)
 	if err != nil {
-		return err
+		return 0, 0, err
+	}
+	return chatID, messageID, nil
+}
+
+// telegramReplyMarkup renders the buttons as the inline keyboard
+// and the quick replies as the one time reply keyboard
+func telegramReplyMarkup(message *pbchat.Message) interface{} {
+	if rows := message.GetButtons(); len(rows) > 0 {
+		keyboard := make([][]tgbotapi.InlineKeyboardButton, 0, len(rows))
+		for _, row := range rows {
+			keyboard = append(keyboard, telegramInlineButtons(row.GetButtons()))
+		}
+		return tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+	}
+	if replies := message.GetQuickReplies(); len(replies) > 0 {
+		keyboard := make([][]tgbotapi.KeyboardButton, 0, len(replies))
+		for _, reply := range replies {
+			keyboard = append(keyboard, tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButton(reply)))
+		}
+		markup := tgbotapi.NewReplyKeyboard(keyboard...)
+		markup.OneTimeKeyboard = true
+		markup.ResizeKeyboard = true
+		return markup
 	}
 	return nil
 }
 
-func (b *botService) TelegramWebhookHandler(w http.ResponseWriter, r *http.Request) {
-	p := strings.TrimPrefix(r.URL.Path, "/telegram/")
-	profileID, err := strconv.ParseInt(p, 10, 64)
-	if err != nil {
-		b.log.Error().Msg(err.Error())
-		return
+// telegramInlineButtons converts the postback buttons into the callback buttons,
+// telegram limits the callback data to 64 bytes, the chat service rejects the longer payloads
+func telegramInlineButtons(buttons []*pbchat.Message_Button) []tgbotapi.InlineKeyboardButton {
+	result := make([]tgbotapi.InlineKeyboardButton, 0, len(buttons))
+	for _, button := range buttons {
+		if button.GetType() == "url" {
+			result = append(result, tgbotapi.NewInlineKeyboardButtonURL(button.GetText(), button.GetUrl()))
+			continue
+		}
+		payload := button.GetPayload()
+		if payload == "" {
+			payload = button.GetText()
+		}
+		result = append(result, tgbotapi.NewInlineKeyboardButtonData(button.GetText(), payload))
+	}
+	return result
+}
+
+// telegramCard sends the card as the photo with the caption or as the text if it has no image
+func telegramCard(chatID int64, card *pbchat.Message_Card) tgbotapi.Chattable {
+	text := card.GetTitle()
+	if subtitle := card.GetSubtitle(); subtitle != "" {
+		text += "\n" + subtitle
+	}
+	var markup interface{}
+	if buttons := card.GetButtons(); len(buttons) > 0 {
+		markup = tgbotapi.NewInlineKeyboardMarkup(telegramInlineButtons(buttons))
+	}
+	if imageURL := card.GetImageUrl(); imageURL != "" {
+		photo := tgbotapi.NewPhotoShare(chatID, imageURL)
+		photo.Caption = text
+		photo.ReplyMarkup = markup
+		return photo
 	}
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = markup
+	return msg
+}
+
+func (a *telegramAdapter) ParseInbound(r *http.Request) ([]*InboundMessage, error) {
 	update := &telegramBody{}
 	if err := json.NewDecoder(r.Body).Decode(update); err != nil {
-		log.Error().Msgf("could not decode request body: %s", err)
-		return
+		return nil, fmt.Errorf("could not decode request body: %s", err)
 	}
-
-	b.log.Debug().
+	if update.CallbackQuery != nil {
+		return a.parseCallbackQuery(update.CallbackQuery)
+	}
+	if update.EditedMessage != nil {
+		return a.parseEditedMessage(update.EditedMessage), nil
+	}
+	// the updates without the message, like the channel posts or the member changes, are not passed to the chat
+	if update.Message.MessageID == 0 {
+		a.log.Debug().Msg("skip telegram update")
+		return nil, nil
+	}
+	a.log.Debug().
 		Int64("id", update.Message.From.ID).
 		Str("username", update.Message.From.Username).
 		Str("first_name", update.Message.From.FirstName).
 		Str("last_name", update.Message.From.LastName).
 		Str("text", update.Message.Text).
-		Msg("receive message")
+		Msg("receive telegram update")
+	messages, err := a.parseMessage(&update.Message)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*InboundMessage, 0, len(messages))
+	for _, m := range messages {
+		// the text or the caption can be edited later, so it keeps the telegram id
+		if m.GetType() == "text" {
+			m.ExternalId = strconv.FormatInt(update.Message.MessageID, 10)
+		}
+		result = append(result, &InboundMessage{
+			ExternalID: strconv.FormatInt(update.Message.Chat.ID, 10),
+			Username:   update.Message.From.Username,
+			Message:    m,
+			Variables: map[string]string{
+				"first_name":    update.Message.From.FirstName,
+				"last_name":     update.Message.From.LastName,
+				"language_code": update.Message.From.LanguageCode,
+			},
+		})
+	}
+	return result, nil
+}
 
-	strChatID := strconv.FormatInt(update.Message.Chat.ID, 10)
+// parseEditedMessage converts the new text or caption of the message,
+// the other changes have no counterpart in the chat
+func (a *telegramAdapter) parseEditedMessage(m *telegramMessage) []*InboundMessage {
+	text := m.Text
+	if text == "" {
+		text = m.Caption
+	}
+	a.log.Debug().
+		Int64("id", m.From.ID).
+		Int64("message_id", m.MessageID).
+		Str("text", text).
+		Msg("receive telegram edited message")
+	if text == "" {
+		return nil
+	}
+	return []*InboundMessage{
+		{
+			ExternalID: strconv.FormatInt(m.Chat.ID, 10),
+			Username:   m.From.Username,
+			Message: &pbchat.Message{
+				Type: "text",
+				Value: &pbchat.Message_Text{
+					Text: text,
+				},
+				ExternalId: strconv.FormatInt(m.MessageID, 10),
+			},
+			Edited: true,
+		},
+	}
+}
 
-	check := &pbchat.CheckSessionRequest{
-		ExternalId: strChatID,
-		ProfileId:  profileID,
-		Username:   update.Message.From.Username,
+// parseCallbackQuery converts the pressed inline button into the postback message
+func (a *telegramAdapter) parseCallbackQuery(query *telegramCallbackQuery) ([]*InboundMessage, error) {
+	a.log.Debug().
+		Int64("id", query.From.ID).
+		Str("username", query.From.Username).
+		Str("data", query.Data).
+		Msg("receive telegram callback query")
+	// stops the progress indicator on the button
+	if _, err := a.bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "")); err != nil {
+		a.log.Warn().Msg(telegramError(err).Error())
 	}
-	resCheck, err := b.client.CheckSession(context.Background(), check)
-	if err != nil {
-		b.log.Error().Msg(err.Error())
-		return
-	}
-	b.log.Debug().
-		Bool("exists", resCheck.Exists).
-		Str("channel_id", resCheck.ChannelId).
-		Int64("client_id", resCheck.ClientId).
-		Msg("check user")
-
-	if !resCheck.Exists {
-		start := &pbchat.StartConversationRequest{
-			User: &pbchat.User{
-				UserId:     resCheck.ClientId,
-				Type:       "telegram",
-				Connection: p,
-				Internal:   false,
+	chatID := query.From.ID
+	text := query.Data
+	if query.Message != nil {
+		chatID = query.Message.Chat.ID
+		if query.Message.ReplyMarkup != nil {
+			for _, row := range query.Message.ReplyMarkup.InlineKeyboard {
+				for _, button := range row {
+					if button.CallbackData != nil && *button.CallbackData == query.Data {
+						text = button.Text
+					}
+				}
+			}
+		}
+	}
+	return []*InboundMessage{
+		{
+			ExternalID: strconv.FormatInt(chatID, 10),
+			Username:   query.From.Username,
+			Message: &pbchat.Message{
+				Type: "postback",
+				Value: &pbchat.Message_Postback_{
+					Postback: &pbchat.Message_Postback{
+						Payload: query.Data,
+						Text:    text,
+					},
+				},
 			},
-			Username: check.Username,
-			DomainId: 1,
+			Variables: map[string]string{
+				"first_name":    query.From.FirstName,
+				"last_name":     query.From.LastName,
+				"language_code": query.From.LanguageCode,
+			},
+		},
+	}, nil
+}
+
+// parseMessage converts telegram update into chat messages.
+// Media attachments are passed as direct download urls, the chat server uploads them into the storage
+// and replaces the url, which carries the bot token, with the storage one.
+// Caption is sent as a separate text message.
+func (a *telegramAdapter) parseMessage(m *telegramMessage) ([]*pbchat.Message, error) {
+	var file *pbchat.Message_File
+	var fileID string
+	switch {
+	case len(m.Photo) > 0:
+		fileID = m.Photo[len(m.Photo)-1].FileID
+		file = &pbchat.Message_File{
+			MimeType: "image/jpeg",
 		}
-		_, err := b.client.StartConversation(context.Background(), start)
-		if err != nil {
-			b.log.Error().Msg(err.Error())
-			return
-		}
-		// if update.Message.Text != "/start" {
-		// 	textMessage := &pbchat.Message{
-		// 		Type: "text",
-		// 		Value: &pbchat.Message_TextMessage_{
-		// 			TextMessage: &pbchat.Message_TextMessage{
-		// 				Text: update.Message.Text,
-		// 			},
-		// 		},
-		// 	}
-		// 	message := &pbchat.SendMessageRequest{
-		// 		Message:   textMessage,
-		// 		ChannelId: resStart.ChannelId,
-		// 		FromFlow:  false,
-		// 	}
-		// 	_, err = b.client.SendMessage(context.Background(), message)
-		// 	if err != nil {
-		// 		b.log.Error().Msg(err.Error())
-		// 	}
-		// }
-	} else {
-		message := &pbchat.SendMessageRequest{
-			// Message:   textMessage,
-			ChannelId: resCheck.ChannelId,
-			FromFlow:  false,
-		}
-		// if update.Message.Photo != nil {
-		// 	fileURL, err := b.telegramBots[profileID].GetFileDirectURL(
-		// 		update.Message.Photo[len(update.Message.Photo)-1].FileID,
-		// 	)
-		// 	if err != nil {
-		// 		log.Error().Msg(err.Error())
-		// 		return
-		// 	}
-		// 	fileRes, err := http.Get(fileURL)
-		// 	if err != nil {
-		// 		log.Error().Msg(err.Error())
-		// 		return
-		// 	}
-		// 	defer fileRes.Body.Close()
-		// 	if fileRes.StatusCode != 200 {
-		// 		log.Error().Int("status", fileRes.StatusCode).Msgf("failed to download image")
-		// 		return
-		// 	}
-		// 	f, err := ioutil.ReadAll(fileRes.Body)
-		// 	// m, _, err := image.Decode(fileRes.Body)
-		// 	// if err != nil {
-		// 	// 	log.Error().Msg(err.Error())
-		// 	// 	return
-		// 	// }
-		// 	fileMessage := &pbchat.Message{
-		// 		Type: "text",
-		// 		Value: &pbchat.Message_Text{
-		// 			Text: update.Message.Text,
-		// 		},
-		// 	}
-		// } else {
-		textMessage := &pbchat.Message{
+	case m.Document != nil:
+		fileID = m.Document.FileID
+		file = &pbchat.Message_File{
+			MimeType: m.Document.MimeType,
+			Name:     m.Document.FileName,
+		}
+	case m.Voice != nil:
+		fileID = m.Voice.FileID
+		file = &pbchat.Message_File{
+			MimeType: m.Voice.MimeType,
+		}
+	case m.Audio != nil:
+		fileID = m.Audio.FileID
+		file = &pbchat.Message_File{
+			MimeType: m.Audio.MimeType,
+			Name:     m.Audio.FileName,
+		}
+	case m.Video != nil:
+		fileID = m.Video.FileID
+		file = &pbchat.Message_File{
+			MimeType: m.Video.MimeType,
+			Name:     m.Video.FileName,
+		}
+	case m.Sticker != nil:
+		fileID = m.Sticker.FileID
+		file = &pbchat.Message_File{
+			MimeType: "image/webp",
+		}
+		if m.Sticker.IsAnimated {
+			file.MimeType = "application/x-tgsticker"
+		}
+	case m.Location != nil:
+		return []*pbchat.Message{
+			{
+				Type: "text",
+				Value: &pbchat.Message_Text{
+					Text: fmt.Sprintf(locationURL, m.Location.Latitude, m.Location.Longitude),
+				},
+			},
+		}, nil
+	default:
+		return []*pbchat.Message{
+			{
+				Type: "text",
+				Value: &pbchat.Message_Text{
+					Text: m.Text,
+				},
+			},
+		}, nil
+	}
+	fileURL, err := a.bot.GetFileDirectURL(fileID)
+	if err != nil {
+		return nil, telegramError(err)
+	}
+	file.Url = fileURL
+	messages := []*pbchat.Message{
+		{
+			Type: "file",
+			Value: &pbchat.Message_File_{
+				File: file,
+			},
+		},
+	}
+	if caption := m.Caption; caption != "" {
+		messages = append(messages, &pbchat.Message{
 			Type: "text",
 			Value: &pbchat.Message_Text{
-				Text: update.Message.Text,
+				Text: caption,
 			},
-		}
-		message.Message = textMessage
-		// }
+		})
+	}
+	return messages, nil
+}
 
-		_, err := b.client.SendMessage(context.Background(), message)
-		if err != nil {
-			b.log.Error().Msg(err.Error())
-		}
+// telegramError drops the request url from the error of the telegram api call,
+// the url carries the bot token, so the token left in the wrapped errors is masked as well
+func telegramError(err error) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = fmt.Errorf("telegram %s request failed: %s", strings.ToLower(urlErr.Op), urlErr.Err)
+	}
+	if !botTokenPattern.MatchString(err.Error()) {
+		return err
 	}
+	return errors.New(botTokenPattern.ReplaceAllString(err.Error(), "bot<token>"))
 }
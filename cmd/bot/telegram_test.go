@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestTelegramError(t *testing.T) {
+	const apiURL = "https://api.telegram.org/bot123456:AAE-secret_token/sendMessage"
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{
+			name: "url error",
+			err: &url.Error{
+				Op:  "Post",
+				URL: apiURL,
+				Err: fmt.Errorf("connection refused"),
+			},
+		},
+		{
+			name: "url in the wrapped error",
+			err: &url.Error{
+				Op:  "Post",
+				URL: apiURL,
+				Err: fmt.Errorf("redirect to %s failed", apiURL),
+			},
+		},
+		{
+			name: "url in the other error",
+			err:  fmt.Errorf("request %s failed", apiURL),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := telegramError(test.err)
+			if strings.Contains(err.Error(), "secret_token") {
+				t.Errorf("bot token is not redacted: %v", err)
+			}
+		})
+	}
+}
@@ -1 +1,470 @@
 package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	pb "github.com/matvoy/chat_server/api/proto/bot"
+	pbchat "github.com/matvoy/chat_server/api/proto/chat"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	viberAPI             = "https://chatapi.viber.com/pa"
+	viberSetWebhookRoute = "set_webhook"
+	viberSendRoute       = "send_message"
+	viberTokenHeader     = "X-Viber-Auth-Token"
+	viberSignatureHeader = "X-Viber-Content-Signature"
+	// viberKeyboardColumns is the width of the keyboard row
+	viberKeyboardColumns = 6
+	// viberPictureTextSize is the limit of the picture description
+	viberPictureTextSize = 120
+)
+
+func init() {
+	RegisterAdapter("viber", "viber", NewViberAdapter)
+}
+
+type ViberSetWebhookRequest struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types,omitempty"`
+	SendName   bool     `json:"send_name,omitempty"`
+}
+
+type ViberResponse struct {
+	Status        int64  `json:"status"`
+	StatusMessage string `json:"status_message"`
+	MessageToken  int64  `json:"message_token,omitempty"`
+}
+
+type ViberSender struct {
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name"`
+	Avatar   string `json:"avatar,omitempty"`
+	Language string `json:"language,omitempty"`
+	Country  string `json:"country,omitempty"`
+}
+
+type ViberLocation struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+type ViberMessage struct {
+	Type     string         `json:"type"`
+	Text     string         `json:"text,omitempty"`
+	Media    string         `json:"media,omitempty"`
+	FileName string         `json:"file_name,omitempty"`
+	Size     int64          `json:"size,omitempty"`
+	Location *ViberLocation `json:"location,omitempty"`
+	// TrackingData of the sent message is returned with the reply of the user
+	TrackingData string `json:"tracking_data,omitempty"`
+}
+
+type ViberButton struct {
+	Columns    int    `json:"Columns"`
+	Rows       int    `json:"Rows"`
+	ActionType string `json:"ActionType"`
+	ActionBody string `json:"ActionBody"`
+	Text       string `json:"Text"`
+}
+
+type ViberKeyboard struct {
+	Type          string         `json:"Type"`
+	DefaultHeight bool           `json:"DefaultHeight"`
+	Buttons       []*ViberButton `json:"Buttons"`
+}
+
+type ViberSendMessageRequest struct {
+	Receiver string         `json:"receiver"`
+	Sender   *ViberSender   `json:"sender"`
+	Keyboard *ViberKeyboard `json:"keyboard,omitempty"`
+	ViberMessage
+}
+
+type ViberBody struct {
+	Event        string        `json:"event"`
+	Timestamp    int64         `json:"timestamp"`
+	MessageToken int64         `json:"message_token"`
+	Sender       *ViberSender  `json:"sender"`
+	Message      *ViberMessage `json:"message"`
+	// UserID and Desc are set in the delivery callbacks
+	UserID string `json:"user_id"`
+	Desc   string `json:"desc"`
+}
+
+// viberStatuses maps the delivery callbacks to the message statuses
+var viberStatuses = map[string]string{
+	"delivered": "delivered",
+	"seen":      "read",
+	"failed":    "failed",
+}
+
+type viberAdapter struct {
+	log   *zerolog.Logger
+	token string
+	name  string
+}
+
+func NewViberAdapter(log *zerolog.Logger, client pbchat.ChatService) ChannelAdapter {
+	return &viberAdapter{
+		log: log,
+	}
+}
+
+func (a *viberAdapter) Configure(profile *pbchat.Profile) error {
+	token, ok := profile.Variables["token"]
+	if !ok {
+		return errors.New("token not found")
+	}
+	name, ok := profile.Variables["name"]
+	if !ok {
+		name = profile.Name
+	}
+	a.token = token
+	a.name = name
+	return nil
+}
+
+// RegisterWebhook sets the viber webhook.
+// Viber checks the webhook url while setting it, so the webhook server must be already listening.
+func (a *viberAdapter) RegisterWebhook(url string) error {
+	_, err := a.request(viberSetWebhookRoute, &ViberSetWebhookRequest{
+		URL:        url,
+		EventTypes: []string{"delivered", "seen", "failed", "subscribed", "unsubscribed", "conversation_started"},
+		SendName:   true,
+	})
+	return err
+}
+
+func (a *viberAdapter) Teardown() error {
+	_, err := a.request(viberSetWebhookRoute, &ViberSetWebhookRequest{
+		URL: "",
+	})
+	return err
+}
+
+func (a *viberAdapter) request(route string, body interface{}) (*ViberResponse, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/%s", viberAPI, route), bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(viberTokenHeader, a.token)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	viberRes := &ViberResponse{}
+	if err := json.NewDecoder(res.Body).Decode(viberRes); err != nil {
+		return nil, err
+	}
+	if viberRes.Status != 0 {
+		return nil, fmt.Errorf("viber %s failed: %s", route, viberRes.StatusMessage)
+	}
+	return viberRes, nil
+}
+
+// Send renders the buttons and the quick replies as the keyboard,
+// viber has no carousel in the basic messages, so the cards are sent one by one
+func (a *viberAdapter) Send(req *pb.SendMessageRequest) (string, error) {
+	message := req.GetMessage()
+	// the token of the first sent message identifies the chat message in viber
+	var externalID string
+	if message.GetFile() != nil || message.GetText() != "" || len(message.GetCards()) == 0 {
+		msg, err := a.newMessage(req.ExternalUserId, message)
+		if err != nil {
+			return "", err
+		}
+		if externalID, err = a.send(msg); err != nil {
+			return "", err
+		}
+	}
+	for _, card := range message.GetCards() {
+		id, err := a.send(a.newCard(req.ExternalUserId, card))
+		if err != nil {
+			return "", err
+		}
+		if externalID == "" {
+			externalID = id
+		}
+	}
+	return externalID, nil
+}
+
+func (a *viberAdapter) send(message *ViberSendMessageRequest) (string, error) {
+	res, err := a.request(viberSendRoute, message)
+	if err != nil || res.MessageToken == 0 {
+		return "", err
+	}
+	return strconv.FormatInt(res.MessageToken, 10), nil
+}
+
+func (a *viberAdapter) newMessage(receiver string, msg *pbchat.Message) (*ViberSendMessageRequest, error) {
+	message := &ViberSendMessageRequest{
+		Receiver: receiver,
+		Sender: &ViberSender{
+			Name: a.name,
+		},
+	}
+	rows := make([][]*pbchat.Message_Button, 0, len(msg.GetButtons()))
+	for _, row := range msg.GetButtons() {
+		rows = append(rows, row.GetButtons())
+	}
+	message.Keyboard, message.TrackingData = viberKeyboard(rows, msg.GetQuickReplies())
+	if file := msg.GetFile(); file != nil {
+		message.Media = file.GetUrl()
+		switch mime := file.GetMimeType(); {
+		case strings.HasPrefix(mime, "image/"):
+			message.Type = "picture"
+		case strings.HasPrefix(mime, "video/"):
+			message.Type = "video"
+		default:
+			message.Type = "file"
+			message.FileName = file.GetName()
+			if message.FileName == "" {
+				message.FileName = strconv.FormatInt(file.GetId(), 10)
+			}
+		}
+		if message.Type != "picture" {
+			size, err := viberFileSize(file.GetUrl())
+			if err != nil {
+				return nil, err
+			}
+			message.Size = size
+		}
+	} else {
+		message.Type = "text"
+		message.Text = msg.GetText()
+	}
+	return message, nil
+}
+
+// newCard sends the card as the picture with the description or as the text if it has no image
+func (a *viberAdapter) newCard(receiver string, card *pbchat.Message_Card) *ViberSendMessageRequest {
+	text := card.GetTitle()
+	if subtitle := card.GetSubtitle(); subtitle != "" {
+		text += "\n" + subtitle
+	}
+	message := &ViberSendMessageRequest{
+		Receiver: receiver,
+		Sender: &ViberSender{
+			Name: a.name,
+		},
+	}
+	message.Keyboard, message.TrackingData = viberKeyboard([][]*pbchat.Message_Button{card.GetButtons()}, nil)
+	imageURL := card.GetImageUrl()
+	if imageURL != "" && len(text) <= viberPictureTextSize {
+		message.Type = "picture"
+		message.Media = imageURL
+		message.Text = text
+		return message
+	}
+	// the long description does not fit the picture, the image is sent as the link
+	if imageURL != "" {
+		text += "\n" + imageURL
+	}
+	message.Type = "text"
+	message.Text = text
+	return message
+}
+
+// viberKeyboard converts the button rows and the quick replies into the reply buttons.
+// Viber returns the pressed button as the text message, so the payloads of the postback buttons
+// are kept in the tracking data to tell the postback from the typed text.
+func viberKeyboard(rows [][]*pbchat.Message_Button, quickReplies []string) (*ViberKeyboard, string) {
+	keyboard := &ViberKeyboard{
+		Type: "keyboard",
+	}
+	postbacks := make(map[string]string)
+	for _, row := range rows {
+		if len(row) == 0 {
+			continue
+		}
+		// the wider rows are wrapped by viber
+		columns := 1
+		if len(row) <= viberKeyboardColumns {
+			columns = viberKeyboardColumns / len(row)
+		}
+		for _, button := range row {
+			if button.GetType() == "url" {
+				keyboard.Buttons = append(keyboard.Buttons, &ViberButton{columns, 1, "open-url", button.GetUrl(), button.GetText()})
+				continue
+			}
+			payload := button.GetPayload()
+			if payload == "" {
+				payload = button.GetText()
+			}
+			postbacks[payload] = button.GetText()
+			keyboard.Buttons = append(keyboard.Buttons, &ViberButton{columns, 1, "reply", payload, button.GetText()})
+		}
+	}
+	for _, reply := range quickReplies {
+		keyboard.Buttons = append(keyboard.Buttons, &ViberButton{viberKeyboardColumns, 1, "reply", reply, reply})
+	}
+	if len(keyboard.Buttons) == 0 {
+		return nil, ""
+	}
+	if len(postbacks) == 0 {
+		return keyboard, ""
+	}
+	trackingData, err := json.Marshal(postbacks)
+	if err != nil {
+		return keyboard, ""
+	}
+	return keyboard, string(trackingData)
+}
+
+func (a *viberAdapter) ParseInbound(r *http.Request) ([]*InboundMessage, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if !checkViberSignature(a.token, body, r.Header.Get(viberSignatureHeader)) {
+		return nil, errors.New("invalid viber signature")
+	}
+	update := &ViberBody{}
+	if err := json.Unmarshal(body, update); err != nil {
+		return nil, fmt.Errorf("could not decode request body: %s", err)
+	}
+	if status, ok := viberStatuses[update.Event]; ok {
+		return []*InboundMessage{
+			{
+				ExternalID: update.UserID,
+				Status: &MessageStatus{
+					ExternalMessageID: strconv.FormatInt(update.MessageToken, 10),
+					Status:            status,
+					Cause:             update.Desc,
+				},
+			},
+		}, nil
+	}
+	if update.Event != "message" || update.Sender == nil || update.Message == nil {
+		a.log.Debug().
+			Str("event", update.Event).
+			Msg("skip viber event")
+		return nil, nil
+	}
+	return []*InboundMessage{
+		{
+			ExternalID: update.Sender.ID,
+			Username:   update.Sender.Name,
+			Message:    parseViberMessage(update.Message),
+			Variables: map[string]string{
+				"avatar":   update.Sender.Avatar,
+				"language": update.Sender.Language,
+				"country":  update.Sender.Country,
+			},
+		},
+	}, nil
+}
+
+// viberFileSize returns the size of the file, viber requires it for video and file messages
+func viberFileSize(url string) (int64, error) {
+	res, err := http.Head(url)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+	if res.ContentLength <= 0 {
+		return 0, errors.New("unknown file size")
+	}
+	return res.ContentLength, nil
+}
+
+func parseViberMessage(message *ViberMessage) *pbchat.Message {
+	file := &pbchat.Message_File{
+		Url:  message.Media,
+		Name: message.FileName,
+	}
+	switch message.Type {
+	case "picture":
+		file.MimeType = "image/jpeg"
+	case "video":
+		file.MimeType = "video/mp4"
+	case "sticker":
+		file.MimeType = "image/png"
+	case "file":
+		file.MimeType = mime.TypeByExtension(path.Ext(message.FileName))
+	case "location":
+		return &pbchat.Message{
+			Type: "text",
+			Value: &pbchat.Message_Text{
+				Text: fmt.Sprintf(locationURL, message.Location.Lat, message.Location.Lon),
+			},
+		}
+	default:
+		if postback := parseViberPostback(message); postback != nil {
+			return &pbchat.Message{
+				Type: "postback",
+				Value: &pbchat.Message_Postback_{
+					Postback: postback,
+				},
+			}
+		}
+		text := message.Text
+		if text == "" {
+			text = message.Media
+		}
+		return &pbchat.Message{
+			Type: "text",
+			Value: &pbchat.Message_Text{
+				Text: text,
+			},
+		}
+	}
+	return &pbchat.Message{
+		Type: "file",
+		Value: &pbchat.Message_File_{
+			File: file,
+		},
+	}
+}
+
+// parseViberPostback finds the pressed postback button in the tracking data of the replied message
+func parseViberPostback(message *ViberMessage) *pbchat.Message_Postback {
+	if message.Type != "text" || message.TrackingData == "" {
+		return nil
+	}
+	postbacks := make(map[string]string)
+	if err := json.Unmarshal([]byte(message.TrackingData), &postbacks); err != nil {
+		return nil
+	}
+	text, ok := postbacks[message.Text]
+	if !ok {
+		return nil
+	}
+	return &pbchat.Message_Postback{
+		Payload: message.Text,
+		Text:    text,
+	}
+}
+
+func checkViberSignature(token string, body []byte, signature string) bool {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+	actual, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(expected, actual)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func viberSignature(token string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestCheckViberSignature(t *testing.T) {
+	const token = "viber-token"
+	body := []byte(`{"event":"message","message_token":1}`)
+	tests := []struct {
+		name      string
+		body      []byte
+		signature string
+		valid     bool
+	}{
+		{
+			name:      "valid signature",
+			body:      body,
+			signature: viberSignature(token, body),
+			valid:     true,
+		},
+		{
+			name:      "changed body",
+			body:      []byte(`{"event":"message","message_token":2}`),
+			signature: viberSignature(token, body),
+		},
+		{
+			name:      "other token",
+			body:      body,
+			signature: viberSignature("other-token", body),
+		},
+		{
+			name:      "not hex signature",
+			body:      body,
+			signature: "signature",
+		},
+		{
+			name: "no signature",
+			body: body,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if valid := checkViberSignature(token, test.body, test.signature); valid != test.valid {
+				t.Errorf("expected %v, got %v", test.valid, valid)
+			}
+		})
+	}
+}
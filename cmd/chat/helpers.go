@@ -2,31 +2,366 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	pb "github.com/matvoy/chat_server/api/proto/chat"
+	pbstorage "github.com/matvoy/chat_server/api/proto/storage"
+	"github.com/matvoy/chat_server/internal/auth"
 	pg "github.com/matvoy/chat_server/internal/repo/sqlx"
 
+	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/micro/go-micro/v2/errors"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 )
 
-func (s *chatService) closeConversation(ctx context.Context, conversationID *string) error {
-	if err := s.repo.WithTransaction(func(tx *sqlx.Tx) error {
-		if err := s.repo.CloseConversationTx(ctx, tx, *conversationID); err != nil {
-			return err
+const (
+	fileChunkSize   = 64 * 1024
+	fileDownloadURL = "%s/any/file/%v/download?domain_id=%v" // storage url, file id, domain id
+	fileMaxSize     = 64 * 1024 * 1024
+	fileTimeout     = time.Minute
+	// buttonPayloadMaxSize is the limit of the telegram callback data, the smallest of the messengers
+	buttonPayloadMaxSize = 64
+)
+
+var fileClient = &http.Client{
+	Timeout: fileTimeout,
+}
+
+// authorizeService allows the request only for the trusted services: flow and bot
+func authorizeService(user *auth.User) error {
+	if !user.Service {
+		return errors.Forbidden("access denied", "")
+	}
+	return nil
+}
+
+// validatePage rejects the negative page size and number, zero selects the default
+func validatePage(size, page int32) error {
+	if size < 0 || page < 0 {
+		return errors.BadRequest("invalid page", "")
+	}
+	return nil
+}
+
+// authorizeFileURL allows to send a file by the url only for the trusted services and the allowed hosts,
+// the agents upload the files to the storage and send the file id
+func authorizeFileURL(user *auth.User, file *pb.Message_File) error {
+	if user.Service {
+		return nil
+	}
+	fileURL, err := url.Parse(file.GetUrl())
+	if err != nil || (fileURL.Scheme != "http" && fileURL.Scheme != "https") {
+		return errors.BadRequest("invalid file url", "")
+	}
+	for _, host := range cfg.FileURLHosts {
+		if fileURL.Hostname() == host {
+			return nil
 		}
-		if err := s.repo.CloseChannelsTx(ctx, tx, *conversationID); err != nil {
-			return err
+	}
+	return errors.BadRequest("file url not allowed, upload the file to the storage", "")
+}
+
+// authorizeChannel checks that the agent owns the channel, the trusted services may use any channel
+func authorizeChannel(user *auth.User, channel *pg.Channel) error {
+	if user.Service {
+		return nil
+	}
+	if !channel.Internal || channel.UserID != user.ID || !user.InDomain(channel.DomainID) {
+		return errors.Forbidden("access denied", "")
+	}
+	return nil
+}
+
+// authorizeInvite checks that the invite is addressed to the agent
+func authorizeInvite(user *auth.User, invite *pg.Invite) error {
+	if user.Service {
+		return nil
+	}
+	if invite.UserID != user.ID || !user.InDomain(invite.DomainID) {
+		return errors.Forbidden("access denied", "")
+	}
+	return nil
+}
+
+// authorizeConversation checks that the agent is or was a member of the conversation
+func authorizeConversation(user *auth.User, conversation *pb.Conversation) error {
+	if user.Service {
+		return nil
+	}
+	if !user.InDomain(conversation.GetDomainId()) {
+		return errors.Forbidden("access denied", "")
+	}
+	for _, member := range conversation.GetMembers() {
+		if member.GetInternal() && member.GetUserId() == user.ID {
+			return nil
 		}
+	}
+	return errors.Forbidden("access denied", "")
+}
+
+// getAuthoredMessage loads the message sent from the open channel of the user,
+// found by id or by the id in the external messenger of the channel
+func (s *chatService) getAuthoredMessage(ctx context.Context, user *auth.User, channelID string, id int64, externalID string) (*pg.Channel, *pg.Message, error) {
+	channel, err := s.repo.GetChannelByID(ctx, channelID)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return nil, nil, err
+	}
+	if channel == nil {
+		s.log.Warn().Msg("channel not found")
+		return nil, nil, errors.BadRequest("channel not found", "")
+	}
+	if err := authorizeChannel(user, channel); err != nil {
+		s.log.Warn().Msg(err.Error())
+		return nil, nil, err
+	}
+	if channel.ClosedAt.Valid {
+		s.log.Warn().Msg("channel closed")
+		return nil, nil, errors.BadRequest("channel closed", "")
+	}
+	var message *pg.Message
+	switch {
+	case id != 0:
+		message, err = s.repo.GetMessageByID(ctx, id)
+	case externalID != "":
+		message, err = s.repo.GetMessageByExternalID(ctx, channel.ID, externalID)
+	}
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return nil, nil, err
+	}
+	if message == nil || message.DeletedAt.Valid {
+		s.log.Warn().Msg("message not found")
+		return nil, nil, errors.BadRequest("message not found", "")
+	}
+	if message.ChannelID.String != channel.ID {
+		s.log.Warn().Msg("message of another channel")
+		return nil, nil, errors.Forbidden("access denied", "")
+	}
+	return channel, message, nil
+}
+
+// getWebhook loads the webhook of the user domain
+func (s *chatService) getWebhook(ctx context.Context, user *auth.User, id int64) (*pg.Webhook, error) {
+	webhook, err := s.repo.GetWebhookByID(ctx, id)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return nil, err
+	} else if webhook == nil || !user.InDomain(webhook.DomainID) {
+		return nil, errors.BadRequest("webhook not found", "")
+	}
+	return webhook, nil
+}
+
+func validateWebhook(webhook *pb.Webhook) error {
+	target, err := url.Parse(webhook.GetUrl())
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return errors.BadRequest("invalid webhook url", "")
+	}
+	// the resolved addresses are checked when the dispatcher connects
+	host := target.Hostname()
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && !isPublicIP(ip)) {
+		return errors.BadRequest("webhook address is not allowed", "")
+	}
+	return nil
+}
+
+// newWebhookSecret generates the random secret signing the webhook requests
+func newWebhookSecret() string {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return uuid.New().String()
+	}
+	return hex.EncodeToString(secret)
+}
+
+// profileCredentials are the profile variables of the channel adapters which are not passed to the flow
+var profileCredentials = map[string]bool{
+	"token":        true,
+	"api_key":      true,
+	"url":          true,
+	"scenario_key": true,
+}
+
+// conversationVariables collects the variables passed to the flow of the external user:
+// the custom attributes of the channel adapter, the profile variables except the credentials
+// and the channel metadata, the latter win
+func (s *chatService) conversationVariables(ctx context.Context, req *pb.StartConversationRequest, profileID int64) (map[string]string, error) {
+	variables := make(map[string]string, len(req.GetVariables())+4)
+	for key, value := range req.GetVariables() {
+		variables[key] = value
+	}
+	profile, err := s.repo.GetProfileByID(ctx, profileID)
+	if err != nil {
+		return nil, err
+	}
+	if profile != nil && len(profile.Variables) > 0 {
+		profileVariables := make(map[string]string)
+		if err := profile.Variables.Unmarshal(&profileVariables); err != nil {
+			return nil, err
+		}
+		for key, value := range profileVariables {
+			if profileCredentials[key] {
+				continue
+			}
+			variables[key] = value
+		}
+	}
+	client, err := s.repo.GetClientByID(ctx, req.GetUser().GetUserId())
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		variables["external_id"] = client.ExternalID.String
+	}
+	variables["username"] = req.GetUsername()
+	variables["channel_type"] = req.GetUser().GetType()
+	variables["profile_id"] = strconv.FormatInt(profileID, 10)
+	return variables, nil
+}
+
+func (s *chatService) closeConversationTx(ctx context.Context, tx *sqlx.Tx, conversationID string) error {
+	if err := s.repo.CloseConversationTx(ctx, tx, conversationID); err != nil {
+		return err
+	}
+	return s.repo.CloseChannelsTx(ctx, tx, conversationID)
+}
+
+// storeFile points the url of the file to the storage. The file without the id is uploaded,
+// the url of the file with the id is built from it, so the caller cannot send its own url.
+func (s *chatService) storeFile(ctx context.Context, user *auth.User, domainID int64, file *pb.Message_File) error {
+	if file.GetId() != 0 {
+		file.Url = fileStorageURL(file.GetId(), domainID)
 		return nil
+	}
+	if err := authorizeFileURL(user, file); err != nil {
+		return err
+	}
+	return s.uploadFile(ctx, domainID, file)
+}
+
+func fileStorageURL(fileID, domainID int64) string {
+	return fmt.Sprintf(fileDownloadURL, cfg.StorageURL, fileID, domainID)
+}
+
+// uploadFile streams the file found by file.Url into the storage service
+// and replaces the file id and url with the stored ones.
+func (s *chatService) uploadFile(ctx context.Context, domainID int64, file *pb.Message_File) error {
+	if file.GetUrl() == "" {
+		return fmt.Errorf("file url not found")
+	}
+	// the cancel aborts the download and the upload stream on the early returns,
+	// so the storage does not keep the partial file
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	fileReq, err := http.NewRequestWithContext(ctx, http.MethodGet, file.GetUrl(), nil)
+	if err != nil {
+		return downloadError(file.GetUrl(), err)
+	}
+	fileRes, err := fileClient.Do(fileReq)
+	if err != nil {
+		return downloadError(file.GetUrl(), err)
+	}
+	defer fileRes.Body.Close()
+	if fileRes.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download file. status: %v", fileRes.StatusCode)
+	}
+	if fileRes.ContentLength > fileMaxSize {
+		return fmt.Errorf("file is too large. size: %v", fileRes.ContentLength)
+	}
+	// one byte over the limit tells the file is too large
+	body := io.LimitReader(fileRes.Body, fileMaxSize+1)
+	size := 0
+	if file.MimeType == "" {
+		file.MimeType = fileRes.Header.Get("Content-Type")
+	}
+	if file.Name == "" {
+		file.Name = uuid.New().String()
+	}
+	stream, err := s.storageClient.UploadFile(ctx)
+	if err != nil {
+		return err
+	}
+	closed := false
+	defer func() {
+		if !closed {
+			stream.Close()
+		}
+	}()
+	if err := stream.Send(&pbstorage.UploadFileRequest{
+		Data: &pbstorage.UploadFileRequest_Metadata_{
+			Metadata: &pbstorage.UploadFileRequest_Metadata{
+				DomainId: domainID,
+				Name:     file.Name,
+				MimeType: file.MimeType,
+				Uuid:     uuid.New().String(),
+			},
+		},
 	}); err != nil {
-		s.log.Error().Msg(err.Error())
 		return err
 	}
+	buf := make([]byte, fileChunkSize)
+	for {
+		n, err := body.Read(buf)
+		if size += n; size > fileMaxSize {
+			return fmt.Errorf("file is too large. max size: %v", fileMaxSize)
+		}
+		if n > 0 {
+			chunk := make([]byte, n)
+			copy(chunk, buf[:n])
+			if err := stream.Send(&pbstorage.UploadFileRequest{
+				Data: &pbstorage.UploadFileRequest_Chunk{
+					Chunk: chunk,
+				},
+			}); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	closed = true
+	if err := stream.Close(); err != nil {
+		return err
+	}
+	res := &pbstorage.UploadFileResponse{}
+	if err := stream.RecvMsg(res); err != nil {
+		return err
+	}
+	if res.GetCode() != pbstorage.UploadFileResponse_Ok {
+		return fmt.Errorf("failed to upload file. code: %s", res.GetCode().String())
+	}
+	file.Id = res.GetFileId()
+	file.Url = fileStorageURL(file.Id, domainID)
 	return nil
 }
 
+// downloadError drops the file url from the error, the urls of the messengers may carry the credentials
+func downloadError(fileURL string, err error) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	return fmt.Errorf("failed to download file: %s", strings.ReplaceAll(err.Error(), fileURL, "<file url>"))
+}
+
 func transformProfileFromRepoModel(profile *pg.Profile) (*pb.Profile, error) {
 	variableBytes, err := profile.Variables.MarshalJSON()
 	variables := make(map[string]string)
@@ -35,12 +370,14 @@ func transformProfileFromRepoModel(profile *pg.Profile) (*pb.Profile, error) {
 		return nil, err
 	}
 	result := &pb.Profile{
-		Id:        profile.ID,
-		Name:      profile.Name,
-		Type:      profile.Type,
-		DomainId:  profile.DomainID,
-		SchemaId:  profile.SchemaID.Int64,
-		Variables: variables,
+		Id:             profile.ID,
+		Name:           profile.Name,
+		Type:           profile.Type,
+		DomainId:       profile.DomainID,
+		SchemaId:       profile.SchemaID.Int64,
+		Variables:      variables,
+		IdleTimeoutSec: profile.IdleTimeoutSec,
+		ClosingMessage: profile.ClosingMessage,
 	}
 	return result, nil
 }
@@ -55,6 +392,8 @@ func transformProfileToRepoModel(profile *pb.Profile) (*pg.Profile, error) {
 			profile.SchemaId,
 			true,
 		},
+		IdleTimeoutSec: profile.IdleTimeoutSec,
+		ClosingMessage: profile.ClosingMessage,
 	}
 	result.Variables.Scan(profile.Variables)
 	return result, nil
@@ -74,7 +413,7 @@ func transformProfilesFromRepoModel(profiles []*pg.Profile) ([]*pb.Profile, erro
 	return result, nil
 }
 
-func (s *chatService) createClient(ctx context.Context, req *pb.CheckSessionRequest) (client *pg.Client, err error) {
+func (s *chatService) createClient(ctx context.Context, req *pb.CheckSessionRequest, channelType string) (client *pg.Client, err error) {
 	client = &pg.Client{
 		ExternalID: sql.NullString{
 			req.ExternalId,
@@ -84,6 +423,14 @@ func (s *chatService) createClient(ctx context.Context, req *pb.CheckSessionRequ
 			req.Username,
 			true,
 		},
+		Type: sql.NullString{
+			channelType,
+			true,
+		},
+		ProfileID: sql.NullInt64{
+			req.ProfileId,
+			true,
+		},
 	}
 	err = s.repo.CreateClient(ctx, client)
 	return
@@ -130,7 +477,147 @@ func (s *chatService) createClient(ctx context.Context, req *pb.CheckSessionRequ
 // 	return result
 // }
 
+// validateMessage checks the payloads of the postback buttons fit every messenger
+func validateMessage(message *pb.Message) error {
+	buttons := []*pb.Message_Button{}
+	for _, row := range message.GetButtons() {
+		buttons = append(buttons, row.GetButtons()...)
+	}
+	for _, card := range message.GetCards() {
+		buttons = append(buttons, card.GetButtons()...)
+	}
+	for _, button := range buttons {
+		if button.GetType() == "url" {
+			continue
+		}
+		payload := button.GetPayload()
+		if payload == "" {
+			payload = button.GetText()
+		}
+		if len(payload) > buttonPayloadMaxSize {
+			return errors.BadRequest(fmt.Sprintf("button payload is longer than %v bytes", buttonPayloadMaxSize), "")
+		}
+	}
+	return nil
+}
+
+func transformMessageToRepoModel(message *pb.Message) *pg.Message {
+	file := message.GetFile()
+	if file == nil {
+		result := &pg.Message{
+			Type: "text",
+			Text: sql.NullString{
+				message.GetText(),
+				true,
+			},
+			Interactive: transformInteractiveToRepoModel(message),
+		}
+		if postback := message.GetPostback(); postback != nil {
+			result.Type = "postback"
+			result.Text.String = postback.GetText()
+		}
+		return result
+	}
+	result := &pg.Message{
+		Type: "file",
+		FileID: sql.NullInt64{
+			file.Id,
+			true,
+		},
+		FileURL: sql.NullString{
+			file.Url,
+			true,
+		},
+		FileMimeType: sql.NullString{
+			file.MimeType,
+			true,
+		},
+		Interactive: transformInteractiveToRepoModel(message),
+	}
+	if file.Name != "" {
+		result.FileName = sql.NullString{
+			file.Name,
+			true,
+		}
+	}
+	return result
+}
+
+// transformInteractiveToRepoModel keeps the buttons, quick replies, cards and postback of the message
+// in the protobuf json mapping, it is null for the plain messages
+func transformInteractiveToRepoModel(message *pb.Message) types.NullJSONText {
+	interactive := &pb.Message{
+		Buttons:      message.GetButtons(),
+		QuickReplies: message.GetQuickReplies(),
+		Cards:        message.GetCards(),
+	}
+	if postback := message.GetPostback(); postback != nil {
+		interactive.Value = &pb.Message_Postback_{
+			Postback: postback,
+		}
+	}
+	if proto.Size(interactive) == 0 {
+		return types.NullJSONText{}
+	}
+	data, err := protojson.Marshal(interactive)
+	if err != nil {
+		return types.NullJSONText{}
+	}
+	return types.NullJSONText{
+		data,
+		true,
+	}
+}
+
+func transformInteractiveFromRepoModel(message *pg.Message) *pb.Message {
+	result := &pb.Message{}
+	if message.Interactive.Valid {
+		protojson.UnmarshalOptions{
+			DiscardUnknown: true,
+		}.Unmarshal(message.Interactive.JSONText, result)
+	}
+	return result
+}
+
+func transformFileFromRepoModel(message *pg.Message) *pb.Message_File {
+	if !message.FileID.Valid {
+		return nil
+	}
+	return &pb.Message_File{
+		Id:       message.FileID.Int64,
+		Url:      message.FileURL.String,
+		MimeType: message.FileMimeType.String,
+		Name:     message.FileName.String,
+	}
+}
+
+func transformChatMessageFromRepoModel(message *pg.Message) *pb.Message {
+	interactive := transformInteractiveFromRepoModel(message)
+	result := &pb.Message{
+		Id:           message.ID,
+		Type:         message.Type,
+		Buttons:      interactive.GetButtons(),
+		QuickReplies: interactive.GetQuickReplies(),
+		Cards:        interactive.GetCards(),
+	}
+	if file := transformFileFromRepoModel(message); file != nil {
+		result.Value = &pb.Message_File_{
+			File: file,
+		}
+	} else if postback := interactive.GetPostback(); postback != nil {
+		result.Value = &pb.Message_Postback_{
+			Postback: postback,
+		}
+	} else {
+		result.Value = &pb.Message_Text{
+			Text: message.Text.String,
+		}
+	}
+	return result
+}
+
 func transformMessageFromRepoModel(message *pg.Message) *pb.HistoryMessage {
+	interactive := transformInteractiveFromRepoModel(message)
 	result := &pb.HistoryMessage{
 		Id: message.ID,
 		// ChannelId: message.ChannelID.String,
@@ -139,6 +626,11 @@ func transformMessageFromRepoModel(message *pg.Message) *pb.HistoryMessage {
 		FromUserType: message.UserType,
 		Type:         message.Type,
 		Text:         message.Text.String,
+		File:         transformFileFromRepoModel(message),
+		Postback:     interactive.GetPostback(),
+		Buttons:      interactive.GetButtons(),
+		QuickReplies: interactive.GetQuickReplies(),
+		Cards:        interactive.GetCards(),
 	}
 	if message.CreatedAt.Valid {
 		result.CreatedAt = message.CreatedAt.Time.Unix() * 1000
@@ -146,6 +638,60 @@ func transformMessageFromRepoModel(message *pg.Message) *pb.HistoryMessage {
 	if message.UpdatedAt.Valid {
 		result.UpdatedAt = message.UpdatedAt.Time.Unix() * 1000
 	}
+	if message.EditedAt.Valid {
+		result.EditedAt = message.EditedAt.Time.Unix() * 1000
+	}
+	if message.DeletedAt.Valid {
+		// only the placeholder of the deleted message stays in the history
+		result.DeletedAt = message.DeletedAt.Time.Unix() * 1000
+		result.Text = ""
+		result.File = nil
+		result.Postback = nil
+		result.Buttons = nil
+		result.QuickReplies = nil
+		result.Cards = nil
+	}
+	return result
+}
+
+func transformMessageStatusesFromRepoModel(statuses []*pg.MessageStatus) []*pb.MessageStatus {
+	result := make([]*pb.MessageStatus, 0, len(statuses))
+	for _, item := range statuses {
+		result = append(result, &pb.MessageStatus{
+			ChannelId: item.ChannelID,
+			UserId:    item.UserID,
+			UserType:  item.UserType,
+			Status:    item.Status,
+			Cause:     item.Cause.String,
+			UpdatedAt: item.UpdatedAt.Unix() * 1000,
+		})
+	}
+	return result
+}
+
+func transformMessageEditsFromRepoModel(edits []*pg.MessageEdit) []*pb.MessageEdit {
+	result := make([]*pb.MessageEdit, 0, len(edits))
+	for _, item := range edits {
+		result = append(result, &pb.MessageEdit{
+			Id:       item.ID,
+			Text:     item.Text.String,
+			EditedAt: item.EditedAt.Unix() * 1000,
+		})
+	}
+	return result
+}
+
+func transformConversationEventsFromRepoModel(events []*pg.ConversationEvent) []*pb.ConversationEvent {
+	result := make([]*pb.ConversationEvent, 0, len(events))
+	for _, item := range events {
+		result = append(result, &pb.ConversationEvent{
+			Seq:         item.Seq,
+			Type:        item.Type,
+			Body:        item.Body,
+			CreatedAt:   item.CreatedAt.Unix() * 1000,
+			ContentType: item.ContentType,
+		})
+	}
 	return result
 }
 
@@ -158,3 +704,69 @@ func transformMessagesFromRepoModel(messages []*pg.Message) []*pb.HistoryMessage
 	}
 	return result
 }
+
+// transformWebhookFromRepoModel never returns the secret
+func transformWebhookFromRepoModel(webhook *pg.Webhook) *pb.Webhook {
+	return &pb.Webhook{
+		Id:         webhook.ID,
+		DomainId:   webhook.DomainID,
+		Url:        webhook.URL,
+		EventTypes: webhook.EventTypes,
+		Enabled:    webhook.Enabled,
+		CreatedAt:  webhook.CreatedAt.Unix() * 1000,
+		UpdatedAt:  webhook.UpdatedAt.Unix() * 1000,
+	}
+}
+
+func transformWebhooksFromRepoModel(webhooks []*pg.Webhook) []*pb.Webhook {
+	result := make([]*pb.Webhook, 0, len(webhooks))
+	for _, item := range webhooks {
+		result = append(result, transformWebhookFromRepoModel(item))
+	}
+	return result
+}
+
+func transformWebhookToRepoModel(webhook *pb.Webhook) *pg.Webhook {
+	eventTypes := webhook.GetEventTypes()
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+	return &pg.Webhook{
+		ID:         webhook.GetId(),
+		DomainID:   webhook.GetDomainId(),
+		URL:        webhook.GetUrl(),
+		EventTypes: eventTypes,
+		Secret:     webhook.GetSecret(),
+		Enabled:    webhook.GetEnabled(),
+	}
+}
+
+func transformDomainSettingFromRepoModel(setting *pg.DomainSetting) *pb.DomainSetting {
+	return &pb.DomainSetting{
+		DomainId:       setting.DomainID,
+		IdleTimeoutSec: setting.IdleTimeoutSec,
+		ClosingMessage: setting.ClosingMessage,
+	}
+}
+
+func transformWebhookDeliveriesFromRepoModel(deliveries []*pg.WebhookDelivery) []*pb.WebhookDelivery {
+	result := make([]*pb.WebhookDelivery, 0, len(deliveries))
+	for _, item := range deliveries {
+		tmp := &pb.WebhookDelivery{
+			Id:             item.ID,
+			WebhookId:      item.WebhookID,
+			EventType:      item.EventType,
+			Status:         item.Status,
+			Attempts:       int32(item.Attempts),
+			LastStatusCode: int32(item.LastStatusCode),
+			LastError:      item.LastError,
+			CreatedAt:      item.CreatedAt.Unix() * 1000,
+			NextAttemptAt:  item.NextAttemptAt.Unix() * 1000,
+		}
+		if item.SentAt.Valid {
+			tmp.SentAt = item.SentAt.Time.Unix() * 1000
+		}
+		result = append(result, tmp)
+	}
+	return result
+}
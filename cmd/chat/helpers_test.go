@@ -0,0 +1,504 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	pb "github.com/matvoy/chat_server/api/proto/chat"
+	pbstorage "github.com/matvoy/chat_server/api/proto/storage"
+	"github.com/matvoy/chat_server/internal/auth"
+	pg "github.com/matvoy/chat_server/internal/repo/sqlx"
+
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/errors"
+	"github.com/rs/zerolog"
+)
+
+const testStorageURL = "https://storage.example.com"
+
+// fakeStorage keeps the uploaded file in memory
+type fakeStorage struct {
+	stream *fakeUploadStream
+	// sendErr fails the upload of the chunks
+	sendErr error
+}
+
+type fakeUploadStream struct {
+	ctx      context.Context
+	metadata *pbstorage.UploadFileRequest_Metadata
+	data     []byte
+	closed   bool
+	sendErr  error
+}
+
+func (f *fakeStorage) UploadFile(ctx context.Context, opts ...client.CallOption) (pbstorage.FileService_UploadFileService, error) {
+	f.stream = &fakeUploadStream{
+		ctx:     ctx,
+		sendErr: f.sendErr,
+	}
+	return f.stream, nil
+}
+
+func (s *fakeUploadStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeUploadStream) SendMsg(m interface{}) error {
+	return s.Send(m.(*pbstorage.UploadFileRequest))
+}
+
+func (s *fakeUploadStream) RecvMsg(m interface{}) error {
+	res := m.(*pbstorage.UploadFileResponse)
+	res.Code = pbstorage.UploadFileResponse_Ok
+	res.FileId = 42
+	return nil
+}
+
+func (s *fakeUploadStream) Close() error {
+	s.closed = true
+	return nil
+}
+
+func (s *fakeUploadStream) Send(m *pbstorage.UploadFileRequest) error {
+	if metadata := m.GetMetadata(); metadata != nil {
+		s.metadata = metadata
+		return nil
+	}
+	if s.sendErr != nil {
+		return s.sendErr
+	}
+	s.data = append(s.data, m.GetChunk()...)
+	return nil
+}
+
+func newTestChatService(storage pbstorage.FileService) *chatService {
+	log := zerolog.Nop()
+	return &chatService{
+		log:           &log,
+		storageClient: storage,
+	}
+}
+
+func newFileServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "file content")
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestStoreFile(t *testing.T) {
+	server := newFileServer(t)
+	cfg = &Config{
+		StorageURL:   testStorageURL,
+		FileURLHosts: []string{"127.0.0.1"},
+	}
+	agent := &auth.User{
+		ID:       1,
+		DomainID: 1,
+	}
+	service := &auth.User{
+		Service: true,
+	}
+	tests := []struct {
+		name     string
+		user     *auth.User
+		file     *pb.Message_File
+		uploaded bool
+		url      string
+		code     int32
+	}{
+		{
+			name: "stored file url is built from the id",
+			user: agent,
+			file: &pb.Message_File{
+				Id:  5,
+				Url: "https://attacker.example.com/file",
+			},
+			url: fileStorageURL(5, 1),
+		},
+		{
+			name: "agent url of the unknown host",
+			user: agent,
+			file: &pb.Message_File{
+				Url: "https://attacker.example.com/file",
+			},
+			code: 400,
+		},
+		{
+			name: "agent url without the scheme",
+			user: agent,
+			file: &pb.Message_File{
+				Url: "file:///etc/passwd",
+			},
+			code: 400,
+		},
+		{
+			name: "agent url of the allowed host",
+			user: agent,
+			file: &pb.Message_File{
+				Url: server.URL + "/file",
+			},
+			uploaded: true,
+			url:      fileStorageURL(42, 1),
+		},
+		{
+			name: "service url",
+			user: service,
+			file: &pb.Message_File{
+				Url: server.URL + "/file",
+			},
+			uploaded: true,
+			url:      fileStorageURL(42, 1),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			storage := &fakeStorage{}
+			s := newTestChatService(storage)
+			err := s.storeFile(context.Background(), test.user, 1, test.file)
+			if test.code != 0 {
+				if microErr, ok := err.(*errors.Error); !ok || microErr.Code != test.code {
+					t.Fatalf("expected error %v, got %v", test.code, err)
+				}
+				if storage.stream != nil {
+					t.Error("file is uploaded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if uploaded := storage.stream != nil; uploaded != test.uploaded {
+				t.Fatalf("expected uploaded %v, got %v", test.uploaded, uploaded)
+			}
+			if test.uploaded && string(storage.stream.data) != "file content" {
+				t.Errorf("unexpected uploaded content: %q", storage.stream.data)
+			}
+			if test.file.GetUrl() != test.url {
+				t.Errorf("expected url %v, got %v", test.url, test.file.GetUrl())
+			}
+		})
+	}
+}
+
+func TestUploadFileAbort(t *testing.T) {
+	server := newFileServer(t)
+	cfg = &Config{
+		StorageURL: testStorageURL,
+	}
+	storage := &fakeStorage{
+		sendErr: fmt.Errorf("storage is unavailable"),
+	}
+	s := newTestChatService(storage)
+	file := &pb.Message_File{
+		Url: server.URL + "/file",
+	}
+	if err := s.uploadFile(context.Background(), 1, file); err == nil {
+		t.Fatal("expected the upload error")
+	}
+	if !storage.stream.closed {
+		t.Error("upload stream is not closed")
+	}
+	if storage.stream.ctx.Err() == nil {
+		t.Error("upload stream is not canceled")
+	}
+	if file.GetId() != 0 {
+		t.Errorf("file id is set to %v", file.GetId())
+	}
+}
+
+func TestDownloadError(t *testing.T) {
+	const fileURL = "https://api.telegram.org/file/bot123:secret/photos/file_1.jpg"
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{
+			name: "url error",
+			err: &url.Error{
+				Op:  "Get",
+				URL: fileURL,
+				Err: fmt.Errorf("connection refused"),
+			},
+		},
+		{
+			name: "url in the wrapped error",
+			err: &url.Error{
+				Op:  "Get",
+				URL: fileURL,
+				Err: fmt.Errorf("redirect to %s failed", fileURL),
+			},
+		},
+		{
+			name: "url in the other error",
+			err:  fmt.Errorf("request %s failed", fileURL),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := downloadError(fileURL, test.err)
+			if strings.Contains(err.Error(), "secret") {
+				t.Errorf("file url is not redacted: %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthorizeChannel(t *testing.T) {
+	agent := &auth.User{
+		ID:       1,
+		DomainID: 1,
+	}
+	tests := []struct {
+		name    string
+		user    *auth.User
+		channel *pg.Channel
+		allowed bool
+	}{
+		{
+			name: "own channel",
+			user: agent,
+			channel: &pg.Channel{
+				Internal: true,
+				UserID:   1,
+				DomainID: 1,
+			},
+			allowed: true,
+		},
+		{
+			name: "channel of the other agent",
+			user: agent,
+			channel: &pg.Channel{
+				Internal: true,
+				UserID:   2,
+				DomainID: 1,
+			},
+		},
+		{
+			name: "client channel with the same user id",
+			user: agent,
+			channel: &pg.Channel{
+				UserID:   1,
+				DomainID: 1,
+			},
+		},
+		{
+			name: "channel of the other domain",
+			user: agent,
+			channel: &pg.Channel{
+				Internal: true,
+				UserID:   1,
+				DomainID: 2,
+			},
+		},
+		{
+			name: "service",
+			user: &auth.User{
+				Service: true,
+			},
+			channel: &pg.Channel{
+				UserID:   2,
+				DomainID: 2,
+			},
+			allowed: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkAccess(t, authorizeChannel(test.user, test.channel), test.allowed)
+		})
+	}
+}
+
+func TestAuthorizeInvite(t *testing.T) {
+	agent := &auth.User{
+		ID:       1,
+		DomainID: 1,
+	}
+	tests := []struct {
+		name    string
+		user    *auth.User
+		invite  *pg.Invite
+		allowed bool
+	}{
+		{
+			name: "invite of the agent",
+			user: agent,
+			invite: &pg.Invite{
+				UserID:   1,
+				DomainID: 1,
+			},
+			allowed: true,
+		},
+		{
+			name: "invite of the other agent",
+			user: agent,
+			invite: &pg.Invite{
+				UserID:   2,
+				DomainID: 1,
+			},
+		},
+		{
+			name: "invite of the other domain",
+			user: agent,
+			invite: &pg.Invite{
+				UserID:   1,
+				DomainID: 2,
+			},
+		},
+		{
+			name: "service",
+			user: &auth.User{
+				Service: true,
+			},
+			invite: &pg.Invite{
+				UserID:   2,
+				DomainID: 2,
+			},
+			allowed: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkAccess(t, authorizeInvite(test.user, test.invite), test.allowed)
+		})
+	}
+}
+
+func TestAuthorizeConversation(t *testing.T) {
+	agent := &auth.User{
+		ID:       1,
+		DomainID: 1,
+	}
+	tests := []struct {
+		name         string
+		user         *auth.User
+		conversation *pb.Conversation
+		allowed      bool
+	}{
+		{
+			name: "member",
+			user: agent,
+			conversation: &pb.Conversation{
+				DomainId: 1,
+				Members: []*pb.Member{
+					{
+						UserId:   2,
+						Internal: true,
+					},
+					{
+						UserId:   1,
+						Internal: true,
+					},
+				},
+			},
+			allowed: true,
+		},
+		{
+			name: "not a member",
+			user: agent,
+			conversation: &pb.Conversation{
+				DomainId: 1,
+				Members: []*pb.Member{
+					{
+						UserId:   2,
+						Internal: true,
+					},
+				},
+			},
+		},
+		{
+			name: "client with the same user id",
+			user: agent,
+			conversation: &pb.Conversation{
+				DomainId: 1,
+				Members: []*pb.Member{
+					{
+						UserId: 1,
+					},
+				},
+			},
+		},
+		{
+			name: "member in the other domain",
+			user: agent,
+			conversation: &pb.Conversation{
+				DomainId: 2,
+				Members: []*pb.Member{
+					{
+						UserId:   1,
+						Internal: true,
+					},
+				},
+			},
+		},
+		{
+			name: "service",
+			user: &auth.User{
+				Service: true,
+			},
+			conversation: &pb.Conversation{
+				DomainId: 2,
+			},
+			allowed: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkAccess(t, authorizeConversation(test.user, test.conversation), test.allowed)
+		})
+	}
+}
+
+func checkAccess(t *testing.T, err error, allowed bool) {
+	t.Helper()
+	if allowed {
+		if err != nil {
+			t.Fatalf("expected access, got %v", err)
+		}
+		return
+	}
+	if microErr, ok := err.(*errors.Error); !ok || microErr.Code != 403 {
+		t.Fatalf("expected forbidden, got %v", err)
+	}
+}
+
+func TestValidateWebhook(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://hooks.example.com/chat", true},
+		{"http://8.8.8.8:8080/chat", true},
+		{"ftp://hooks.example.com/chat", false},
+		{"https:///chat", false},
+		{"hooks.example.com/chat", false},
+		{"http://localhost:8080/chat", false},
+		{"http://127.0.0.1/chat", false},
+		{"http://[::1]/chat", false},
+		{"http://10.0.0.1/chat", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+	}
+	for _, test := range tests {
+		err := validateWebhook(&pb.Webhook{
+			Url: test.url,
+		})
+		if test.valid {
+			if err != nil {
+				t.Errorf("%v: expected valid, got %v", test.url, err)
+			}
+			continue
+		}
+		if microErr, ok := err.(*errors.Error); !ok || microErr.Code != 400 {
+			t.Errorf("%v: expected bad request, got %v", test.url, err)
+		}
+	}
+}
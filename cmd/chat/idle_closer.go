@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	event "github.com/matvoy/chat_server/internal/event_router"
+	pg "github.com/matvoy/chat_server/internal/repo/sqlx"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog"
+)
+
+const (
+	idleCheckInterval = 10 * time.Second
+	idleCloseBatch    = 100
+)
+
+// IdleCloser closes the conversations without activity.
+// The timeout is set per profile, per domain (UpdateDomainSetting) or by conversation_timeout_sec.
+type IdleCloser interface {
+	Start()
+	Stop()
+}
+
+type idleCloser struct {
+	repo           pg.Repository
+	log            *zerolog.Logger
+	eventRouter    event.Router
+	timeoutSec     uint64
+	closingMessage string
+	stop           chan struct{}
+	wg             sync.WaitGroup
+}
+
+func NewIdleCloser(
+	repo pg.Repository,
+	log *zerolog.Logger,
+	eventRouter event.Router,
+	timeoutSec uint64,
+	closingMessage string,
+) IdleCloser {
+	return &idleCloser{
+		repo:           repo,
+		log:            log,
+		eventRouter:    eventRouter,
+		timeoutSec:     timeoutSec,
+		closingMessage: closingMessage,
+		stop:           make(chan struct{}),
+	}
+}
+
+func (c *idleCloser) Start() {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(idleCheckInterval)
+		defer ticker.Stop()
+		for {
+			c.closeIdleConversations()
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (c *idleCloser) Stop() {
+	close(c.stop)
+	c.wg.Wait()
+}
+
+func (c *idleCloser) closeIdleConversations() {
+	for {
+		var conversations []*pg.IdleConversation
+		// the conversations are closed and the events are written to the outbox at once
+		if err := c.repo.WithTransaction(func(tx *sqlx.Tx) error {
+			var err error
+			conversations, err = c.repo.CloseIdleConversationsTx(context.Background(), tx, int64(c.timeoutSec), idleCloseBatch)
+			if err != nil {
+				return err
+			}
+			for _, conversation := range conversations {
+				if err := c.closeConversation(tx, conversation); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			c.log.Error().Msg(err.Error())
+			return
+		}
+		if len(conversations) < idleCloseBatch {
+			return
+		}
+	}
+}
+
+// closeConversation tells the members that the conversation is closed, closes its channels
+// and queues the stop of the flow
+func (c *idleCloser) closeConversation(tx *sqlx.Tx, conversation *pg.IdleConversation) error {
+	c.log.Trace().
+		Str("conversation_id", conversation.ID).
+		Int64("domain_id", conversation.DomainID).
+		Msg("close idle conversation")
+	message := conversation.ClosingMessage
+	if message == "" {
+		message = c.closingMessage
+	}
+	if err := c.eventRouter.RouteCloseIdleConversation(tx, &conversation.ID, message); err != nil {
+		return err
+	}
+	if err := c.repo.CloseChannelsTx(context.Background(), tx, conversation.ID); err != nil {
+		return err
+	}
+	return queueCloseConversation(context.Background(), c.repo, tx, conversation.ID)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	event "github.com/matvoy/chat_server/internal/event_router"
+	"github.com/matvoy/chat_server/internal/flow"
+	pg "github.com/matvoy/chat_server/internal/repo/sqlx"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog"
+)
+
+const (
+	inviteExpirationInterval = time.Second
+	inviteExpirationBatch    = 100
+)
+
+// InviteExpirer closes the invites whose timeout is over.
+// Due times are stored in chat.invite, so pending invites are recovered after restart.
+type InviteExpirer interface {
+	Start()
+	Stop()
+}
+
+type inviteExpirer struct {
+	repo        pg.Repository
+	log         *zerolog.Logger
+	eventRouter event.Router
+	stop        chan struct{}
+	wg          sync.WaitGroup
+}
+
+func NewInviteExpirer(
+	repo pg.Repository,
+	log *zerolog.Logger,
+	eventRouter event.Router,
+) InviteExpirer {
+	return &inviteExpirer{
+		repo:        repo,
+		log:         log,
+		eventRouter: eventRouter,
+		stop:        make(chan struct{}),
+	}
+}
+
+func (e *inviteExpirer) Start() {
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		ticker := time.NewTicker(inviteExpirationInterval)
+		defer ticker.Stop()
+		for {
+			e.expireInvites()
+			select {
+			case <-e.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (e *inviteExpirer) Stop() {
+	close(e.stop)
+	e.wg.Wait()
+}
+
+func (e *inviteExpirer) expireInvites() {
+	for {
+		var invites []*pg.Invite
+		// the invites are closed and the events are written to the outbox at once
+		if err := e.repo.WithTransaction(func(tx *sqlx.Tx) error {
+			var err error
+			invites, err = e.repo.ExpireInvitesTx(context.Background(), tx, inviteExpirationBatch)
+			if err != nil {
+				return err
+			}
+			for _, invite := range invites {
+				e.log.Trace().
+					Str("invite_id", invite.ID).
+					Int64("user_id", invite.UserID).
+					Str("conversation_id", invite.ConversationID).
+					Msg("autodecline invitation")
+				if err := e.eventRouter.SendExpireInviteToWebitelUser(tx, &invite.DomainID, &invite.ConversationID, &invite.UserID, &invite.ID); err != nil {
+					return err
+				}
+				// the conversation is returned to the flow if the flow was waiting for the agent
+				if invite.InviterChannelID == (sql.NullString{}) {
+					if err := queueBreakBridge(context.Background(), e.repo, tx, invite.ConversationID, flow.TimeoutCause); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}); err != nil {
+			e.log.Error().Msg(err.Error())
+			return
+		}
+		if len(invites) < inviteExpirationBatch {
+			return
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"os"
 
 	pbauth "github.com/matvoy/chat_server/api/proto/auth"
@@ -12,7 +13,9 @@ import (
 	cache "github.com/matvoy/chat_server/internal/chat_cache"
 	event "github.com/matvoy/chat_server/internal/event_router"
 	"github.com/matvoy/chat_server/internal/flow"
+	"github.com/matvoy/chat_server/internal/migrations"
 	pg "github.com/matvoy/chat_server/internal/repo/sqlx"
+	"github.com/matvoy/chat_server/pkg/events"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
@@ -27,8 +30,16 @@ import (
 )
 
 type Config struct {
-	LogLevel string
-	DBSource string
+	LogLevel       string
+	DBSource       string
+	StorageURL     string
+	ClosingMessage string
+	ServiceKeys    auth.ServiceKeys
+	// TrustedServices are authenticated on the flow endpoints by the registry address instead of the signature, none by default
+	TrustedServices []string
+	EventFormat     events.Format
+	// FileURLHosts are the hosts the agents may send the file urls from
+	FileURLHosts []string
 }
 
 var (
@@ -57,6 +68,7 @@ func main() {
 	service = micro.NewService(
 		micro.Name("webitel.chat.server"),
 		micro.Version("latest"),
+		micro.WrapHandler(auth.NewRequestWrapper()),
 		micro.Flags(
 			&cli.StringFlag{
 				Name:    "log_level",
@@ -93,22 +105,58 @@ func main() {
 			&cli.Uint64Flag{
 				Name:    "conversation_timeout_sec",
 				EnvVars: []string{"CONVERSATION_TIMEOUT_SEC"},
+				Value:   600,
 				Usage:   "Conversation timeout. sec",
 			},
+			&cli.StringFlag{
+				Name:    "conversation_closing_message",
+				EnvVars: []string{"CONVERSATION_CLOSING_MESSAGE"},
+				Value:   "Conversation closed due to inactivity",
+				Usage:   "Message sent to the client when the conversation is closed by timeout",
+			},
 			&cli.StringFlag{
 				Name:    "webitel_dbo_address",
 				EnvVars: []string{"WEBITEL_DBO_ADDRESS"},
 				Value:   "disable",
 				Usage:   "DB Connection string",
 			},
+			&cli.StringFlag{
+				Name:    "service_keys",
+				EnvVars: []string{"SERVICE_KEYS"},
+				Usage:   "Keys to verify signed service requests: id1:secret1,id2:secret2",
+			},
+			&cli.StringSliceFlag{
+				Name:    "trusted_services",
+				EnvVars: []string{"TRUSTED_SERVICES"},
+				Usage:   "Registry names of the services trusted by the caller address on the flow endpoints, for those which cannot sign requests (e.g. workflow)",
+			},
+			&cli.StringFlag{
+				Name:    "event_format",
+				EnvVars: []string{"EVENT_FORMAT"},
+				Value:   string(events.FormatJSON),
+				Usage:   "Encoding of the published events: json (legacy), protojson or protobuf",
+			},
+			&cli.StringSliceFlag{
+				Name:    "file_url_hosts",
+				EnvVars: []string{"FILE_URL_HOSTS"},
+				Usage:   "Hosts the agents may send the file urls from, other files are uploaded to the storage",
+			},
+			&cli.StringFlag{
+				Name:    "storage_url",
+				EnvVars: []string{"STORAGE_URL"},
+				Usage:   "Storage public url for file links",
+			},
 		),
 	)
+	service.Options().Cmd.App().Commands = append(service.Options().Cmd.App().Commands, migrateCommand())
 	service.Init(
 		micro.Action(func(c *cli.Context) error {
 			cfg.LogLevel = c.String("log_level")
 			cfg.DBSource = c.String("webitel_dbo_address")
+			cfg.StorageURL = c.String("storage_url")
 			redisTable = c.String("store_table")
-			timeout = 600 //c.Uint64("conversation_timeout_sec")
+			cfg.ClosingMessage = c.String("conversation_closing_message")
+			timeout = c.Uint64("conversation_timeout_sec")
 			var err error
 			logger, err = NewLogger(cfg.LogLevel)
 			if err != nil {
@@ -117,6 +165,22 @@ func main() {
 					Msg(err.Error())
 				return err
 			}
+			cfg.ServiceKeys, err = auth.ParseServiceKeys(c.String("service_keys"))
+			if err != nil {
+				logger.Fatal().
+					Str("app", "failed to parse service keys").
+					Msg(err.Error())
+				return err
+			}
+			cfg.TrustedServices = c.StringSlice("trusted_services")
+			cfg.FileURLHosts = c.StringSlice("file_url_hosts")
+			cfg.EventFormat, err = events.ParseFormat(c.String("event_format"))
+			if err != nil {
+				logger.Fatal().
+					Str("app", "failed to parse event format").
+					Msg(err.Error())
+				return err
+			}
 			flowClient = pbmanager.NewFlowChatServerService("workflow", service.Client())
 			botClient = pbbot.NewBotService("webitel.chat.bot", service.Client())
 			authClient = pbauth.NewAuthService("go.webitel.app", service.Client())
@@ -131,6 +195,11 @@ func main() {
 		),
 	)
 
+	// the service action was not run: help was printed or the migrate command was executed
+	if logger == nil {
+		return
+	}
+
 	service.Options().Store.Init(store.Table(redisTable))
 
 	if err := service.Options().Broker.Init(); err != nil {
@@ -158,11 +227,25 @@ func main() {
 		Str("cfg.DBSource", cfg.DBSource).
 		Msg("db connected")
 
+	migrator, err := migrations.NewMigrator(db, logger)
+	if err != nil {
+		logger.Fatal().
+			Str("app", "failed to load migrations").
+			Msg(err.Error())
+		return
+	}
+	if err := migrator.Check(context.Background()); err != nil {
+		logger.Fatal().
+			Str("app", "failed to check db schema").
+			Msg(err.Error())
+		return
+	}
+
 	repo := pg.NewRepository(db, logger)
 	cache := cache.NewChatCache(service.Options().Store)
-	flow := flow.NewClient(logger, flowClient, cache)
-	auth := auth.NewClient(logger, cache, authClient)
-	eventRouter := event.NewRouter(botClient /*flow,*/, service.Options().Broker, repo, logger)
+	flow := flow.NewClient(logger, flowClient, cache, service.Options().Registry)
+	auth := auth.NewClient(logger, cache, authClient, cfg.ServiceKeys, cfg.TrustedServices, service.Options().Registry)
+	eventRouter := event.NewRouter(repo, logger, cfg.EventFormat)
 	serv := NewChatService(repo, logger, flow, auth, botClient, storageClient, cache, eventRouter)
 
 	if err := pb.RegisterChatServiceHandler(service.Server(), serv); err != nil {
@@ -172,6 +255,26 @@ func main() {
 		return
 	}
 
+	outboxRelay := NewOutboxRelay(repo, logger, service.Options().Broker)
+	outboxRelay.Start()
+	defer outboxRelay.Stop()
+
+	taskRelay := NewTaskRelay(repo, logger, botClient, flow, eventRouter)
+	taskRelay.Start()
+	defer taskRelay.Stop()
+
+	webhookDispatcher := NewWebhookDispatcher(repo, logger)
+	webhookDispatcher.Start()
+	defer webhookDispatcher.Stop()
+
+	inviteExpirer := NewInviteExpirer(repo, logger, eventRouter)
+	inviteExpirer.Start()
+	defer inviteExpirer.Stop()
+
+	idleCloser := NewIdleCloser(repo, logger, eventRouter, timeout, cfg.ClosingMessage)
+	idleCloser.Start()
+	defer idleCloser.Stop()
+
 	if err := service.Run(); err != nil {
 		logger.Fatal().
 			Str("app", "failed to run service").
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/matvoy/chat_server/internal/migrations"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/micro/cli/v2"
+)
+
+func migrateCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "migrate",
+		Usage: "Manage the chat database schema",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "up",
+				Usage: "Apply all pending migrations",
+				Action: migrateAction(func(ctx context.Context, c *cli.Context, m migrations.Migrator) error {
+					return m.Up(ctx)
+				}),
+			},
+			{
+				Name:  "down",
+				Usage: "Roll back the last migrations",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "steps",
+						Value: 1,
+						Usage: "Number of migrations to roll back",
+					},
+				},
+				Action: migrateAction(func(ctx context.Context, c *cli.Context, m migrations.Migrator) error {
+					return m.Down(ctx, c.Int("steps"))
+				}),
+			},
+			{
+				Name:  "version",
+				Usage: "Print the current schema version",
+				Action: migrateAction(func(ctx context.Context, c *cli.Context, m migrations.Migrator) error {
+					version, err := m.Version(ctx)
+					if err != nil {
+						return err
+					}
+					fmt.Printf("current: %v, latest: %v\n", version, m.Latest())
+					return nil
+				}),
+			},
+		},
+	}
+}
+
+func migrateAction(run func(ctx context.Context, c *cli.Context, m migrations.Migrator) error) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		log, err := NewLogger(c.String("log_level"))
+		if err != nil {
+			return err
+		}
+		db, err := sqlx.Open("postgres", c.String("webitel_dbo_address"))
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		m, err := migrations.NewMigrator(db, log)
+		if err != nil {
+			return err
+		}
+		if err := run(context.Background(), c, m); err != nil {
+			log.Error().Msg(err.Error())
+			return err
+		}
+		return nil
+	}
+}
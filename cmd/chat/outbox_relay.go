@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	pg "github.com/matvoy/chat_server/internal/repo/sqlx"
+
+	"github.com/micro/go-micro/v2/broker"
+	"github.com/rs/zerolog"
+)
+
+const (
+	outboxRelayInterval = time.Second
+	outboxRelayBatch    = 100
+	// outboxLease is the time the claimed events are hidden from the other replicas
+	outboxLease = 30 * time.Second
+	// outboxMaxBackoff limits the exponential delay between the publish attempts
+	outboxMaxBackoff = 5 * time.Minute
+	// outboxRetention is the time the published events are kept for troubleshooting
+	outboxRetention       = 24 * time.Hour
+	outboxCleanupInterval = time.Hour
+)
+
+// OutboxRelay publishes the events written to chat.outbox to the broker.
+// Events are retried until published, so consumers receive each of them at least once.
+type OutboxRelay interface {
+	Start()
+	Stop()
+}
+
+type outboxRelay struct {
+	repo   pg.Repository
+	log    *zerolog.Logger
+	broker broker.Broker
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func NewOutboxRelay(
+	repo pg.Repository,
+	log *zerolog.Logger,
+	broker broker.Broker,
+) OutboxRelay {
+	return &outboxRelay{
+		repo:   repo,
+		log:    log,
+		broker: broker,
+		stop:   make(chan struct{}),
+	}
+}
+
+func (r *outboxRelay) Start() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(outboxRelayInterval)
+		defer ticker.Stop()
+		cleanedAt := time.Time{}
+		for {
+			r.relay()
+			if time.Since(cleanedAt) > outboxCleanupInterval {
+				r.cleanup()
+				cleanedAt = time.Now()
+			}
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (r *outboxRelay) Stop() {
+	close(r.stop)
+	r.wg.Wait()
+}
+
+func (r *outboxRelay) relay() {
+	for {
+		events, err := r.repo.ClaimOutboxEvents(context.Background(), outboxRelayBatch, outboxLease)
+		if err != nil {
+			r.log.Error().Msg(err.Error())
+			return
+		}
+		sort.Slice(events, func(i, j int) bool {
+			return events[i].ID < events[j].ID
+		})
+		for _, event := range events {
+			r.publish(event)
+		}
+		if len(events) < outboxRelayBatch {
+			return
+		}
+	}
+}
+
+func (r *outboxRelay) publish(event *pg.OutboxEvent) {
+	msg := &broker.Message{
+		Header: map[string]string{
+			"content_type": event.ContentType,
+		},
+		Body: event.Body,
+	}
+	if err := r.broker.Publish(event.Topic, msg); err != nil {
+		retryAt := time.Now().Add(outboxBackoff(event.Attempts))
+		r.log.Warn().
+			Int64("outbox_id", event.ID).
+			Str("topic", event.Topic).
+			Int("attempts", event.Attempts).
+			Time("retry_at", retryAt).
+			Msg(err.Error())
+		if err := r.repo.RetryOutboxEvent(context.Background(), event.ID, retryAt, err.Error()); err != nil {
+			r.log.Error().Msg(err.Error())
+		}
+		return
+	}
+	// the event is published again after the lease if it is not marked here
+	if err := r.repo.MarkOutboxEventSent(context.Background(), event.ID); err != nil {
+		r.log.Error().Msg(err.Error())
+	}
+}
+
+func (r *outboxRelay) cleanup() {
+	if err := r.repo.DeleteSentOutboxEvents(context.Background(), time.Now().Add(-outboxRetention)); err != nil {
+		r.log.Error().Msg(err.Error())
+	}
+}
+
+// outboxBackoff is 1s, 2s, 4s... for the attempts made, up to outboxMaxBackoff
+func outboxBackoff(attempts int) time.Duration {
+	if attempts < 1 {
+		return time.Second
+	}
+	if attempts > 16 {
+		return outboxMaxBackoff
+	}
+	if backoff := time.Second << uint(attempts-1); backoff < outboxMaxBackoff {
+		return backoff
+	}
+	return outboxMaxBackoff
+}
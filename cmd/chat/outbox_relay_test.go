@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOutboxBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		backoff  time.Duration
+	}{
+		{0, time.Second},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{8, 128 * time.Second},
+		{9, 256 * time.Second},
+		{10, outboxMaxBackoff},
+		{16, outboxMaxBackoff},
+		{64, outboxMaxBackoff},
+	}
+	for _, test := range tests {
+		if backoff := outboxBackoff(test.attempts); backoff != test.backoff {
+			t.Errorf("attempts %v: expected %v, got %v", test.attempts, test.backoff, backoff)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"time"
@@ -30,8 +31,23 @@ type Service interface {
 	UpdateProfile(ctx context.Context, req *pb.UpdateProfileRequest, res *pb.UpdateProfileResponse) error
 	DeleteProfile(ctx context.Context, req *pb.DeleteProfileRequest, res *pb.DeleteProfileResponse) error
 	GetHistoryMessages(ctx context.Context, req *pb.GetHistoryMessagesRequest, res *pb.GetHistoryMessagesResponse) error
+	GetConversationEvents(ctx context.Context, req *pb.GetConversationEventsRequest, res *pb.GetConversationEventsResponse) error
+	GetMessageEdits(ctx context.Context, req *pb.GetMessageEditsRequest, res *pb.GetMessageEditsResponse) error
+	GetMessageStatuses(ctx context.Context, req *pb.GetMessageStatusesRequest, res *pb.GetMessageStatusesResponse) error
+	GetWebhooks(ctx context.Context, req *pb.GetWebhooksRequest, res *pb.GetWebhooksResponse) error
+	GetWebhookByID(ctx context.Context, req *pb.GetWebhookByIDRequest, res *pb.GetWebhookByIDResponse) error
+	CreateWebhook(ctx context.Context, req *pb.CreateWebhookRequest, res *pb.CreateWebhookResponse) error
+	UpdateWebhook(ctx context.Context, req *pb.UpdateWebhookRequest, res *pb.UpdateWebhookResponse) error
+	DeleteWebhook(ctx context.Context, req *pb.DeleteWebhookRequest, res *pb.DeleteWebhookResponse) error
+	GetWebhookDeliveries(ctx context.Context, req *pb.GetWebhookDeliveriesRequest, res *pb.GetWebhookDeliveriesResponse) error
+	GetDomainSetting(ctx context.Context, req *pb.GetDomainSettingRequest, res *pb.GetDomainSettingResponse) error
+	UpdateDomainSetting(ctx context.Context, req *pb.UpdateDomainSettingRequest, res *pb.UpdateDomainSettingResponse) error
 
 	SendMessage(ctx context.Context, req *pb.SendMessageRequest, res *pb.SendMessageResponse) error
+	EditMessage(ctx context.Context, req *pb.EditMessageRequest, res *pb.EditMessageResponse) error
+	DeleteMessage(ctx context.Context, req *pb.DeleteMessageRequest, res *pb.DeleteMessageResponse) error
+	UpdateMessageStatus(ctx context.Context, req *pb.UpdateMessageStatusRequest, res *pb.UpdateMessageStatusResponse) error
+	MarkRead(ctx context.Context, req *pb.MarkReadRequest, res *pb.MarkReadResponse) error
 	StartConversation(ctx context.Context, req *pb.StartConversationRequest, res *pb.StartConversationResponse) error
 	CloseConversation(ctx context.Context, req *pb.CloseConversationRequest, res *pb.CloseConversationResponse) error
 	JoinConversation(ctx context.Context, req *pb.JoinConversationRequest, res *pb.JoinConversationResponse) error
@@ -85,21 +101,48 @@ func (s *chatService) SendMessage(
 		Str("conversation_id", req.GetConversationId()).
 		Bool("from_flow", req.GetFromFlow()).
 		Msg("send message")
+	if req.GetMessage() == nil {
+		return errors.BadRequest("message not found", "")
+	}
+	if err := validateMessage(req.GetMessage()); err != nil {
+		s.log.Warn().Msg(err.Error())
+		return err
+	}
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
 	if req.GetFromFlow() {
-		conversationID := req.GetConversationId()
-		message := &pg.Message{
-			Type:           "text",
-			ConversationID: conversationID,
-			Text: sql.NullString{
-				req.GetMessage().GetText(),
-				true,
-			},
-		}
-		if err := s.repo.CreateMessage(ctx, message); err != nil {
-			s.log.Error().Msg(err.Error())
+		if err := authorizeService(user); err != nil {
+			s.log.Warn().Msg(err.Error())
 			return err
 		}
-		if err := s.eventRouter.RouteMessageFromFlow(&conversationID, req.GetMessage()); err != nil {
+		conversationID := req.GetConversationId()
+		if file := req.GetMessage().GetFile(); file != nil {
+			conversation, err := s.repo.GetConversationByID(ctx, conversationID)
+			if err != nil {
+				s.log.Error().Msg(err.Error())
+				return err
+			}
+			if conversation == nil {
+				s.log.Warn().Msg("conversation not found")
+				return errors.BadRequest("conversation not found", "")
+			}
+			if err := s.storeFile(ctx, user, conversation.DomainId, file); err != nil {
+				s.log.Error().Msg(err.Error())
+				return err
+			}
+		}
+		message := transformMessageToRepoModel(req.GetMessage())
+		message.ConversationID = conversationID
+		if err := s.repo.WithTransaction(func(tx *sqlx.Tx) error {
+			if err := s.repo.CreateMessageTx(ctx, tx, message); err != nil {
+				return err
+			}
+			req.Message.Id = message.ID
+			return s.eventRouter.RouteMessageFromFlow(tx, &conversationID, req.GetMessage())
+		}); err != nil {
 			s.log.Error().Msg(err.Error())
 			if err := s.flowClient.CloseConversation(conversationID); err != nil {
 				s.log.Error().Msg(err.Error())
@@ -118,39 +161,238 @@ func (s *chatService) SendMessage(
 		s.log.Warn().Msg("channel not found")
 		return errors.BadRequest("channel not found", "")
 	}
+	if err := authorizeChannel(user, channel); err != nil {
+		s.log.Warn().Msg(err.Error())
+		return err
+	}
 
-	message := &pg.Message{
-		Type: "text",
-		ChannelID: sql.NullString{
-			channel.ID,
-			true,
-		},
-		ConversationID: channel.ConversationID,
-		Text: sql.NullString{
-			req.GetMessage().GetText(),
+	if file := req.GetMessage().GetFile(); file != nil {
+		if err := s.storeFile(ctx, user, channel.DomainID, file); err != nil {
+			s.log.Error().Msg(err.Error())
+			return err
+		}
+	}
+	message := transformMessageToRepoModel(req.GetMessage())
+	message.ChannelID = sql.NullString{
+		channel.ID,
+		true,
+	}
+	message.ConversationID = channel.ConversationID
+	var reqMessage *pb.Message
+	sent := false
+	if err := s.repo.WithTransaction(func(tx *sqlx.Tx) error {
+		if err := s.repo.CreateMessageTx(ctx, tx, message); err != nil {
+			return err
+		}
+		if externalID := req.GetMessage().GetExternalId(); externalID != "" {
+			if err := s.repo.CreateMessageExternalIDTx(ctx, tx, message.ID, channel.ID, externalID); err != nil {
+				return err
+			}
+		}
+		reqMessage = transformChatMessageFromRepoModel(message)
+		sent, err = s.eventRouter.RouteMessage(tx, channel, reqMessage)
+		return err
+	}); err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	if !channel.Internal && !sent {
+		if err := s.flowClient.SendMessage(channel.ConversationID, reqMessage); err != nil {
+			s.log.Error().Msg(err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+// EditMessage changes the text of the message sent from the channel, the previous text is kept in the history
+func (s *chatService) EditMessage(
+	ctx context.Context,
+	req *pb.EditMessageRequest,
+	res *pb.EditMessageResponse,
+) error {
+	s.log.Trace().
+		Int64("id", req.GetId()).
+		Str("channel_id", req.GetChannelId()).
+		Str("external_id", req.GetExternalId()).
+		Msg("edit message")
+	if req.GetText() == "" {
+		return errors.BadRequest("text not found", "")
+	}
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	channel, message, err := s.getAuthoredMessage(ctx, user, req.GetChannelId(), req.GetId(), req.GetExternalId())
+	if err != nil {
+		return err
+	}
+	if message.Type != "text" {
+		s.log.Warn().Msg("not a text message")
+		return errors.BadRequest("only text messages can be edited", "")
+	}
+	if message.Text.String == req.GetText() {
+		return nil
+	}
+	message.Text = sql.NullString{
+		req.GetText(),
+		true,
+	}
+	if err := s.repo.WithTransaction(func(tx *sqlx.Tx) error {
+		if err := s.repo.EditMessageTx(ctx, tx, message); err != nil {
+			return err
+		}
+		return s.eventRouter.RouteEditMessage(tx, channel, message)
+	}); err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	return nil
+}
+
+// DeleteMessage hides the message sent from the channel from the history of the conversation
+func (s *chatService) DeleteMessage(
+	ctx context.Context,
+	req *pb.DeleteMessageRequest,
+	res *pb.DeleteMessageResponse,
+) error {
+	s.log.Trace().
+		Int64("id", req.GetId()).
+		Str("channel_id", req.GetChannelId()).
+		Str("external_id", req.GetExternalId()).
+		Msg("delete message")
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	channel, message, err := s.getAuthoredMessage(ctx, user, req.GetChannelId(), req.GetId(), req.GetExternalId())
+	if err != nil {
+		return err
+	}
+	if err := s.repo.WithTransaction(func(tx *sqlx.Tx) error {
+		if err := s.repo.DeleteMessageTx(ctx, tx, message); err != nil {
+			return err
+		}
+		return s.eventRouter.RouteDeleteMessage(tx, channel, message)
+	}); err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	return nil
+}
+
+// UpdateMessageStatus saves the delivery report of the bot for the message sent to the external user
+func (s *chatService) UpdateMessageStatus(
+	ctx context.Context,
+	req *pb.UpdateMessageStatusRequest,
+	res *pb.UpdateMessageStatusResponse,
+) error {
+	s.log.Trace().
+		Int64("profile_id", req.GetProfileId()).
+		Str("external_user_id", req.GetExternalUserId()).
+		Str("external_message_id", req.GetExternalMessageId()).
+		Str("status", req.GetStatus()).
+		Msg("update message status")
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	if err := authorizeService(user); err != nil {
+		s.log.Warn().Msg(err.Error())
+		return err
+	}
+	switch req.GetStatus() {
+	case pg.MessageStatusDelivered, pg.MessageStatusRead, pg.MessageStatusFailed:
+	default:
+		return errors.BadRequest("wrong status", "")
+	}
+	external, err := s.repo.GetMessageExternalByBot(ctx, req.GetProfileId(), req.GetExternalUserId(), req.GetExternalMessageId())
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	if external == nil {
+		s.log.Warn().Msg("message not found")
+		return errors.BadRequest("message not found", "")
+	}
+	channel, err := s.repo.GetChannelByID(ctx, external.ChannelID)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	if channel == nil {
+		s.log.Warn().Msg("channel not found")
+		return errors.BadRequest("channel not found", "")
+	}
+	status := &pg.MessageStatus{
+		MessageID: external.MessageID,
+		ChannelID: channel.ID,
+		Status:    req.GetStatus(),
+	}
+	if req.GetCause() != "" {
+		status.Cause = sql.NullString{
+			req.GetCause(),
 			true,
-		},
+		}
 	}
-	if err := s.repo.CreateMessage(ctx, message); err != nil {
+	if err := s.repo.WithTransaction(func(tx *sqlx.Tx) error {
+		changed, err := s.repo.UpdateMessageStatusTx(ctx, tx, status)
+		if err != nil || !changed {
+			return err
+		}
+		return s.eventRouter.RouteMessageStatus(tx, channel, status)
+	}); err != nil {
 		s.log.Error().Msg(err.Error())
 		return err
 	}
-	reqMessage := &pb.Message{
-		Id:   message.ID,
-		Type: message.Type,
-		Value: &pb.Message_Text{
-			Text: message.Text.String,
-		},
+	return nil
+}
+
+// MarkRead marks the messages received by the channel up to the message as read
+func (s *chatService) MarkRead(
+	ctx context.Context,
+	req *pb.MarkReadRequest,
+	res *pb.MarkReadResponse,
+) error {
+	s.log.Trace().
+		Str("channel_id", req.GetChannelId()).
+		Int64("message_id", req.GetMessageId()).
+		Msg("mark read")
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
 	}
-	sent, err := s.eventRouter.RouteMessage(channel, reqMessage)
+	channel, err := s.repo.GetChannelByID(ctx, req.GetChannelId())
 	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	if channel == nil {
+		s.log.Warn().Msg("channel not found")
+		return errors.BadRequest("channel not found", "")
+	}
+	if err := authorizeChannel(user, channel); err != nil {
 		s.log.Warn().Msg(err.Error())
 		return err
 	}
-	if !channel.Internal && !sent {
-		if s.flowClient.SendMessage(channel.ConversationID, reqMessage); err != nil {
+	if err := s.repo.WithTransaction(func(tx *sqlx.Tx) error {
+		statuses, err := s.repo.MarkReadTx(ctx, tx, channel.ID, req.GetMessageId())
+		if err != nil {
 			return err
 		}
+		for _, status := range statuses {
+			if err := s.eventRouter.RouteMessageStatus(tx, channel, status); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
 	}
 	return nil
 }
@@ -167,7 +409,17 @@ func (s *chatService) StartConversation(
 		Int64("user.id", req.GetUser().GetUserId()).
 		Str("username", req.GetUsername()).
 		Bool("user.internal", req.GetUser().GetInternal()).
+		Bool("message", req.GetMessage() != nil).
 		Msg("start conversation")
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	if err := authorizeService(user); err != nil {
+		s.log.Warn().Msg(err.Error())
+		return err
+	}
 	channel := &pg.Channel{
 		Type: req.GetUser().GetType(),
 		// ConversationID: conversation.ID,
@@ -180,9 +432,41 @@ func (s *chatService) StartConversation(
 		DomainID: req.GetDomainId(),
 		Name:     req.GetUsername(),
 	}
+	var profileID int64
+	var variables map[string]string
+	if !req.GetUser().GetInternal() {
+		var err error
+		profileID, err = strconv.ParseInt(req.GetUser().GetConnection(), 10, 64)
+		if err != nil {
+			return err
+		}
+		variables, err = s.conversationVariables(ctx, req, profileID)
+		if err != nil {
+			s.log.Error().Msg(err.Error())
+			return err
+		}
+	}
 	conversation := &pg.Conversation{
 		DomainID: req.GetDomainId(),
 	}
+	if variables != nil {
+		data, err := json.Marshal(variables)
+		if err != nil {
+			s.log.Error().Msg(err.Error())
+			return err
+		}
+		conversation.Variables = data
+	}
+	var message *pg.Message
+	if req.GetMessage() != nil {
+		if file := req.GetMessage().GetFile(); file != nil {
+			if err := s.storeFile(ctx, user, req.GetDomainId(), file); err != nil {
+				s.log.Error().Msg(err.Error())
+				return err
+			}
+		}
+		message = transformMessageToRepoModel(req.GetMessage())
+	}
 	if err := s.repo.WithTransaction(func(tx *sqlx.Tx) error {
 		if err := s.repo.CreateConversationTx(ctx, tx, conversation); err != nil {
 			return err
@@ -191,6 +475,21 @@ func (s *chatService) StartConversation(
 		if err := s.repo.CreateChannelTx(ctx, tx, channel); err != nil {
 			return err
 		}
+		if message != nil {
+			message.ChannelID = sql.NullString{
+				channel.ID,
+				true,
+			}
+			message.ConversationID = conversation.ID
+			if err := s.repo.CreateMessageTx(ctx, tx, message); err != nil {
+				return err
+			}
+			if externalID := req.GetMessage().GetExternalId(); externalID != "" {
+				if err := s.repo.CreateMessageExternalIDTx(ctx, tx, message.ID, channel.ID, externalID); err != nil {
+					return err
+				}
+			}
+		}
 		res.ConversationId = conversation.ID
 		res.ChannelId = channel.ID
 		return nil
@@ -199,12 +498,11 @@ func (s *chatService) StartConversation(
 		return err
 	}
 	if !req.GetUser().GetInternal() {
-		profileID, err := strconv.ParseInt(req.GetUser().GetConnection(), 10, 64)
-		if err != nil {
-			return err
+		var reqMessage *pb.Message
+		if message != nil {
+			reqMessage = transformChatMessageFromRepoModel(message)
 		}
-		err = s.flowClient.Init(conversation.ID, profileID, req.GetDomainId(), nil)
-		if err != nil {
+		if err := s.flowClient.Init(conversation.ID, profileID, req.GetDomainId(), reqMessage, variables); err != nil {
 			return err
 		}
 	}
@@ -225,24 +523,43 @@ func (s *chatService) CloseConversation(
 	if conversationID == "" {
 		return errors.BadRequest("conversation_id not found", "")
 	}
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
 	if req.FromFlow {
-		// s.chatCache.DeleteCachedMessages(conversationID)
+		if err := authorizeService(user); err != nil {
+			s.log.Warn().Msg(err.Error())
+			return err
+		}
 		go func() {
+			s.chatCache.DeleteCachedMessages(conversationID)
 			s.chatCache.DeleteConfirmation(conversationID)
 			s.chatCache.DeleteConversationNode(conversationID)
+			s.chatCache.DeleteConversationStart(conversationID)
 		}()
-		if err := s.eventRouter.RouteCloseConversationFromFlow(&conversationID, req.GetCause()); err != nil {
+		if err := s.repo.WithTransaction(func(tx *sqlx.Tx) error {
+			if err := s.eventRouter.RouteCloseConversationFromFlow(tx, &conversationID, req.GetCause()); err != nil {
+				return err
+			}
+			return s.closeConversationTx(ctx, tx, conversationID)
+		}); err != nil {
 			s.log.Error().Msg(err.Error())
 			return err
 		}
-		return s.closeConversation(ctx, &conversationID)
+		return nil
 	}
 	closerChannel, err := s.repo.GetChannelByID(ctx, req.GetCloserChannelId())
 	if err != nil {
 		s.log.Error().Msg(err.Error())
 		return err
 	}
-	if err := s.eventRouter.RouteCloseConversation(closerChannel, req.GetCause()); err != nil {
+	if closerChannel == nil || closerChannel.ConversationID != conversationID {
+		s.log.Warn().Msg("channel not found")
+		return errors.BadRequest("channel not found", "")
+	}
+	if err := authorizeChannel(user, closerChannel); err != nil {
 		s.log.Warn().Msg(err.Error())
 		return err
 	}
@@ -251,7 +568,16 @@ func (s *chatService) CloseConversation(
 			return err
 		}
 	}
-	return s.closeConversation(ctx, &conversationID)
+	if err := s.repo.WithTransaction(func(tx *sqlx.Tx) error {
+		if err := s.eventRouter.RouteCloseConversation(tx, closerChannel, req.GetCause()); err != nil {
+			return err
+		}
+		return s.closeConversationTx(ctx, tx, conversationID)
+	}); err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	return nil
 }
 
 func (s *chatService) JoinConversation(
@@ -262,6 +588,11 @@ func (s *chatService) JoinConversation(
 	s.log.Trace().
 		Str("invite_id", req.GetInviteId()).
 		Msg("join conversation")
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
 	invite, err := s.repo.GetInviteByID(ctx, req.GetInviteId())
 	if err != nil {
 		s.log.Error().Msg(err.Error())
@@ -271,12 +602,24 @@ func (s *chatService) JoinConversation(
 		s.log.Warn().Msg("invitation not found")
 		return errors.BadRequest("invitation not found", "")
 	}
-	user, err := s.repo.GetWebitelUserByID(ctx, invite.UserID)
+	if err := authorizeInvite(user, invite); err != nil {
+		s.log.Warn().Msg(err.Error())
+		return err
+	}
+	if invite.ClosedAt.Valid {
+		s.log.Warn().Msg("invitation is closed")
+		return errors.BadRequest("invitation is closed", "")
+	}
+	if invite.ExpiresAt.Valid && !invite.ExpiresAt.Time.After(time.Now()) {
+		s.log.Warn().Msg("invitation is expired")
+		return errors.BadRequest("invitation is expired", "")
+	}
+	webitelUser, err := s.repo.GetWebitelUserByID(ctx, invite.UserID)
 	if err != nil {
 		s.log.Error().Msg(err.Error())
 		return err
 	}
-	if user == nil {
+	if webitelUser == nil {
 		s.log.Warn().Msg("user not found")
 		return errors.BadRequest("user not found", "")
 	}
@@ -286,7 +629,7 @@ func (s *chatService) JoinConversation(
 		ConversationID: invite.ConversationID,
 		UserID:         invite.UserID,
 		DomainID:       invite.DomainID,
-		Name:           user.Name,
+		Name:           webitelUser.Name,
 	}
 	if invite.InviterChannelID == (sql.NullString{}) {
 		channel.FlowBridge = true
@@ -298,16 +641,15 @@ func (s *chatService) JoinConversation(
 		if err := s.repo.CloseInviteTx(ctx, tx, req.GetInviteId()); err != nil {
 			return err
 		}
+		if err := s.eventRouter.RouteJoinConversation(tx, channel, &invite.ConversationID); err != nil {
+			return err
+		}
 		res.ChannelId = channel.ID
 		return nil
 	}); err != nil {
 		s.log.Error().Msg(err.Error())
 		return err
 	}
-	if err := s.eventRouter.RouteJoinConversation(channel, &invite.ConversationID); err != nil {
-		s.log.Warn().Msg(err.Error())
-		return err
-	}
 	return nil
 }
 
@@ -322,20 +664,40 @@ func (s *chatService) LeaveConversation(
 		Str("channel_id", channelID).
 		Str("conversation_id", conversationID).
 		Msg("leave conversation")
-	ch, err := s.repo.CloseChannel(ctx, channelID)
+	user, err := s.authClient.MicroAuthentication(&ctx)
 	if err != nil {
 		s.log.Error().Msg(err.Error())
 		return err
 	}
-	if ch.FlowBridge {
-		if err := s.flowClient.BreakBridge(conversationID, flow.LeaveConversationCause); err != nil {
-			return err
-		}
+	channel, err := s.repo.GetChannelByID(ctx, channelID)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
 	}
-	if err := s.eventRouter.RouteLeaveConversation(ch, &conversationID); err != nil {
+	if channel == nil || channel.ConversationID != conversationID {
+		s.log.Warn().Msg("channel not found")
+		return errors.BadRequest("channel not found", "")
+	}
+	if err := authorizeChannel(user, channel); err != nil {
 		s.log.Warn().Msg(err.Error())
 		return err
 	}
+	if err := s.repo.WithTransaction(func(tx *sqlx.Tx) error {
+		ch, err := s.repo.CloseChannelTx(ctx, tx, channelID)
+		if err != nil {
+			return err
+		}
+		if err := s.eventRouter.RouteLeaveConversation(tx, ch, &conversationID); err != nil {
+			return err
+		}
+		if channel.FlowBridge {
+			return queueBreakBridge(ctx, s.repo, tx, conversationID, flow.LeaveConversationCause)
+		}
+		return nil
+	}); err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
 	return nil
 }
 
@@ -359,7 +721,32 @@ func (s *chatService) InviteToConversation(
 		Int64("domain_id", req.GetDomainId()).
 		Int64("timeout_sec", req.GetTimeoutSec()).
 		Msg("invite to conversation")
-	domainID := req.GetDomainId()
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	if req.GetInviterChannelId() == "" {
+		if err := authorizeService(user); err != nil {
+			s.log.Warn().Msg(err.Error())
+			return err
+		}
+	} else {
+		inviter, err := s.repo.GetChannelByID(ctx, req.GetInviterChannelId())
+		if err != nil {
+			s.log.Error().Msg(err.Error())
+			return err
+		}
+		if inviter == nil || inviter.ConversationID != req.GetConversationId() {
+			s.log.Warn().Msg("channel not found")
+			return errors.BadRequest("channel not found", "")
+		}
+		if err := authorizeChannel(user, inviter); err != nil {
+			s.log.Warn().Msg(err.Error())
+			return err
+		}
+	}
+	domainID := user.Domain(req.GetDomainId())
 	invite := &pg.Invite{
 		ConversationID: req.GetConversationId(),
 		UserID:         req.GetUser().GetUserId(),
@@ -372,49 +759,27 @@ func (s *chatService) InviteToConversation(
 			true,
 		}
 	}
-	if err := s.repo.CreateInvite(ctx, invite); err != nil {
-		s.log.Error().Msg(err.Error())
-		return err
-	}
 	conversation, err := s.repo.GetConversationByID(ctx, req.GetConversationId())
 	if err != nil {
 		s.log.Error().Msg(err.Error())
 		return err
 	}
-	if err := s.eventRouter.SendInviteToWebitelUser(conversation, &domainID, &invite.ConversationID, &invite.UserID, &invite.ID); err != nil {
-		s.log.Warn().Msg(err.Error())
-		return err
+	if conversation == nil {
+		s.log.Warn().Msg("conversation not found")
+		return errors.BadRequest("conversation not found", "")
 	}
-	if err := s.eventRouter.RouteInvite(&invite.ConversationID, &invite.UserID); err != nil {
-		s.log.Warn().Msg(err.Error())
+	if err := s.repo.WithTransaction(func(tx *sqlx.Tx) error {
+		if err := s.repo.CreateInviteTx(ctx, tx, invite); err != nil {
+			return err
+		}
+		if err := s.eventRouter.SendInviteToWebitelUser(tx, conversation, &domainID, &invite.ConversationID, &invite.UserID, &invite.ID); err != nil {
+			return err
+		}
+		return s.eventRouter.RouteInvite(tx, &invite.ConversationID, &invite.UserID)
+	}); err != nil {
+		s.log.Error().Msg(err.Error())
 		return err
 	}
-	if req.GetTimeoutSec() != 0 {
-		go func() {
-			time.Sleep(time.Second * time.Duration(req.GetTimeoutSec()))
-			if val, err := s.repo.GetInviteByID(context.Background(), invite.ID); err != nil {
-				s.log.Error().Msg(err.Error())
-			} else if val != nil {
-				s.log.Trace().
-					Str("invite_id", invite.ID).
-					Int64("user_id", invite.UserID).
-					Str("conversation_id", invite.ConversationID).
-					Msg("autodecline invitation")
-				if req.GetInviterChannelId() == "" {
-					if err := s.flowClient.BreakBridge(req.GetConversationId(), flow.TimeoutCause); err != nil {
-						s.log.Error().Msg(err.Error())
-					}
-				}
-				if err := s.eventRouter.SendDeclineInviteToWebitelUser(&domainID, &invite.ConversationID, &invite.UserID, &invite.ID); err != nil {
-					s.log.Error().Msg(err.Error())
-				}
-				if err := s.repo.CloseInvite(context.Background(), val.ID); err != nil {
-					s.log.Error().Msg(err.Error())
-				}
-			}
-
-		}()
-	}
 	res.InviteId = invite.ID
 	return nil
 }
@@ -431,6 +796,11 @@ func (s *chatService) DeclineInvitation(
 		Str("conversation_id", conversationID).
 		Int64("user_id", userID).
 		Msg("decline invitation")
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
 	invite, err := s.repo.GetInviteByID(ctx, req.GetInviteId())
 	if err != nil {
 		s.log.Error().Msg(err.Error())
@@ -439,19 +809,29 @@ func (s *chatService) DeclineInvitation(
 	if invite == nil {
 		return errors.BadRequest("invite not found", "")
 	}
-	if invite.InviterChannelID == (sql.NullString{}) {
-		if err := s.flowClient.BreakBridge(invite.ConversationID, flow.DeclineInvitationCause); err != nil {
+	if err := authorizeInvite(user, invite); err != nil {
+		s.log.Warn().Msg(err.Error())
+		return err
+	}
+	if invite.ClosedAt.Valid {
+		return errors.BadRequest("invite is closed", "")
+	}
+	if err := s.repo.WithTransaction(func(tx *sqlx.Tx) error {
+		if err := s.repo.CloseInviteTx(ctx, tx, req.GetInviteId()); err != nil {
 			return err
 		}
-	}
-	if err := s.repo.CloseInvite(ctx, req.GetInviteId()); err != nil {
+		if err := s.eventRouter.RouteDeclineInvite(tx, &invite.UserID, &invite.ConversationID); err != nil {
+			return err
+		}
+		// the conversation is returned to the flow if the flow was waiting for the agent
+		if invite.InviterChannelID == (sql.NullString{}) {
+			return queueBreakBridge(ctx, s.repo, tx, invite.ConversationID, flow.DeclineInvitationCause)
+		}
+		return nil
+	}); err != nil {
 		s.log.Error().Msg(err.Error())
 		return err
 	}
-	if err := s.eventRouter.RouteDeclineInvite(&invite.UserID, &invite.ConversationID); err != nil {
-		s.log.Warn().Msg(err.Error())
-		return err
-	}
 	return nil
 }
 
@@ -460,34 +840,30 @@ func (s *chatService) WaitMessage(ctx context.Context, req *pb.WaitMessageReques
 		Str("conversation_id", req.GetConversationId()).
 		Str("confirmation_id", req.GetConfirmationId()).
 		Msg("accept confirmation")
-	// cachedMessages, err := s.chatCache.ReadCachedMessages(req.GetConversationId())
-	// if err != nil {
-	// 	s.log.Error().Msg(err.Error())
-	// 	return err
-	// }
-	// if cachedMessages != nil {
-	// 	messages := make([]*pb.Message, 0, len(cachedMessages))
-	// 	var tmp *pb.Message
-	// 	var err error
-	// 	s.log.Info().Msg("send cached messages")
-	// 	for _, m := range cachedMessages {
-	// 		err = proto.Unmarshal(m.Value, tmp)
-	// 		if err != nil {
-	// 			s.log.Error().Msg(err.Error())
-	// 			return err
-	// 		}
-	// 		messages = append(messages, tmp)
-	// 		s.chatCache.DeleteCachedMessage(m.Key)
-	// 	}
-	// 	res.Messages = messages
-	// 	s.chatCache.DeleteConfirmation(req.GetConversationId())
-	// 	res.TimeoutSec = int64(timeout)
-	// 	return nil
-	// }
-	if err := s.chatCache.WriteConfirmation(req.GetConversationId(), []byte(req.GetConfirmationId())); err != nil {
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
 		s.log.Error().Msg(err.Error())
 		return err
 	}
+	if err := authorizeService(user); err != nil {
+		s.log.Warn().Msg(err.Error())
+		return err
+	}
+	conversationID := req.GetConversationId()
+	// the buffered messages are taken or the confirmation is written atomically,
+	// so a message is passed either here or by the flow client
+	cachedMessages, err := s.chatCache.TakeCachedMessages(conversationID, []byte(req.GetConfirmationId()))
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	if len(cachedMessages) > 0 {
+		s.log.Debug().
+			Str("conversation_id", conversationID).
+			Int("count", len(cachedMessages)).
+			Msg("send cached messages")
+		res.Messages = cachedMessages
+	}
 	res.TimeoutSec = int64(timeout)
 	return nil
 }
@@ -496,14 +872,33 @@ func (s *chatService) CheckSession(ctx context.Context, req *pb.CheckSessionRequ
 	s.log.Trace().
 		Str("external_id", req.GetExternalId()).
 		Int64("profile_id", req.GetProfileId()).
+		Int64("domain_id", req.GetDomainId()).
 		Msg("check session")
-	client, err := s.repo.GetClientByExternalID(ctx, req.GetExternalId())
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	if err := authorizeService(user); err != nil {
+		s.log.Warn().Msg(err.Error())
+		return err
+	}
+	profile, err := s.repo.GetProfileByID(ctx, req.GetProfileId())
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	if profile == nil || profile.DomainID != req.GetDomainId() {
+		s.log.Error().Msg("profile not found")
+		return errors.BadRequest("profile not found", "")
+	}
+	client, err := s.repo.GetClientByExternalID(ctx, profile.Type, profile.ID, req.GetExternalId())
 	if err != nil {
 		s.log.Error().Msg(err.Error())
 		return err
 	}
 	if client == nil {
-		client, err = s.createClient(ctx, req)
+		client, err = s.createClient(ctx, req, profile.Type)
 		if err != nil {
 			s.log.Error().Msg(err.Error())
 			return err
@@ -518,18 +913,20 @@ func (s *chatService) CheckSession(ctx context.Context, req *pb.CheckSessionRequ
 		return err
 	}
 	externalBool := false
-	channel, err := s.repo.GetChannels(ctx, &client.ID, nil, &profileStr, &externalBool, nil)
+	channels, err := s.repo.GetChannels(ctx, &client.ID, nil, &profileStr, &externalBool, nil)
 	if err != nil {
 		s.log.Error().Msg(err.Error())
 		return err
 	}
-	if len(channel) > 0 {
-		res.Exists = true
-		res.ChannelId = channel[0].ID
-		res.ClientId = client.ID
-	} else {
-		res.Exists = false
-		res.ClientId = client.ID
+	res.ClientId = client.ID
+	res.Exists = false
+	// the session belongs to the domain of the profile the bot serves
+	for _, channel := range channels {
+		if channel.DomainID == req.GetDomainId() {
+			res.Exists = true
+			res.ChannelId = channel.ID
+			break
+		}
 	}
 	return nil
 }
@@ -538,7 +935,8 @@ func (s *chatService) GetConversationByID(ctx context.Context, req *pb.GetConver
 	s.log.Trace().
 		Str("conversation_id", req.GetId()).
 		Msg("get conversation by id")
-	if err := s.authClient.MicroAuthentication(&ctx); err != nil {
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
 		s.log.Error().Msg(err.Error())
 		return err
 	}
@@ -547,7 +945,7 @@ func (s *chatService) GetConversationByID(ctx context.Context, req *pb.GetConver
 		s.log.Error().Msg(err.Error())
 		return err
 	}
-	if conversation == nil {
+	if conversation == nil || !user.InDomain(conversation.DomainId) {
 		return nil
 	}
 	res.Item = conversation
@@ -558,18 +956,23 @@ func (s *chatService) GetConversations(ctx context.Context, req *pb.GetConversat
 	s.log.Trace().
 		Str("conversation_id", req.GetId()).
 		Msg("get conversations")
-	if err := s.authClient.MicroAuthentication(&ctx); err != nil {
+	if err := validatePage(req.GetSize(), req.GetPage()); err != nil {
+		s.log.Warn().Msg(err.Error())
+		return err
+	}
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
 		s.log.Error().Msg(err.Error())
 		return err
 	}
-	conversations, err := s.repo.GetConversations(
+	conversations, next, err := s.repo.GetConversations(
 		ctx,
 		req.GetId(),
 		req.GetSize(),
 		req.GetPage(),
 		req.GetFields(),
 		req.GetSort(),
-		req.GetDomainId(),
+		user.Domain(req.GetDomainId()),
 		req.GetActive(),
 		req.GetUserId(),
 	)
@@ -578,6 +981,8 @@ func (s *chatService) GetConversations(ctx context.Context, req *pb.GetConversat
 		return err
 	}
 	res.Items = conversations
+	res.Page = req.GetPage()
+	res.Next = next
 	return nil
 }
 
@@ -592,10 +997,15 @@ func (s *chatService) CreateProfile(
 		Int64("schema_id", req.GetItem().GetSchemaId()).
 		Str("variables", fmt.Sprintf("%v", req.GetItem().GetVariables())).
 		Msg("create profile")
-	if err := s.authClient.MicroAuthentication(&ctx); err != nil {
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
 		s.log.Error().Msg(err.Error())
 		return err
 	}
+	if !user.HasAccess(auth.ChatProfilesClass, auth.Create) {
+		return errors.Forbidden("access denied", "")
+	}
+	req.Item.DomainId = user.Domain(req.GetItem().GetDomainId())
 	result, err := transformProfileToRepoModel(req.GetItem())
 	if err != nil {
 		s.log.Error().Msg(err.Error())
@@ -625,15 +1035,19 @@ func (s *chatService) DeleteProfile(
 	s.log.Trace().
 		Int64("profile_id", req.GetId()).
 		Msg("delete profile")
-	if err := s.authClient.MicroAuthentication(&ctx); err != nil {
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
 		s.log.Error().Msg(err.Error())
 		return err
 	}
+	if !user.HasAccess(auth.ChatProfilesClass, auth.Delete) {
+		return errors.Forbidden("access denied", "")
+	}
 	profile, err := s.repo.GetProfileByID(ctx, req.GetId())
 	if err != nil {
 		s.log.Error().Msg(err.Error())
 		return err
-	} else if profile == nil {
+	} else if profile == nil || !user.InDomain(profile.DomainID) {
 		return errors.BadRequest("profile not found", "")
 	}
 	if err := s.repo.DeleteProfile(ctx, req.GetId()); err != nil {
@@ -658,10 +1072,22 @@ func (s *chatService) UpdateProfile(
 	s.log.Trace().
 		Str("update", "profile").
 		Msgf("%v", req.GetItem())
-	if err := s.authClient.MicroAuthentication(&ctx); err != nil {
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
 		s.log.Error().Msg(err.Error())
 		return err
 	}
+	if !user.HasAccess(auth.ChatProfilesClass, auth.Update) {
+		return errors.Forbidden("access denied", "")
+	}
+	current, err := s.repo.GetProfileByID(ctx, req.GetItem().GetId())
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	} else if current == nil || !user.InDomain(current.DomainID) {
+		return errors.BadRequest("profile not found", "")
+	}
+	req.Item.DomainId = user.Domain(req.GetItem().GetDomainId())
 	profile, err := transformProfileToRepoModel(req.GetItem())
 	if err != nil {
 		s.log.Error().Msg(err.Error())
@@ -680,11 +1106,19 @@ func (s *chatService) GetProfiles(ctx context.Context, req *pb.GetProfilesReques
 		Str("type", req.GetType()).
 		Int64("domain_id", req.GetDomainId()).
 		Msg("get profiles")
-	if err := s.authClient.MicroAuthentication(&ctx); err != nil {
+	if err := validatePage(req.GetSize(), req.GetPage()); err != nil {
+		s.log.Warn().Msg(err.Error())
+		return err
+	}
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
 		s.log.Error().Msg(err.Error())
 		return err
 	}
-	profiles, err := s.repo.GetProfiles(
+	if !user.HasAccess(auth.ChatProfilesClass, auth.Select) {
+		return errors.Forbidden("access denied", "")
+	}
+	profiles, next, err := s.repo.GetProfiles(
 		ctx,
 		req.GetId(),
 		req.GetSize(),
@@ -692,7 +1126,7 @@ func (s *chatService) GetProfiles(ctx context.Context, req *pb.GetProfilesReques
 		req.GetFields(),
 		req.GetSort(),
 		req.GetType(),
-		req.GetDomainId(),
+		user.Domain(req.GetDomainId()),
 	)
 	if err != nil {
 		s.log.Error().Msg(err.Error())
@@ -704,6 +1138,8 @@ func (s *chatService) GetProfiles(ctx context.Context, req *pb.GetProfilesReques
 		return err
 	}
 	res.Items = result
+	res.Page = req.GetPage()
+	res.Next = next
 	return nil
 }
 
@@ -711,14 +1147,20 @@ func (s *chatService) GetProfileByID(ctx context.Context, req *pb.GetProfileByID
 	s.log.Trace().
 		Int64("profile_id", req.GetId()).
 		Msg("get profile by id")
-	if err := s.authClient.MicroAuthentication(&ctx); err != nil {
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
 		s.log.Error().Msg(err.Error())
 		return err
 	}
+	if !user.HasAccess(auth.ChatProfilesClass, auth.Select) {
+		return errors.Forbidden("access denied", "")
+	}
 	profile, err := s.repo.GetProfileByID(ctx, req.GetId())
 	if err != nil {
 		s.log.Error().Msg(err.Error())
 		return err
+	} else if profile == nil || !user.InDomain(profile.DomainID) {
+		return errors.BadRequest("profile not found", "")
 	}
 	result, err := transformProfileFromRepoModel(profile)
 	if err != nil {
@@ -733,11 +1175,29 @@ func (s *chatService) GetHistoryMessages(ctx context.Context, req *pb.GetHistory
 	s.log.Trace().
 		Str("conversation_id", req.GetConversationId()).
 		Msg("get history")
-	if err := s.authClient.MicroAuthentication(&ctx); err != nil {
+	if err := validatePage(req.GetSize(), req.GetPage()); err != nil {
+		s.log.Warn().Msg(err.Error())
+		return err
+	}
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	conversation, err := s.repo.GetConversationByID(ctx, req.GetConversationId())
+	if err != nil {
 		s.log.Error().Msg(err.Error())
 		return err
 	}
-	messages, err := s.repo.GetMessages(
+	if conversation == nil {
+		s.log.Warn().Msg("conversation not found")
+		return errors.BadRequest("conversation not found", "")
+	}
+	if err := authorizeConversation(user, conversation); err != nil {
+		s.log.Warn().Msg(err.Error())
+		return err
+	}
+	messages, next, err := s.repo.GetMessages(
 		ctx,
 		req.GetId(),
 		req.GetSize(),
@@ -745,11 +1205,368 @@ func (s *chatService) GetHistoryMessages(ctx context.Context, req *pb.GetHistory
 		req.GetFields(),
 		req.GetSort(),
 		req.GetConversationId(),
+		user.Domain(0),
 	)
 	if err != nil {
 		s.log.Error().Msg(err.Error())
 		return err
 	}
 	res.Items = transformMessagesFromRepoModel(messages)
+	res.Page = req.GetPage()
+	res.Next = next
+	return nil
+}
+
+// GetConversationEvents replays the events sent to the conversation members after the sequence number
+func (s *chatService) GetConversationEvents(ctx context.Context, req *pb.GetConversationEventsRequest, res *pb.GetConversationEventsResponse) error {
+	s.log.Trace().
+		Str("conversation_id", req.GetConversationId()).
+		Int64("after_seq", req.GetAfterSeq()).
+		Msg("get conversation events")
+	if err := validatePage(req.GetSize(), 0); err != nil {
+		s.log.Warn().Msg(err.Error())
+		return err
+	}
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	conversation, err := s.repo.GetConversationByID(ctx, req.GetConversationId())
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	if conversation == nil {
+		s.log.Warn().Msg("conversation not found")
+		return errors.BadRequest("conversation not found", "")
+	}
+	if err := authorizeConversation(user, conversation); err != nil {
+		s.log.Warn().Msg(err.Error())
+		return err
+	}
+	events, next, err := s.repo.GetConversationEvents(ctx, req.GetConversationId(), req.GetAfterSeq(), req.GetSize())
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	res.Items = transformConversationEventsFromRepoModel(events)
+	res.Next = next
+	return nil
+}
+
+// GetMessageEdits returns the texts of the message before every edit
+func (s *chatService) GetMessageEdits(ctx context.Context, req *pb.GetMessageEditsRequest, res *pb.GetMessageEditsResponse) error {
+	s.log.Trace().
+		Int64("message_id", req.GetMessageId()).
+		Msg("get message edits")
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	message, err := s.repo.GetMessageByID(ctx, req.GetMessageId())
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	if message == nil {
+		s.log.Warn().Msg("message not found")
+		return errors.BadRequest("message not found", "")
+	}
+	conversation, err := s.repo.GetConversationByID(ctx, message.ConversationID)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	if conversation == nil {
+		s.log.Warn().Msg("conversation not found")
+		return errors.BadRequest("conversation not found", "")
+	}
+	if err := authorizeConversation(user, conversation); err != nil {
+		s.log.Warn().Msg(err.Error())
+		return err
+	}
+	if message.DeletedAt.Valid {
+		res.Items = []*pb.MessageEdit{}
+		return nil
+	}
+	edits, err := s.repo.GetMessageEdits(ctx, message.ID)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	res.Items = transformMessageEditsFromRepoModel(edits)
+	return nil
+}
+
+// GetMessageStatuses returns the delivery states of the message for the recipients
+func (s *chatService) GetMessageStatuses(ctx context.Context, req *pb.GetMessageStatusesRequest, res *pb.GetMessageStatusesResponse) error {
+	s.log.Trace().
+		Int64("message_id", req.GetMessageId()).
+		Msg("get message statuses")
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	message, err := s.repo.GetMessageByID(ctx, req.GetMessageId())
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	if message == nil {
+		s.log.Warn().Msg("message not found")
+		return errors.BadRequest("message not found", "")
+	}
+	conversation, err := s.repo.GetConversationByID(ctx, message.ConversationID)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	if conversation == nil {
+		s.log.Warn().Msg("conversation not found")
+		return errors.BadRequest("conversation not found", "")
+	}
+	if err := authorizeConversation(user, conversation); err != nil {
+		s.log.Warn().Msg(err.Error())
+		return err
+	}
+	statuses, err := s.repo.GetMessageStatuses(ctx, message.ID)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	res.Items = transformMessageStatusesFromRepoModel(statuses)
+	return nil
+}
+
+func (s *chatService) GetWebhooks(ctx context.Context, req *pb.GetWebhooksRequest, res *pb.GetWebhooksResponse) error {
+	s.log.Trace().
+		Int64("domain_id", req.GetDomainId()).
+		Msg("get webhooks")
+	if err := validatePage(req.GetSize(), req.GetPage()); err != nil {
+		s.log.Warn().Msg(err.Error())
+		return err
+	}
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	if !user.HasAccess(auth.ChatWebhooksClass, auth.Select) {
+		return errors.Forbidden("access denied", "")
+	}
+	webhooks, next, err := s.repo.GetWebhooks(
+		ctx,
+		req.GetId(),
+		req.GetSize(),
+		req.GetPage(),
+		req.GetFields(),
+		req.GetSort(),
+		user.Domain(req.GetDomainId()),
+	)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	res.Items = transformWebhooksFromRepoModel(webhooks)
+	res.Page = req.GetPage()
+	res.Next = next
+	return nil
+}
+
+func (s *chatService) GetWebhookByID(ctx context.Context, req *pb.GetWebhookByIDRequest, res *pb.GetWebhookByIDResponse) error {
+	s.log.Trace().
+		Int64("webhook_id", req.GetId()).
+		Msg("get webhook by id")
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	if !user.HasAccess(auth.ChatWebhooksClass, auth.Select) {
+		return errors.Forbidden("access denied", "")
+	}
+	webhook, err := s.getWebhook(ctx, user, req.GetId())
+	if err != nil {
+		return err
+	}
+	res.Item = transformWebhookFromRepoModel(webhook)
+	return nil
+}
+
+func (s *chatService) CreateWebhook(ctx context.Context, req *pb.CreateWebhookRequest, res *pb.CreateWebhookResponse) error {
+	s.log.Trace().
+		Str("url", req.GetItem().GetUrl()).
+		Strs("event_types", req.GetItem().GetEventTypes()).
+		Int64("domain_id", req.GetItem().GetDomainId()).
+		Msg("create webhook")
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	if !user.HasAccess(auth.ChatWebhooksClass, auth.Create) {
+		return errors.Forbidden("access denied", "")
+	}
+	if err := validateWebhook(req.GetItem()); err != nil {
+		return err
+	}
+	webhook := transformWebhookToRepoModel(req.GetItem())
+	webhook.DomainID = user.Domain(req.GetItem().GetDomainId())
+	if webhook.Secret == "" {
+		webhook.Secret = newWebhookSecret()
+	}
+	if err := s.repo.CreateWebhook(ctx, webhook); err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	res.Item = transformWebhookFromRepoModel(webhook)
+	res.Item.Secret = webhook.Secret
+	return nil
+}
+
+func (s *chatService) UpdateWebhook(ctx context.Context, req *pb.UpdateWebhookRequest, res *pb.UpdateWebhookResponse) error {
+	s.log.Trace().
+		Int64("webhook_id", req.GetItem().GetId()).
+		Str("url", req.GetItem().GetUrl()).
+		Strs("event_types", req.GetItem().GetEventTypes()).
+		Bool("enabled", req.GetItem().GetEnabled()).
+		Msg("update webhook")
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	if !user.HasAccess(auth.ChatWebhooksClass, auth.Update) {
+		return errors.Forbidden("access denied", "")
+	}
+	if _, err := s.getWebhook(ctx, user, req.GetItem().GetId()); err != nil {
+		return err
+	}
+	if err := validateWebhook(req.GetItem()); err != nil {
+		return err
+	}
+	webhook := transformWebhookToRepoModel(req.GetItem())
+	if err := s.repo.UpdateWebhook(ctx, webhook); err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	res.Item = transformWebhookFromRepoModel(webhook)
+	return nil
+}
+
+func (s *chatService) DeleteWebhook(ctx context.Context, req *pb.DeleteWebhookRequest, res *pb.DeleteWebhookResponse) error {
+	s.log.Trace().
+		Int64("webhook_id", req.GetId()).
+		Msg("delete webhook")
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	if !user.HasAccess(auth.ChatWebhooksClass, auth.Delete) {
+		return errors.Forbidden("access denied", "")
+	}
+	webhook, err := s.getWebhook(ctx, user, req.GetId())
+	if err != nil {
+		return err
+	}
+	if err := s.repo.DeleteWebhook(ctx, req.GetId()); err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	res.Item = transformWebhookFromRepoModel(webhook)
+	return nil
+}
+
+// GetWebhookDeliveries returns the delivery log of the webhook, the newest first
+func (s *chatService) GetWebhookDeliveries(ctx context.Context, req *pb.GetWebhookDeliveriesRequest, res *pb.GetWebhookDeliveriesResponse) error {
+	s.log.Trace().
+		Int64("webhook_id", req.GetWebhookId()).
+		Str("status", req.GetStatus()).
+		Msg("get webhook deliveries")
+	if err := validatePage(req.GetSize(), req.GetPage()); err != nil {
+		s.log.Warn().Msg(err.Error())
+		return err
+	}
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	if !user.HasAccess(auth.ChatWebhooksClass, auth.Select) {
+		return errors.Forbidden("access denied", "")
+	}
+	if _, err := s.getWebhook(ctx, user, req.GetWebhookId()); err != nil {
+		return err
+	}
+	deliveries, next, err := s.repo.GetWebhookDeliveries(ctx, req.GetWebhookId(), req.GetStatus(), req.GetSize(), req.GetPage())
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	res.Items = transformWebhookDeliveriesFromRepoModel(deliveries)
+	res.Page = req.GetPage()
+	res.Next = next
+	return nil
+}
+
+// GetDomainSetting returns the idle timeout and the closing message used by the profiles without their own
+func (s *chatService) GetDomainSetting(ctx context.Context, req *pb.GetDomainSettingRequest, res *pb.GetDomainSettingResponse) error {
+	s.log.Trace().
+		Int64("domain_id", req.GetDomainId()).
+		Msg("get domain setting")
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	if !user.HasAccess(auth.ChatProfilesClass, auth.Select) {
+		return errors.Forbidden("access denied", "")
+	}
+	domainID := user.Domain(req.GetDomainId())
+	if domainID == 0 {
+		return errors.BadRequest("domain not found", "")
+	}
+	setting, err := s.repo.GetDomainSetting(ctx, domainID)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	res.Item = transformDomainSettingFromRepoModel(setting)
+	return nil
+}
+
+func (s *chatService) UpdateDomainSetting(ctx context.Context, req *pb.UpdateDomainSettingRequest, res *pb.UpdateDomainSettingResponse) error {
+	s.log.Trace().
+		Int64("domain_id", req.GetItem().GetDomainId()).
+		Int64("idle_timeout_sec", req.GetItem().GetIdleTimeoutSec()).
+		Msg("update domain setting")
+	user, err := s.authClient.MicroAuthentication(&ctx)
+	if err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	if !user.HasAccess(auth.ChatProfilesClass, auth.Update) {
+		return errors.Forbidden("access denied", "")
+	}
+	setting := &pg.DomainSetting{
+		DomainID:       user.Domain(req.GetItem().GetDomainId()),
+		IdleTimeoutSec: req.GetItem().GetIdleTimeoutSec(),
+		ClosingMessage: req.GetItem().GetClosingMessage(),
+	}
+	if setting.DomainID == 0 {
+		return errors.BadRequest("domain not found", "")
+	}
+	if setting.IdleTimeoutSec < 0 {
+		return errors.BadRequest("idle timeout must not be negative", "")
+	}
+	if err := s.repo.UpdateDomainSetting(ctx, setting); err != nil {
+		s.log.Error().Msg(err.Error())
+		return err
+	}
+	res.Item = transformDomainSettingFromRepoModel(setting)
 	return nil
 }
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	pbbot "github.com/matvoy/chat_server/api/proto/bot"
+	event "github.com/matvoy/chat_server/internal/event_router"
+	"github.com/matvoy/chat_server/internal/flow"
+	pg "github.com/matvoy/chat_server/internal/repo/sqlx"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	taskRelayInterval = time.Second
+	taskRelayBatch    = 50
+	taskRelayWorkers  = 10
+	// taskLease must cover the calls of the batch, so the tasks are not claimed twice
+	taskLease = time.Minute
+	// taskMaxAttempts is the number of attempts before the bot task fails, the flow tasks are retried until done
+	taskMaxAttempts = 5
+	// taskRetention is the time the finished tasks are kept for troubleshooting
+	taskRetention       = 24 * time.Hour
+	taskCleanupInterval = time.Hour
+)
+
+// TaskRelay makes the calls to the bot and flow services queued in chat.outbox_task,
+// so they are not made inside the transactions of the changes.
+// The tasks of a channel run in order, the failed ones are retried with the outbox backoff.
+type TaskRelay interface {
+	Start()
+	Stop()
+}
+
+type taskRelay struct {
+	repo        pg.Repository
+	log         *zerolog.Logger
+	botClient   pbbot.BotService
+	flowClient  flow.Client
+	eventRouter event.Router
+	stop        chan struct{}
+	wg          sync.WaitGroup
+}
+
+func NewTaskRelay(
+	repo pg.Repository,
+	log *zerolog.Logger,
+	botClient pbbot.BotService,
+	flowClient flow.Client,
+	eventRouter event.Router,
+) TaskRelay {
+	return &taskRelay{
+		repo:        repo,
+		log:         log,
+		botClient:   botClient,
+		flowClient:  flowClient,
+		eventRouter: eventRouter,
+		stop:        make(chan struct{}),
+	}
+}
+
+func (r *taskRelay) Start() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(taskRelayInterval)
+		defer ticker.Stop()
+		cleanedAt := time.Time{}
+		for {
+			r.relay()
+			if time.Since(cleanedAt) > taskCleanupInterval {
+				r.cleanup()
+				cleanedAt = time.Now()
+			}
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (r *taskRelay) Stop() {
+	close(r.stop)
+	r.wg.Wait()
+}
+
+// relay runs the batches until no task is ready,
+// the next task of a channel is claimed only after the previous one is done
+func (r *taskRelay) relay() {
+	for {
+		tasks, err := r.repo.ClaimOutboxTasks(context.Background(), taskRelayBatch, taskLease)
+		if err != nil {
+			r.log.Error().Msg(err.Error())
+			return
+		}
+		if len(tasks) == 0 {
+			return
+		}
+		queue := make(chan *pg.OutboxTask)
+		var wg sync.WaitGroup
+		for i := 0; i < taskRelayWorkers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for task := range queue {
+					r.run(task)
+				}
+			}()
+		}
+		for _, task := range tasks {
+			queue <- task
+		}
+		close(queue)
+		wg.Wait()
+	}
+}
+
+func (r *taskRelay) run(task *pg.OutboxTask) {
+	err := r.call(task)
+	if err == nil {
+		if err := r.repo.MarkOutboxTaskDone(context.Background(), task.ID, ""); err != nil {
+			r.log.Error().Msg(err.Error())
+		}
+		return
+	}
+	if task.Attempts >= taskMaxAttempts && !isFlowTask(task.Kind) {
+		r.log.Error().
+			Int64("task_id", task.ID).
+			Str("kind", task.Kind).
+			Str("conversation_id", task.ConversationID).
+			Int("attempts", task.Attempts).
+			Msg(err.Error())
+		r.fail(task, err)
+		return
+	}
+	retryAt := time.Now().Add(outboxBackoff(task.Attempts))
+	r.log.Warn().
+		Int64("task_id", task.ID).
+		Str("kind", task.Kind).
+		Str("conversation_id", task.ConversationID).
+		Int("attempts", task.Attempts).
+		Time("retry_at", retryAt).
+		Msg(err.Error())
+	if err := r.repo.RetryOutboxTask(context.Background(), task.ID, retryAt, err.Error()); err != nil {
+		r.log.Error().Msg(err.Error())
+	}
+}
+
+func (r *taskRelay) call(task *pg.OutboxTask) error {
+	switch task.Kind {
+	case pg.OutboxTaskBotSendMessage:
+		return r.sendMessage(task)
+	case pg.OutboxTaskBotEditMessage:
+		return r.editMessage(task)
+	case pg.OutboxTaskBotDeleteMessage:
+		return r.deleteMessage(task)
+	case pg.OutboxTaskFlowBreakBridge:
+		return r.breakBridge(task)
+	case pg.OutboxTaskFlowCloseConversation:
+		return r.flowClient.CloseConversation(task.ConversationID)
+	default:
+		return fmt.Errorf("unknown task kind: %s", task.Kind)
+	}
+}
+
+// sendMessage records the id of the message in the external messenger and the sent status
+func (r *taskRelay) sendMessage(task *pg.OutboxTask) error {
+	req := &pbbot.SendMessageRequest{}
+	if err := proto.Unmarshal(task.Body, req); err != nil {
+		return err
+	}
+	res, err := r.botClient.SendMessage(context.Background(), req)
+	if err != nil {
+		return err
+	}
+	if !task.MessageID.Valid {
+		return nil
+	}
+	return r.repo.WithTransaction(func(tx *sqlx.Tx) error {
+		if externalID := res.GetExternalMessageId(); externalID != "" {
+			if err := r.repo.CreateMessageExternalIDTx(context.Background(), tx, task.MessageID.Int64, task.ChannelID.String, externalID); err != nil {
+				return err
+			}
+		}
+		return r.repo.CreateMessageStatusTx(context.Background(), tx, &pg.MessageStatus{
+			MessageID: task.MessageID.Int64,
+			ChannelID: task.ChannelID.String,
+			Status:    pg.MessageStatusSent,
+		})
+	})
+}
+
+// editMessage changes the sent message, the messages without the recorded external id are skipped
+func (r *taskRelay) editMessage(task *pg.OutboxTask) error {
+	req := &pbbot.EditMessageRequest{}
+	if err := proto.Unmarshal(task.Body, req); err != nil {
+		return err
+	}
+	externalMessageID, err := r.repo.GetMessageExternalID(context.Background(), task.MessageID.Int64, task.ChannelID.String)
+	if err != nil || externalMessageID == "" {
+		return err
+	}
+	req.ExternalMessageId = externalMessageID
+	_, err = r.botClient.EditMessage(context.Background(), req)
+	return err
+}
+
+func (r *taskRelay) deleteMessage(task *pg.OutboxTask) error {
+	req := &pbbot.DeleteMessageRequest{}
+	if err := proto.Unmarshal(task.Body, req); err != nil {
+		return err
+	}
+	externalMessageID, err := r.repo.GetMessageExternalID(context.Background(), task.MessageID.Int64, task.ChannelID.String)
+	if err != nil || externalMessageID == "" {
+		return err
+	}
+	req.ExternalMessageId = externalMessageID
+	_, err = r.botClient.DeleteMessage(context.Background(), req)
+	return err
+}
+
+// breakBridge returns the conversation to the flow, the closed conversations are skipped
+func (r *taskRelay) breakBridge(task *pg.OutboxTask) error {
+	cause, err := flow.ParseBreakBridgeCause(string(task.Body))
+	if err != nil {
+		return err
+	}
+	conversation, err := r.repo.GetConversationByID(context.Background(), task.ConversationID)
+	if err != nil {
+		return err
+	}
+	if conversation == nil || conversation.ClosedAt != 0 {
+		return nil
+	}
+	return r.flowClient.BreakBridge(task.ConversationID, cause)
+}
+
+// queueBreakBridge writes the return of the conversation to the flow in the transaction of the change
+func queueBreakBridge(ctx context.Context, repo pg.Repository, tx *sqlx.Tx, conversationID string, cause flow.BreakBridgeCause) error {
+	return repo.CreateOutboxTaskTx(ctx, tx, &pg.OutboxTask{
+		Kind:           pg.OutboxTaskFlowBreakBridge,
+		ConversationID: conversationID,
+		Body:           []byte(cause.String()),
+	})
+}
+
+// queueCloseConversation writes the stop of the flow in the transaction which closed the conversation
+func queueCloseConversation(ctx context.Context, repo pg.Repository, tx *sqlx.Tx, conversationID string) error {
+	return repo.CreateOutboxTaskTx(ctx, tx, &pg.OutboxTask{
+		Kind:           pg.OutboxTaskFlowCloseConversation,
+		ConversationID: conversationID,
+		Body:           []byte{},
+	})
+}
+
+// isFlowTask reports whether the task is the call to the flow, the flow must get it whatever the attempts
+func isFlowTask(kind string) bool {
+	return kind == pg.OutboxTaskFlowBreakBridge || kind == pg.OutboxTaskFlowCloseConversation
+}
+
+// fail finishes the task after the last attempt,
+// the members are notified about the message which was not sent
+func (r *taskRelay) fail(task *pg.OutboxTask, cause error) {
+	if task.Kind == pg.OutboxTaskBotSendMessage && task.MessageID.Valid {
+		if err := r.repo.WithTransaction(func(tx *sqlx.Tx) error {
+			return r.saveFailure(tx, task, cause)
+		}); err != nil {
+			r.log.Error().Msg(err.Error())
+			return
+		}
+	}
+	if err := r.repo.MarkOutboxTaskDone(context.Background(), task.ID, cause.Error()); err != nil {
+		r.log.Error().Msg(err.Error())
+	}
+}
+
+func (r *taskRelay) saveFailure(tx *sqlx.Tx, task *pg.OutboxTask, cause error) error {
+	channel, err := r.repo.GetChannelByIDTx(context.Background(), tx, task.ChannelID.String)
+	if err != nil {
+		return err
+	}
+	if channel == nil {
+		return nil
+	}
+	status := &pg.MessageStatus{
+		MessageID: task.MessageID.Int64,
+		ChannelID: channel.ID,
+		Status:    pg.MessageStatusFailed,
+		Cause: sql.NullString{
+			cause.Error(),
+			true,
+		},
+		UpdatedAt: time.Now(),
+	}
+	if err := r.repo.CreateMessageStatusTx(context.Background(), tx, status); err != nil {
+		return err
+	}
+	return r.eventRouter.RouteMessageStatus(tx, channel, status)
+}
+
+func (r *taskRelay) cleanup() {
+	if err := r.repo.DeleteDoneOutboxTasks(context.Background(), time.Now().Add(-taskRetention)); err != nil {
+		r.log.Error().Msg(err.Error())
+	}
+}
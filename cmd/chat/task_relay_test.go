@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	pb "github.com/matvoy/chat_server/api/proto/chat"
+	"github.com/matvoy/chat_server/internal/flow"
+	pg "github.com/matvoy/chat_server/internal/repo/sqlx"
+
+	"github.com/rs/zerolog"
+)
+
+// fakeTaskRepository records how the relay finished the task
+type fakeTaskRepository struct {
+	pg.Repository
+	doneCause string
+	done      bool
+	retryAt   time.Time
+}
+
+func (r *fakeTaskRepository) GetConversationByID(ctx context.Context, id string) (*pb.Conversation, error) {
+	return &pb.Conversation{
+		Id: id,
+	}, nil
+}
+
+func (r *fakeTaskRepository) MarkOutboxTaskDone(ctx context.Context, id int64, cause string) error {
+	r.done = true
+	r.doneCause = cause
+	return nil
+}
+
+func (r *fakeTaskRepository) RetryOutboxTask(ctx context.Context, id int64, retryAt time.Time, cause string) error {
+	r.retryAt = retryAt
+	return nil
+}
+
+// fakeFlowClient fails the calls to the flow
+type fakeFlowClient struct {
+	flow.Client
+	err error
+}
+
+func (c *fakeFlowClient) BreakBridge(conversationID string, cause flow.BreakBridgeCause) error {
+	return c.err
+}
+
+func TestTaskRelayRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		task     *pg.OutboxTask
+		flowErr  error
+		done     bool
+		failed   bool
+		attempts int
+	}{
+		{
+			name: "done task",
+			task: &pg.OutboxTask{
+				Kind:     pg.OutboxTaskFlowBreakBridge,
+				Body:     []byte(flow.TimeoutCause.String()),
+				Attempts: 1,
+			},
+			done: true,
+		},
+		{
+			name: "failed task is retried",
+			task: &pg.OutboxTask{
+				Kind:     pg.OutboxTaskBotDeleteMessage,
+				Body:     []byte{0xff},
+				Attempts: 2,
+			},
+			attempts: 2,
+		},
+		{
+			name: "bot task fails after the last attempt",
+			task: &pg.OutboxTask{
+				Kind:     pg.OutboxTaskBotDeleteMessage,
+				Body:     []byte{0xff},
+				Attempts: taskMaxAttempts,
+			},
+			done:   true,
+			failed: true,
+		},
+		{
+			name: "flow task is retried after the last attempt",
+			task: &pg.OutboxTask{
+				Kind:     pg.OutboxTaskFlowBreakBridge,
+				Body:     []byte(flow.TimeoutCause.String()),
+				Attempts: taskMaxAttempts + 10,
+			},
+			flowErr:  fmt.Errorf("flow is unavailable"),
+			attempts: taskMaxAttempts + 10,
+		},
+		{
+			name: "unknown task is retried",
+			task: &pg.OutboxTask{
+				Kind:     "unknown",
+				Attempts: 1,
+			},
+			attempts: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo := &fakeTaskRepository{}
+			log := zerolog.Nop()
+			r := &taskRelay{
+				repo: repo,
+				log:  &log,
+				flowClient: &fakeFlowClient{
+					err: test.flowErr,
+				},
+			}
+			start := time.Now()
+			r.run(test.task)
+			if repo.done != test.done {
+				t.Fatalf("expected done %v, got %v", test.done, repo.done)
+			}
+			if failed := repo.doneCause != ""; failed != test.failed {
+				t.Errorf("expected failed %v, got %v", test.failed, failed)
+			}
+			if test.done {
+				if !repo.retryAt.IsZero() {
+					t.Error("done task is retried")
+				}
+				return
+			}
+			backoff := outboxBackoff(test.attempts)
+			if repo.retryAt.Before(start.Add(backoff)) || repo.retryAt.After(time.Now().Add(backoff)) {
+				t.Errorf("expected the retry after %v, got %v", backoff, repo.retryAt.Sub(start))
+			}
+		})
+	}
+}
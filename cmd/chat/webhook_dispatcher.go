@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	pg "github.com/matvoy/chat_server/internal/repo/sqlx"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	webhookDispatchInterval = time.Second
+	webhookDispatchBatch    = 20
+	webhookDispatchWorkers  = 10
+	webhookRequestTimeout   = 10 * time.Second
+	// webhookLease must cover the batch sent by the workers, so the deliveries are not claimed twice
+	webhookLease = time.Minute
+	// webhookMaxAttempts is the number of attempts before the delivery is dead
+	webhookMaxAttempts = 10
+	// webhookMaxBackoff limits the exponential delay between the attempts
+	webhookMaxBackoff = time.Hour
+	// webhookRetention is the time the finished deliveries are kept for the delivery log
+	webhookRetention       = 7 * 24 * time.Hour
+	webhookCleanupInterval = time.Hour
+)
+
+// Webhook requests are signed with the secret of the webhook:
+// signature = hex(hmac-sha256(secret, timestamp + "." + body))
+const (
+	hdrWebhookEvent     = `X-Webitel-Event`
+	hdrWebhookDelivery  = `X-Webitel-Delivery`
+	hdrWebhookTimestamp = `X-Webitel-Timestamp`
+	hdrWebhookSignature = `X-Webitel-Signature`
+)
+
+// WebhookDispatcher posts the queued events to the webhooks of the domains.
+// Failed deliveries are retried with the exponential backoff until webhookMaxAttempts.
+type WebhookDispatcher interface {
+	Start()
+	Stop()
+}
+
+type webhookDispatcher struct {
+	repo   pg.Repository
+	log    *zerolog.Logger
+	client *http.Client
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func NewWebhookDispatcher(
+	repo pg.Repository,
+	log *zerolog.Logger,
+) WebhookDispatcher {
+	return &webhookDispatcher{
+		repo: repo,
+		log:  log,
+		client: &http.Client{
+			Timeout: webhookRequestTimeout,
+			Transport: &http.Transport{
+				// the proxy would hide the address of the webhook from the dialer
+				Proxy: nil,
+				DialContext: (&net.Dialer{
+					Timeout: webhookRequestTimeout,
+					Control: webhookDialControl,
+				}).DialContext,
+				TLSHandshakeTimeout: webhookRequestTimeout,
+				MaxIdleConnsPerHost: webhookDispatchWorkers,
+				IdleConnTimeout:     90 * time.Second,
+			},
+			// the redirect could lead to the internal address, it fails the delivery
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		stop: make(chan struct{}),
+	}
+}
+
+func (d *webhookDispatcher) Start() {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		ticker := time.NewTicker(webhookDispatchInterval)
+		defer ticker.Stop()
+		cleanedAt := time.Time{}
+		for {
+			d.dispatch()
+			if time.Since(cleanedAt) > webhookCleanupInterval {
+				d.cleanup()
+				cleanedAt = time.Now()
+			}
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (d *webhookDispatcher) Stop() {
+	close(d.stop)
+	d.wg.Wait()
+}
+
+func (d *webhookDispatcher) dispatch() {
+	for {
+		deliveries, err := d.repo.ClaimWebhookDeliveries(context.Background(), webhookDispatchBatch, webhookLease)
+		if err != nil {
+			d.log.Error().Msg(err.Error())
+			return
+		}
+		queue := make(chan *pg.WebhookDispatch)
+		var wg sync.WaitGroup
+		for i := 0; i < webhookDispatchWorkers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for delivery := range queue {
+					d.deliver(delivery)
+				}
+			}()
+		}
+		for _, delivery := range deliveries {
+			queue <- delivery
+		}
+		close(queue)
+		wg.Wait()
+		if len(deliveries) < webhookDispatchBatch {
+			return
+		}
+	}
+}
+
+func (d *webhookDispatcher) deliver(delivery *pg.WebhookDispatch) {
+	started := time.Now()
+	statusCode, err := d.post(delivery)
+	attempt := &pg.WebhookDeliveryLog{
+		DeliveryID: delivery.ID,
+		Attempt:    delivery.Attempts,
+		StatusCode: statusCode,
+		DurationMs: time.Since(started).Milliseconds(),
+	}
+	result := &delivery.WebhookDelivery
+	result.LastStatusCode = statusCode
+	switch {
+	case err == nil:
+		result.Status = pg.WebhookDeliverySent
+		result.LastError = ""
+		result.SentAt = sql.NullTime{
+			time.Now(),
+			true,
+		}
+	case delivery.Attempts >= webhookMaxAttempts:
+		result.Status = pg.WebhookDeliveryDead
+	default:
+		result.NextAttemptAt = time.Now().Add(webhookBackoff(delivery.Attempts))
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+		result.LastError = err.Error()
+		d.log.Warn().
+			Int64("delivery_id", delivery.ID).
+			Int64("webhook_id", delivery.WebhookID).
+			Str("event_type", delivery.EventType).
+			Int("attempts", delivery.Attempts).
+			Str("status", result.Status).
+			Msg(err.Error())
+	}
+	if err := d.repo.SaveWebhookDeliveryAttempt(context.Background(), result, attempt); err != nil {
+		d.log.Error().Msg(err.Error())
+	}
+}
+
+func (d *webhookDispatcher) cleanup() {
+	if err := d.repo.DeleteWebhookDeliveries(context.Background(), time.Now().Add(-webhookRetention)); err != nil {
+		d.log.Error().Msg(err.Error())
+	}
+}
+
+// post sends the delivery, any status except 2xx is an error
+func (d *webhookDispatcher) post(delivery *pg.WebhookDispatch) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(hdrWebhookEvent, delivery.EventType)
+	req.Header.Set(hdrWebhookDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(hdrWebhookTimestamp, timestamp)
+	req.Header.Set(hdrWebhookSignature, signWebhook([]byte(delivery.Secret), timestamp, delivery.Body))
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	// drain the body to reuse the connection
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64*1024))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected status: %v", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+// webhookDialControl allows the connections to the public addresses only,
+// it is checked after the name is resolved, so the DNS of the webhook cannot point to the internal services
+func webhookDialControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("webhook address is not allowed: %s", host)
+	}
+	return nil
+}
+
+// privateNetworks are the ranges not routed in the internet
+var privateNetworks = parseNetworks(
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"100.64.0.0/10",
+	"fc00::/7",
+)
+
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+func signWebhook(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff is 10s, 20s, 40s... for the attempts made, up to webhookMaxBackoff
+func webhookBackoff(attempts int) time.Duration {
+	if attempts < 1 {
+		return 10 * time.Second
+	}
+	if attempts > 16 {
+		return webhookMaxBackoff
+	}
+	if backoff := (10 * time.Second) << uint(attempts-1); backoff < webhookMaxBackoff {
+		return backoff
+	}
+	return webhookMaxBackoff
+}
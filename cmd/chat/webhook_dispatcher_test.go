@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"8.8.8.8", true},
+		{"2001:4860:4860::8888", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"0.0.0.0", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"172.32.0.1", true},
+		{"192.168.1.1", false},
+		{"100.64.0.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"224.0.0.1", false},
+	}
+	for _, test := range tests {
+		if public := isPublicIP(net.ParseIP(test.ip)); public != test.public {
+			t.Errorf("%v: expected public %v, got %v", test.ip, test.public, public)
+		}
+	}
+}
+
+func TestWebhookDialControl(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"8.8.8.8:443", true},
+		{"[2001:4860:4860::8888]:443", true},
+		{"127.0.0.1:80", false},
+		{"[::1]:80", false},
+		{"169.254.169.254:80", false},
+		{"8.8.8.8", false},
+	}
+	for _, test := range tests {
+		err := webhookDialControl("tcp", test.address, nil)
+		if allowed := err == nil; allowed != test.allowed {
+			t.Errorf("%v: expected allowed %v, got %v", test.address, test.allowed, err)
+		}
+	}
+}
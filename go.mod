@@ -1,8 +1,11 @@
 module github.com/matvoy/chat_server
 
-go 1.14
+go 1.16
 
 require (
+	github.com/DATA-DOG/go-sqlmock v1.5.2
+	github.com/alicebob/miniredis/v2 v2.14.3
+	github.com/go-redis/redis/v7 v7.4.0
 	github.com/go-telegram-bot-api/telegram-bot-api v4.6.4+incompatible
 	github.com/gogo/protobuf v1.2.2-0.20190723190241-65acae22fc9d // indirect
 	github.com/golang/protobuf v1.4.2
@@ -2,21 +2,22 @@ package auth
 
 import (
 	"context"
+	"net"
 	"strings"
+	"time"
 
 	pbauth "github.com/matvoy/chat_server/api/proto/auth"
 	cache "github.com/matvoy/chat_server/internal/chat_cache"
 
 	"github.com/micro/go-micro/v2/errors"
 	"github.com/micro/go-micro/v2/metadata"
+	"github.com/micro/go-micro/v2/registry"
+	regcache "github.com/micro/go-micro/v2/registry/cache"
 	"github.com/rs/zerolog"
 	"google.golang.org/protobuf/proto"
 )
 
 const (
-	botServiceKey  = `Micro-From-Service`
-	botServiceName = `webitel.chat.bot`
-
 	h2pDomainId      = `x-webitel-dc`
 	h2pDomainName    = `x-webitel-domain`
 	h2pTokenAccess   = `x-webitel-access`
@@ -28,54 +29,82 @@ const (
 	hdrAuthorization = `Authorization`
 )
 
+// flowEndpoints are the only endpoints the trusted services may call without the signature
+var flowEndpoints = map[string]bool{
+	"ChatService.SendMessage":       true,
+	"ChatService.CloseConversation": true,
+	"ChatService.WaitMessage":       true,
+}
+
 type Client interface {
-	MicroAuthentication(rpc *context.Context) error
+	// MicroAuthentication resolves the caller of the rpc by the access token
+	MicroAuthentication(rpc *context.Context) (*User, error)
 }
 
 type client struct {
-	log        *zerolog.Logger
-	chatCache  cache.ChatCache
-	authClient pbauth.AuthService
+	log         *zerolog.Logger
+	chatCache   cache.ChatCache
+	authClient  pbauth.AuthService
+	serviceKeys ServiceKeys
+	// trustedServices are the registered services which cannot sign the requests,
+	// they are recognized by the address of the caller and limited to the flow endpoints
+	trustedServices []string
+	registry        regcache.Cache
 }
 
 func NewClient(
 	log *zerolog.Logger,
 	chatCache cache.ChatCache,
 	authClient pbauth.AuthService,
+	serviceKeys ServiceKeys,
+	trustedServices []string,
+	registry registry.Registry,
 ) Client {
 	return &client{
 		log,
 		chatCache,
 		authClient,
+		serviceKeys,
+		trustedServices,
+		regcache.New(registry),
 	}
 }
 
-func (c *client) MicroAuthentication(rpc *context.Context) error {
+func (c *client) MicroAuthentication(rpc *context.Context) (*User, error) {
 	// metadata binding ...
 	md, _ := metadata.FromContext(*rpc)
 	if len(md) == 0 {
-		return errors.Unauthorized("no metadata", "")
+		return nil, errors.Unauthorized("no metadata", "")
 	}
-	serviceName, ok := md[botServiceKey]
-	if ok && serviceName == botServiceName {
-		return nil
+	req, _ := (*rpc).Value(signedRequestKey{}).(*signedRequest)
+	if _, ok := md.Get(hdrServiceSignature); ok {
+		return c.serviceAuthentication(md, req)
 	}
 	// context authorization credentials
 	_, token, err := getAuthTokenFromMetadata(md)
 	if err != nil {
-		return errors.Unauthorized("invalid token", "")
+		return nil, errors.Unauthorized("invalid token", "")
 	}
 	// provided ?
 	if len(token) == 0 {
-		return errors.Unauthorized("invalid token", "")
+		if req != nil && flowEndpoints[req.endpoint] {
+			if service := c.trustedService(md); service != "" {
+				return newServiceUser(service), nil
+			}
+		}
+		return nil, errors.Unauthorized("invalid token", "")
 	}
-	exists, err := c.chatCache.GetUserInfo(token)
+	cached, err := c.chatCache.GetUserInfo(token)
 	// session, err := rpc.App.GetSession(rpc.App.Context, token)
 	if err != nil {
-		return errors.InternalServerError("failed to get userinfo from cache", err.Error())
+		return nil, errors.InternalServerError("failed to get userinfo from cache", err.Error())
 	}
-	if exists {
-		return nil
+	if cached != nil {
+		info := &pbauth.Userinfo{}
+		if err := proto.Unmarshal(cached, info); err != nil {
+			return nil, errors.InternalServerError("failed to decode userinfo from cache", err.Error())
+		}
+		return newUser(info), nil
 	}
 	uiReq := &pbauth.UserinfoRequest{
 		AccessToken: token,
@@ -83,13 +112,86 @@ func (c *client) MicroAuthentication(rpc *context.Context) error {
 	ctx := metadata.Set(*rpc, h2pTokenAccess, token)
 	info, err := c.authClient.UserInfo(ctx, uiReq)
 	if err != nil {
-		return errors.Unauthorized("failed to get userinfo from app", err.Error())
+		return nil, errors.Unauthorized("failed to get userinfo from app", err.Error())
 	}
 	infoBytes, _ := proto.Marshal(info)
 	if err := c.chatCache.SetUserInfo(token, infoBytes, info.ExpiresAt); err != nil {
-		return errors.InternalServerError("failed to get userinfo to cache", err.Error())
+		return nil, errors.InternalServerError("failed to get userinfo to cache", err.Error())
+	}
+	return newUser(info), nil
+}
+
+// serviceAuthentication trusts the webitel services which signed the request with a known key
+func (c *client) serviceAuthentication(md metadata.Metadata, req *signedRequest) (*User, error) {
+	service, nonce, err := verifyServiceSignature(c.serviceKeys, md, req, time.Now())
+	if err != nil {
+		c.log.Warn().Msg(err.Error())
+		return nil, errors.Unauthorized("invalid service signature", err.Error())
+	}
+	used, err := c.chatCache.CheckServiceNonce(nonce, 2*signatureTTL)
+	if err != nil {
+		return nil, errors.InternalServerError("failed to check service nonce", err.Error())
+	}
+	if used {
+		c.log.Warn().
+			Str("service", service).
+			Msg("service signature replay")
+		return nil, errors.Unauthorized("invalid service signature", "replayed request")
+	}
+	return newServiceUser(service), nil
+}
+
+// trustedService returns the name of the trusted service running on the host of the caller.
+// The remote address is set by the server from the connection, so the caller cannot forge it.
+func (c *client) trustedService(md metadata.Metadata) string {
+	remote, _ := md.Get("Remote")
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		return ""
+	}
+	remoteIP := net.ParseIP(host)
+	if remoteIP == nil {
+		return ""
+	}
+	for _, name := range c.trustedServices {
+		services, err := c.registry.GetService(name)
+		if err != nil {
+			if err != registry.ErrNotFound {
+				c.log.Warn().
+					Str("service", name).
+					Msg(err.Error())
+			}
+			continue
+		}
+		for _, service := range services {
+			for _, node := range service.Nodes {
+				if nodeHasIP(node.Address, remoteIP) {
+					return name
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func nodeHasIP(address string, ip net.IP) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	if nodeIP := net.ParseIP(host); nodeIP != nil {
+		return nodeIP.Equal(ip)
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return false
+	}
+	for _, nodeIP := range ips {
+		if nodeIP.Equal(ip) {
+			return true
+		}
 	}
-	return nil
+	return false
 }
 
 // method:<type> credentials:<token>
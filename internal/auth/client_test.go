@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micro/go-micro/v2/errors"
+	"github.com/micro/go-micro/v2/metadata"
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-micro/v2/registry/memory"
+	"github.com/rs/zerolog"
+)
+
+func TestTrustedService(t *testing.T) {
+	reg := memory.NewRegistry()
+	err := reg.Register(&registry.Service{
+		Name: "workflow",
+		Nodes: []*registry.Node{
+			{
+				Id:      "workflow-1",
+				Address: "10.0.0.5:10020",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := zerolog.Nop()
+	tests := []struct {
+		name            string
+		trustedServices []string
+		endpoint        string
+		remote          string
+		service         string
+	}{
+		{
+			name:            "flow endpoint from the trusted service",
+			trustedServices: []string{"workflow"},
+			endpoint:        "ChatService.SendMessage",
+			remote:          "10.0.0.5:53211",
+			service:         "workflow",
+		},
+		{
+			name:            "other endpoint from the trusted service",
+			trustedServices: []string{"workflow"},
+			endpoint:        "ChatService.DeleteProfile",
+			remote:          "10.0.0.5:53211",
+		},
+		{
+			name:            "flow endpoint from the unknown address",
+			trustedServices: []string{"workflow"},
+			endpoint:        "ChatService.CloseConversation",
+			remote:          "10.0.0.6:53211",
+		},
+		{
+			name:     "no trusted services by default",
+			endpoint: "ChatService.WaitMessage",
+			remote:   "10.0.0.5:53211",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewClient(&log, nil, nil, nil, test.trustedServices, reg)
+			ctx := metadata.NewContext(context.Background(), metadata.Metadata{
+				"Remote": test.remote,
+			})
+			ctx = context.WithValue(ctx, signedRequestKey{}, &signedRequest{
+				endpoint: test.endpoint,
+			})
+			user, err := c.MicroAuthentication(&ctx)
+			if test.service == "" {
+				if microErr, ok := err.(*errors.Error); !ok || microErr.Code != 401 {
+					t.Fatalf("expected unauthorized, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !user.Service || user.Name != test.service {
+				t.Errorf("expected service user %v, got %+v", test.service, user)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	microclient "github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/metadata"
+	"github.com/micro/go-micro/v2/server"
+	"google.golang.org/protobuf/proto"
+)
+
+// Service requests are signed with a shared secret:
+// signature = hex(hmac-sha256(secret, service + "\n" + endpoint + "\n" + timestamp + "\n" + nonce + "\n" + body hash)),
+// the body hash is hex(sha256) of the deterministic protobuf encoding of the request, streams are signed with an empty body
+const (
+	hdrServiceName      = `X-Webitel-Service`
+	hdrServiceKeyID     = `X-Webitel-Service-Key`
+	hdrServiceTimestamp = `X-Webitel-Service-Timestamp`
+	hdrServiceNonce     = `X-Webitel-Service-Nonce`
+	hdrServiceSignature = `X-Webitel-Service-Signature`
+
+	// signatureTTL is the allowed clock skew, nonces are remembered for this time
+	signatureTTL = 30 * time.Second
+)
+
+// ServiceKeys maps the key id to the shared secret.
+// Several keys may be active at once to rotate them without downtime.
+type ServiceKeys map[string][]byte
+
+// ParseServiceKeys parses keys in the form "id1:secret1,id2:secret2"
+func ParseServiceKeys(value string) (ServiceKeys, error) {
+	keys := make(ServiceKeys)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		id, secret, err := parseServiceKey(item)
+		if err != nil {
+			return nil, err
+		}
+		keys[id] = secret
+	}
+	return keys, nil
+}
+
+func parseServiceKey(value string) (string, []byte, error) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", nil, fmt.Errorf("wrong service key format, expected id:secret")
+	}
+	return parts[0], []byte(parts[1]), nil
+}
+
+// Signer adds the service signature to the outgoing rpc metadata
+type Signer struct {
+	service string
+	keyID   string
+	secret  []byte
+}
+
+// NewSigner creates the signer for the key in the form "id:secret"
+func NewSigner(service, key string) (*Signer, error) {
+	id, secret, err := parseServiceKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{
+		service,
+		id,
+		secret,
+	}, nil
+}
+
+// Sign binds the signature to the endpoint and the body of the request
+func (s *Signer) Sign(ctx context.Context, endpoint string, body interface{}) (context.Context, error) {
+	hash, err := bodyHash(body)
+	if err != nil {
+		return nil, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := uuid.New().String()
+	return metadata.MergeContext(ctx, metadata.Metadata{
+		hdrServiceName:      s.service,
+		hdrServiceKeyID:     s.keyID,
+		hdrServiceTimestamp: timestamp,
+		hdrServiceNonce:     nonce,
+		hdrServiceSignature: sign(s.secret, s.service, endpoint, timestamp, nonce, hash),
+	}, true), nil
+}
+
+// NewSignWrapper signs every call and stream of the client
+func NewSignWrapper(signer *Signer) microclient.Wrapper {
+	return func(c microclient.Client) microclient.Client {
+		return &signClient{
+			c,
+			signer,
+		}
+	}
+}
+
+type signClient struct {
+	microclient.Client
+	signer *Signer
+}
+
+func (c *signClient) Call(ctx context.Context, req microclient.Request, rsp interface{}, opts ...microclient.CallOption) error {
+	ctx, err := c.signer.Sign(ctx, req.Endpoint(), req.Body())
+	if err != nil {
+		return err
+	}
+	return c.Client.Call(ctx, req, rsp, opts...)
+}
+
+func (c *signClient) Stream(ctx context.Context, req microclient.Request, opts ...microclient.CallOption) (microclient.Stream, error) {
+	ctx, err := c.signer.Sign(ctx, req.Endpoint(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Client.Stream(ctx, req, opts...)
+}
+
+// signedRequest is the part of the incoming request covered by the signature
+type signedRequest struct {
+	endpoint string
+	bodyHash string
+}
+
+type signedRequestKey struct{}
+
+// NewRequestWrapper keeps the endpoint and the body hash of the incoming request
+// to verify the service signature, the handlers of the streams get an empty body
+func NewRequestWrapper() server.HandlerWrapper {
+	return func(h server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req server.Request, rsp interface{}) error {
+			var body interface{}
+			if !req.Stream() {
+				body = req.Body()
+			}
+			hash, err := bodyHash(body)
+			if err != nil {
+				return err
+			}
+			ctx = context.WithValue(ctx, signedRequestKey{}, &signedRequest{
+				req.Endpoint(),
+				hash,
+			})
+			return h(ctx, req, rsp)
+		}
+	}
+}
+
+func bodyHash(body interface{}) (string, error) {
+	var data []byte
+	if m, ok := body.(proto.Message); ok {
+		var err error
+		data, err = proto.MarshalOptions{Deterministic: true}.Marshal(m)
+		if err != nil {
+			return "", err
+		}
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+func sign(secret []byte, service, endpoint, timestamp, nonce, bodyHash string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(service + "\n" + endpoint + "\n" + timestamp + "\n" + nonce + "\n" + bodyHash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyServiceSignature checks the signature of the request and the timestamp, returns the name of the signed service
+func verifyServiceSignature(keys ServiceKeys, md metadata.Metadata, req *signedRequest, now time.Time) (string, string, error) {
+	service, _ := md.Get(hdrServiceName)
+	keyID, _ := md.Get(hdrServiceKeyID)
+	timestamp, _ := md.Get(hdrServiceTimestamp)
+	nonce, _ := md.Get(hdrServiceNonce)
+	signature, _ := md.Get(hdrServiceSignature)
+	if service == "" || keyID == "" || timestamp == "" || nonce == "" {
+		return "", "", fmt.Errorf("incomplete service signature")
+	}
+	secret, ok := keys[keyID]
+	if !ok {
+		return "", "", fmt.Errorf("unknown service key: %s", keyID)
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", "", fmt.Errorf("wrong signature timestamp")
+	}
+	if skew := now.Sub(time.Unix(unix, 0)); skew > signatureTTL || skew < -signatureTTL {
+		return "", "", fmt.Errorf("signature expired")
+	}
+	if req == nil {
+		return "", "", fmt.Errorf("unknown signed request")
+	}
+	expected, _ := hex.DecodeString(sign(secret, service, req.endpoint, timestamp, nonce, req.bodyHash))
+	actual, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, actual) {
+		return "", "", fmt.Errorf("invalid service signature")
+	}
+	return service, nonce, nil
+}
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pbauth "github.com/matvoy/chat_server/api/proto/auth"
+
+	"github.com/micro/go-micro/v2/metadata"
+)
+
+func TestParseServiceKeys(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		keys  int
+		err   bool
+	}{
+		{
+			name:  "several keys",
+			value: "old:secret1, new:secret2",
+			keys:  2,
+		},
+		{
+			name: "no keys",
+		},
+		{
+			name:  "key without the secret",
+			value: "old:",
+			err:   true,
+		},
+		{
+			name:  "key without the id",
+			value: "secret",
+			err:   true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keys, err := ParseServiceKeys(test.value)
+			if (err != nil) != test.err {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if len(keys) != test.keys {
+				t.Errorf("expected %v keys, got %v", test.keys, len(keys))
+			}
+		})
+	}
+}
+
+func TestVerifyServiceSignature(t *testing.T) {
+	signer, err := NewSigner("webitel.chat.bot", "new:secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := &pbauth.UserinfoRequest{
+		AccessToken: "token",
+	}
+	ctx, err := signer.Sign(context.Background(), "ChatService.SendMessage", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, _ := metadata.FromContext(ctx)
+	hash, err := bodyHash(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherHash, err := bodyHash(&pbauth.UserinfoRequest{
+		AccessToken: "other",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := ServiceKeys{
+		"old": []byte("old secret"),
+		"new": []byte("secret"),
+	}
+	now := time.Now()
+	tests := []struct {
+		name string
+		keys ServiceKeys
+		md   metadata.Metadata
+		req  *signedRequest
+		now  time.Time
+		err  bool
+	}{
+		{
+			name: "valid signature",
+			keys: keys,
+			md:   signed,
+			req:  &signedRequest{"ChatService.SendMessage", hash},
+			now:  now,
+		},
+		{
+			name: "other endpoint",
+			keys: keys,
+			md:   signed,
+			req:  &signedRequest{"ChatService.DeleteProfile", hash},
+			now:  now,
+			err:  true,
+		},
+		{
+			name: "other body",
+			keys: keys,
+			md:   signed,
+			req:  &signedRequest{"ChatService.SendMessage", otherHash},
+			now:  now,
+			err:  true,
+		},
+		{
+			name: "rotated key",
+			keys: ServiceKeys{
+				"old": []byte("old secret"),
+			},
+			md:  signed,
+			req: &signedRequest{"ChatService.SendMessage", hash},
+			now: now,
+			err: true,
+		},
+		{
+			name: "expired signature",
+			keys: keys,
+			md:   signed,
+			req:  &signedRequest{"ChatService.SendMessage", hash},
+			now:  now.Add(2 * signatureTTL),
+			err:  true,
+		},
+		{
+			name: "changed service",
+			keys: keys,
+			md:   withHeader(signed, hdrServiceName, "workflow"),
+			req:  &signedRequest{"ChatService.SendMessage", hash},
+			now:  now,
+			err:  true,
+		},
+		{
+			name: "changed nonce",
+			keys: keys,
+			md:   withHeader(signed, hdrServiceNonce, "nonce"),
+			req:  &signedRequest{"ChatService.SendMessage", hash},
+			now:  now,
+			err:  true,
+		},
+		{
+			name: "no nonce",
+			keys: keys,
+			md:   withHeader(signed, hdrServiceNonce, ""),
+			req:  &signedRequest{"ChatService.SendMessage", hash},
+			now:  now,
+			err:  true,
+		},
+		{
+			name: "unknown request",
+			keys: keys,
+			md:   signed,
+			now:  now,
+			err:  true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service, nonce, err := verifyServiceSignature(test.keys, test.md, test.req, test.now)
+			if test.err {
+				if err == nil {
+					t.Fatal("expected the signature error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if service != "webitel.chat.bot" {
+				t.Errorf("expected service webitel.chat.bot, got %v", service)
+			}
+			if expected, _ := signed.Get(hdrServiceNonce); nonce != expected {
+				t.Errorf("expected nonce %v, got %v", expected, nonce)
+			}
+		})
+	}
+}
+
+// withHeader returns the copy of the metadata with the changed header
+func withHeader(md metadata.Metadata, key, value string) metadata.Metadata {
+	result := metadata.Copy(md)
+	result.Set(key, value)
+	return result
+}
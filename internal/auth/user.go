@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"strings"
+
+	pbauth "github.com/matvoy/chat_server/api/proto/auth"
+)
+
+// ChatProfilesClass is the object class controlling access to the bot profiles
+const ChatProfilesClass = "chat_profiles"
+
+// ChatWebhooksClass is the object class controlling access to the webhook subscriptions
+const ChatWebhooksClass = "chat_webhooks"
+
+// Access is the flag of the Objclass access string
+type Access string
+
+const (
+	Create Access = "x"
+	Select Access = "r"
+	Update Access = "w"
+	Delete Access = "d"
+)
+
+// User is the authenticated caller of the rpc
+type User struct {
+	ID       int64
+	DomainID int64
+	Name     string
+	// Service is set for the trusted webitel services, they are not bound to the domain
+	Service bool
+	scope   map[string]*pbauth.Objclass
+}
+
+func newUser(info *pbauth.Userinfo) *User {
+	user := &User{
+		ID:       info.GetUserId(),
+		DomainID: info.GetDc(),
+		Name:     info.GetName(),
+		scope:    make(map[string]*pbauth.Objclass, len(info.GetScope())),
+	}
+	for _, class := range info.GetScope() {
+		user.scope[class.GetClass()] = class
+	}
+	return user
+}
+
+func newServiceUser(name string) *User {
+	return &User{
+		Name:    name,
+		Service: true,
+	}
+}
+
+// HasAccess checks the access flag of the object class.
+// The class must be granted, the flag is checked if the operation based access control is enabled.
+func (u *User) HasAccess(class string, access Access) bool {
+	if u.Service {
+		return true
+	}
+	objclass, ok := u.scope[class]
+	if !ok {
+		return false
+	}
+	if !objclass.GetObac() {
+		return true
+	}
+	return strings.Contains(objclass.GetAccess(), string(access))
+}
+
+// InDomain reports whether the resource of the domain is visible to the user
+func (u *User) InDomain(domainID int64) bool {
+	return u.Service || u.DomainID == domainID
+}
+
+// Domain returns the domain to filter by, users are always limited to their own domain
+func (u *User) Domain(domainID int64) int64 {
+	if u.Service {
+		return domainID
+	}
+	return u.DomainID
+}
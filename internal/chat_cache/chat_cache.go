@@ -4,16 +4,22 @@ import (
 	"fmt"
 	"time"
 
+	pb "github.com/matvoy/chat_server/api/proto/chat"
+
+	"github.com/go-redis/redis/v7"
 	"github.com/micro/go-micro/v2/store"
+	"google.golang.org/protobuf/proto"
 )
 
 const (
-	sessionStr            = "session_id:%s"         // %s - session id, value - conversation id
-	confirmationStr       = "confirmations:%v"      // %s - conversation id, value - confirmation id
-	writeCachedMessageStr = "cached_messages:%v:%v" // %v - conversation id, %v - message id
-	readCachedMessageStr  = "cached_messages:%v"    // %v - conversation id
-	conversationNodeStr   = "conversation:%v:node"  // %v - conversation id
-	userInfoStr           = "userinfo:%s"           // %s - token
+	sessionStr           = "session_id:%s"         // %s - session id, value - conversation id
+	confirmationStr      = "confirmations:%v"      // %s - conversation id, value - confirmation id
+	cachedMessagesStr    = "cached_messages:%v"    // %v - conversation id, list of messages
+	conversationNodeStr  = "conversation:%v:node"  // %v - conversation id
+	conversationStartStr = "conversation:%v:start" // %v - conversation id, value - flow start request
+	userInfoStr          = "userinfo:%s"           // %s - token
+	serviceNonceStr      = "service_nonce:%s"      // %s - nonce
+	conversationLockStr  = "conversation:%v:lock"  // %v - conversation id, value - lock owner
 )
 
 type ChatCache interface {
@@ -25,26 +31,67 @@ type ChatCache interface {
 	ReadConversationNode(conversationID string) ([]byte, error)
 	DeleteConversationNode(conversationID string) error
 
+	WriteConversationStart(conversationID string, startBytes []byte) error
+	ReadConversationStart(conversationID string) ([]byte, error)
+	DeleteConversationStart(conversationID string) error
+
 	ReadConfirmation(conversationID string) ([]byte, error)
 	WriteConfirmation(conversationID string, confirmationIDBytes []byte) error
 	DeleteConfirmation(conversationID string) error
 
-	ReadCachedMessages(conversationID string) ([]*store.Record, error)
-	WriteCachedMessage(conversationID string, messageID int64, messageBytes []byte) error
+	TakeCachedMessages(conversationID string, confirmationIDBytes []byte) ([]*pb.Message, error)
+	ConfirmMessage(conversationID string, message *pb.Message) ([]byte, error)
 	DeleteCachedMessages(conversationID string) error
-	DeleteCachedMessage(key string) error
 
 	SetUserInfo(token string, infoBytes []byte, expires int64) error
-	GetUserInfo(token string) (bool, error)
+	GetUserInfo(token string) ([]byte, error)
+
+	CheckServiceNonce(nonce string, expiry time.Duration) (bool, error)
+
+	LockConversation(conversationID, owner string, expiry time.Duration) (bool, error)
+	UnlockConversation(conversationID, owner string) error
 }
 
+const cacheExpiry = time.Hour * time.Duration(24)
+
+var (
+	// KEYS[1] - cached messages, KEYS[2] - confirmation, ARGV[1] - confirmation id, ARGV[2] - expiry
+	takeCachedMessagesScript = redis.NewScript(`
+local messages = redis.call("LRANGE", KEYS[1], 0, -1)
+if #messages > 0 then
+	redis.call("DEL", KEYS[1], KEYS[2])
+else
+	redis.call("SET", KEYS[2], ARGV[1], "EX", ARGV[2])
+end
+return messages`)
+	// KEYS[1] - confirmation, KEYS[2] - cached messages, ARGV[1] - message, ARGV[2] - expiry
+	confirmMessageScript = redis.NewScript(`
+local confirmation = redis.call("GET", KEYS[1])
+if confirmation then
+	redis.call("DEL", KEYS[1])
+	return confirmation
+end
+redis.call("RPUSH", KEYS[2], ARGV[1])
+redis.call("EXPIRE", KEYS[2], ARGV[2])
+return false`)
+	// KEYS[1] - lock, ARGV[1] - owner
+	unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
 type chatCache struct {
 	redisStore store.Store
+	// redisClient runs the scripts which the store does not support
+	redisClient *redis.Client
 }
 
 func NewChatCache(redisStore store.Store) ChatCache {
 	return &chatCache{
 		redisStore,
+		newRedisClient(redisStore),
 	}
 }
 
@@ -57,17 +104,27 @@ func (c *chatCache) SetUserInfo(token string, infoBytes []byte, expires int64) e
 	})
 }
 
-func (c *chatCache) GetUserInfo(token string) (bool, error) {
+func (c *chatCache) GetUserInfo(token string) ([]byte, error) {
 	key := fmt.Sprintf(userInfoStr, token)
 	info, err := c.redisStore.Read(key)
 	if err != nil && err.Error() != "not found" {
-		return false, err
+		return nil, err
 	}
 	if len(info) > 0 {
-		return true, nil
-	} else {
-		return false, nil
+		return info[0].Value, nil
+	}
+	return nil, nil
+}
+
+// CheckServiceNonce reports whether the nonce was already used and remembers it for the expiry.
+// The nonce is set only if it is absent in one call, so the concurrent replays of the request are rejected.
+func (c *chatCache) CheckServiceNonce(nonce string, expiry time.Duration) (bool, error) {
+	key := c.key(fmt.Sprintf(serviceNonceStr, nonce))
+	set, err := c.redisClient.SetNX(key, 1, expiry).Result()
+	if err != nil {
+		return false, err
 	}
+	return !set, nil
 }
 
 func (c *chatCache) ReadSession(sessionID string) ([]byte, error) {
@@ -119,6 +176,32 @@ func (c *chatCache) DeleteConversationNode(conversationID string) error {
 	return c.redisStore.Delete(key)
 }
 
+// WriteConversationStart keeps the flow start request to restart the conversation on another node
+func (c *chatCache) WriteConversationStart(conversationID string, startBytes []byte) error {
+	key := fmt.Sprintf(conversationStartStr, conversationID)
+	return c.redisStore.Write(&store.Record{
+		Key:   key,
+		Value: startBytes,
+	})
+}
+
+func (c *chatCache) ReadConversationStart(conversationID string) ([]byte, error) {
+	key := fmt.Sprintf(conversationStartStr, conversationID)
+	start, err := c.redisStore.Read(key)
+	if err != nil && err.Error() != "not found" {
+		return nil, err
+	}
+	if len(start) > 0 {
+		return start[0].Value, nil
+	}
+	return nil, nil
+}
+
+func (c *chatCache) DeleteConversationStart(conversationID string) error {
+	key := fmt.Sprintf(conversationStartStr, conversationID)
+	return c.redisStore.Delete(key)
+}
+
 func (c *chatCache) DeleteSession(sessionID string) error {
 	sessionKey := fmt.Sprintf(sessionStr, sessionID)
 	return c.redisStore.Delete(sessionKey)
@@ -151,39 +234,98 @@ func (c *chatCache) DeleteConfirmation(conversationID string) error {
 	return c.redisStore.Delete(confirmationKey)
 }
 
-func (c *chatCache) ReadCachedMessages(conversationID string) ([]*store.Record, error) {
-	messagesKey := fmt.Sprintf(readCachedMessageStr, conversationID)
-	cachedMessages, err := c.redisStore.Read(messagesKey)
-	if err != nil && err.Error() != "not found" {
+// TakeCachedMessages returns and clears the messages buffered for the flow.
+// If the buffer is empty the confirmation is written in the same step,
+// so a message is either returned here or passed with the confirmation by ConfirmMessage.
+func (c *chatCache) TakeCachedMessages(conversationID string, confirmationIDBytes []byte) ([]*pb.Message, error) {
+	res, err := takeCachedMessagesScript.Run(
+		c.redisClient,
+		[]string{
+			c.key(fmt.Sprintf(cachedMessagesStr, conversationID)),
+			c.key(fmt.Sprintf(confirmationStr, conversationID)),
+		},
+		confirmationIDBytes,
+		int64(cacheExpiry/time.Second),
+	).Result()
+	if err != nil {
 		return nil, err
 	}
-	if len(cachedMessages) > 0 {
-		return cachedMessages, nil
-	} else {
+	values, _ := res.([]interface{})
+	if len(values) == 0 {
 		return nil, nil
 	}
+	messages := make([]*pb.Message, 0, len(values))
+	for _, v := range values {
+		value, _ := v.(string)
+		message := &pb.Message{}
+		if err := proto.Unmarshal([]byte(value), message); err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
 }
 
-func (c *chatCache) WriteCachedMessage(conversationID string, messageID int64, messageBytes []byte) error {
-	messagesKey := fmt.Sprintf(writeCachedMessageStr, conversationID, messageID)
-	return c.redisStore.Write(&store.Record{
-		Key:    messagesKey,
-		Value:  messageBytes,
-		Expiry: time.Hour * time.Duration(24),
-	})
+// ConfirmMessage takes the confirmation of the flow waiting for a message.
+// If the flow does not wait, the message is buffered in the same step and nil is returned.
+func (c *chatCache) ConfirmMessage(conversationID string, message *pb.Message) ([]byte, error) {
+	messageBytes, err := proto.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	confirmationID, err := confirmMessageScript.Run(
+		c.redisClient,
+		[]string{
+			c.key(fmt.Sprintf(confirmationStr, conversationID)),
+			c.key(fmt.Sprintf(cachedMessagesStr, conversationID)),
+		},
+		messageBytes,
+		int64(cacheExpiry/time.Second),
+	).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	value, _ := confirmationID.(string)
+	return []byte(value), nil
 }
 
 func (c *chatCache) DeleteCachedMessages(conversationID string) error {
-	messagesKey := fmt.Sprintf(readCachedMessageStr, conversationID)
-	cachedMessages, _ := c.redisStore.Read(messagesKey)
-	for _, m := range cachedMessages {
-		if err := c.redisStore.Delete(m.Key); err != nil {
-			return err
-		}
-	}
-	return nil
+	messagesKey := fmt.Sprintf(cachedMessagesStr, conversationID)
+	return c.redisStore.Delete(messagesKey)
 }
 
-func (c *chatCache) DeleteCachedMessage(key string) error {
-	return c.redisStore.Delete(key)
+// LockConversation takes the lock of the conversation for the owner if it is free,
+// the lock is released after the expiry if the owner does not unlock it
+func (c *chatCache) LockConversation(conversationID, owner string, expiry time.Duration) (bool, error) {
+	key := c.key(fmt.Sprintf(conversationLockStr, conversationID))
+	return c.redisClient.SetNX(key, owner, expiry).Result()
+}
+
+// UnlockConversation releases the lock if it is still held by the owner
+func (c *chatCache) UnlockConversation(conversationID, owner string) error {
+	key := c.key(fmt.Sprintf(conversationLockStr, conversationID))
+	return unlockScript.Run(c.redisClient, []string{key}, owner).Err()
+}
+
+// key returns the redis key of the store record
+func (c *chatCache) key(key string) string {
+	return c.redisStore.Options().Table + key
+}
+
+// newRedisClient connects to the node of the store the same way the redis store does
+func newRedisClient(redisStore store.Store) *redis.Client {
+	nodes := redisStore.Options().Nodes
+	if len(nodes) == 0 {
+		nodes = []string{"redis://127.0.0.1:6379"}
+	}
+	options, err := redis.ParseURL(nodes[0])
+	if err != nil {
+		options = &redis.Options{
+			Addr: nodes[0],
+		}
+	}
+	return redis.NewClient(options)
 }
@@ -0,0 +1,185 @@
+package chat_cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/matvoy/chat_server/api/proto/chat"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/micro/go-micro/v2/store"
+	"github.com/micro/go-plugins/store/redis/v2"
+)
+
+func newTestChatCache(t *testing.T) (*chatCache, *miniredis.Miniredis) {
+	t.Helper()
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	redisStore := redis.NewStore(
+		store.Nodes("redis://"+server.Addr()),
+		store.Table("chat:"),
+	)
+	if err := redisStore.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return NewChatCache(redisStore).(*chatCache), server
+}
+
+func TestCheckServiceNonce(t *testing.T) {
+	c, server := newTestChatCache(t)
+	used, err := c.CheckServiceNonce("nonce", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used {
+		t.Fatal("new nonce is reported as used")
+	}
+	used, err = c.CheckServiceNonce("nonce", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !used {
+		t.Fatal("replayed nonce is not reported as used")
+	}
+	if ttl := server.TTL("chat:service_nonce:nonce"); ttl != time.Minute {
+		t.Errorf("expected the nonce expiry of a minute, got %v", ttl)
+	}
+	server.FastForward(time.Minute)
+	used, err = c.CheckServiceNonce("nonce", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used {
+		t.Error("expired nonce is reported as used")
+	}
+}
+
+func TestCheckServiceNonceConcurrent(t *testing.T) {
+	c, _ := newTestChatCache(t)
+	const requests = 20
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			used, err := c.CheckServiceNonce("replayed", time.Minute)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !used {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if accepted != 1 {
+		t.Fatalf("expected one of the concurrent requests with the nonce accepted, got %v", accepted)
+	}
+}
+
+func TestCachedMessages(t *testing.T) {
+	c, server := newTestChatCache(t)
+	message := &pb.Message{
+		Id:   1,
+		Type: "text",
+		Value: &pb.Message_Text{
+			Text: "hello",
+		},
+	}
+	// the flow does not wait, so the message is buffered
+	confirmationID, err := c.ConfirmMessage("conversation", message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if confirmationID != nil {
+		t.Fatalf("expected no confirmation, got %s", confirmationID)
+	}
+	messages, err := c.TakeCachedMessages("conversation", []byte("confirmation"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].GetText() != "hello" {
+		t.Fatalf("expected the buffered message, got %v", messages)
+	}
+	if confirmation, err := c.ReadConfirmation("conversation"); err != nil || confirmation != nil {
+		t.Fatalf("confirmation is written with the buffered messages: %s %v", confirmation, err)
+	}
+	// the buffer is empty, so the flow waits for the next message
+	messages, err = c.TakeCachedMessages("conversation", []byte("confirmation"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 0 {
+		t.Fatalf("expected the empty buffer, got %v", messages)
+	}
+	confirmationID, err = c.ConfirmMessage("conversation", message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(confirmationID) != "confirmation" {
+		t.Fatalf("expected the confirmation, got %s", confirmationID)
+	}
+	if server.Exists("chat:cached_messages:conversation") {
+		t.Error("message is buffered with the confirmation")
+	}
+	confirmationID, err = c.ConfirmMessage("conversation", message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if confirmationID != nil {
+		t.Errorf("confirmation is taken twice: %s", confirmationID)
+	}
+}
+
+func TestConversationLock(t *testing.T) {
+	c, server := newTestChatCache(t)
+	locked, err := c.LockConversation("conversation", "first", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !locked {
+		t.Fatal("free lock is not taken")
+	}
+	locked, err = c.LockConversation("conversation", "second", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locked {
+		t.Fatal("held lock is taken by the other owner")
+	}
+	// the other owner cannot release the lock
+	if err := c.UnlockConversation("conversation", "second"); err != nil {
+		t.Fatal(err)
+	}
+	if owner, _ := server.Get("chat:conversation:conversation:lock"); owner != "first" {
+		t.Fatalf("expected the lock of the first owner, got %q", owner)
+	}
+	if err := c.UnlockConversation("conversation", "first"); err != nil {
+		t.Fatal(err)
+	}
+	locked, err = c.LockConversation("conversation", "second", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !locked {
+		t.Fatal("released lock is not taken")
+	}
+	// the lock of the owner which did not unlock it expires
+	server.FastForward(time.Minute)
+	locked, err = c.LockConversation("conversation", "first", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !locked {
+		t.Error("expired lock is not taken")
+	}
+}
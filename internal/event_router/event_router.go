@@ -2,58 +2,59 @@ package event_router
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"time"
 
-	pbbot "github.com/matvoy/chat_server/api/proto/bot"
 	pb "github.com/matvoy/chat_server/api/proto/chat"
 	pg "github.com/matvoy/chat_server/internal/repo/sqlx"
 	"github.com/matvoy/chat_server/pkg/events"
 
-	"github.com/micro/go-micro/v2/broker"
+	"github.com/jmoiron/sqlx"
 	"github.com/rs/zerolog"
 )
 
 type eventRouter struct {
-	botClient pbbot.BotService
 	// flowClient flow.Client
-	broker broker.Broker
 	repo   pg.Repository
 	log    *zerolog.Logger
+	format events.Format
 }
 
+// Router delivers the conversation events to the members.
+// Broker events are written to the outbox in the transaction tx and published by the outbox relay,
+// messages to the bot users are queued as the outbox tasks and sent by the task relay.
 type Router interface {
-	RouteCloseConversation(channel *pg.Channel, cause string) error
-	RouteCloseConversationFromFlow(conversationID *string, cause string) error
-	RouteDeclineInvite(userID *int64, conversationID *string) error
-	RouteInvite(conversationID *string, userID *int64) error
-	RouteJoinConversation(channel *pg.Channel, conversationID *string) error
-	RouteLeaveConversation(channel *pg.Channel, conversationID *string) error
-	RouteMessage(channel *pg.Channel, message *pb.Message) (bool, error)
-	RouteMessageFromFlow(conversationID *string, message *pb.Message) error
-	SendInviteToWebitelUser(conversation *pb.Conversation, domainID *int64, conversationID *string, userID *int64, inviteID *string) error
-	SendDeclineInviteToWebitelUser(domainID *int64, conversationID *string, userID *int64, inviteID *string) error
+	RouteCloseConversation(tx *sqlx.Tx, channel *pg.Channel, cause string) error
+	RouteCloseConversationFromFlow(tx *sqlx.Tx, conversationID *string, cause string) error
+	RouteCloseIdleConversation(tx *sqlx.Tx, conversationID *string, cause string) error
+	RouteDeclineInvite(tx *sqlx.Tx, userID *int64, conversationID *string) error
+	RouteInvite(tx *sqlx.Tx, conversationID *string, userID *int64) error
+	RouteJoinConversation(tx *sqlx.Tx, channel *pg.Channel, conversationID *string) error
+	RouteLeaveConversation(tx *sqlx.Tx, channel *pg.Channel, conversationID *string) error
+	RouteMessage(tx *sqlx.Tx, channel *pg.Channel, message *pb.Message) (bool, error)
+	RouteMessageFromFlow(tx *sqlx.Tx, conversationID *string, message *pb.Message) error
+	RouteEditMessage(tx *sqlx.Tx, channel *pg.Channel, message *pg.Message) error
+	RouteDeleteMessage(tx *sqlx.Tx, channel *pg.Channel, message *pg.Message) error
+	RouteMessageStatus(tx *sqlx.Tx, channel *pg.Channel, status *pg.MessageStatus) error
+	SendInviteToWebitelUser(tx *sqlx.Tx, conversation *pb.Conversation, domainID *int64, conversationID *string, userID *int64, inviteID *string) error
+	SendDeclineInviteToWebitelUser(tx *sqlx.Tx, domainID *int64, conversationID *string, userID *int64, inviteID *string) error
+	SendExpireInviteToWebitelUser(tx *sqlx.Tx, domainID *int64, conversationID *string, userID *int64, inviteID *string) error
 }
 
 func NewRouter(
-	botClient pbbot.BotService,
 	// flowClient flow.Client,
-	broker broker.Broker,
 	repo pg.Repository,
 	log *zerolog.Logger,
+	format events.Format,
 ) Router {
 	return &eventRouter{
-		botClient,
 		// flowClient,
-		broker,
 		repo,
 		log,
+		format,
 	}
 }
 
-func (e *eventRouter) RouteCloseConversation(channel *pg.Channel, cause string) error {
-	otherChannels, err := e.repo.GetChannels(context.Background(), nil, &channel.ConversationID, nil, nil, nil) //&channel.ID)
+func (e *eventRouter) RouteCloseConversation(tx *sqlx.Tx, channel *pg.Channel, cause string) error {
+	otherChannels, err := e.repo.GetChannelsTx(context.Background(), tx, nil, &channel.ConversationID, nil, nil, nil) //&channel.ID)
 	if err != nil {
 		return err
 	}
@@ -63,22 +64,32 @@ func (e *eventRouter) RouteCloseConversation(channel *pg.Channel, cause string)
 		// }
 		return nil
 	}
-	body, _ := json.Marshal(events.CloseConversationEvent{
-		BaseEvent: events.BaseEvent{
-			ConversationID: channel.ConversationID,
-			Timestamp:      time.Now().Unix() * 1000,
-		},
+	base, err := e.newConversationEvent(tx, channel.ConversationID)
+	if err != nil {
+		return err
+	}
+	body, err := e.encode(events.CloseConversationEventType, channel.DomainID, events.CloseConversationEvent{
+		BaseEvent:  base,
 		FromUserID: channel.UserID,
 		Cause:      cause,
 	})
+	if err != nil {
+		return err
+	}
+	if err := e.saveConversationEvent(tx, base, events.CloseConversationEventType, body); err != nil {
+		return err
+	}
+	if err := e.notifyWebhooks(tx, events.CloseConversationEventType, channel.DomainID, body); err != nil {
+		return err
+	}
 	for _, item := range otherChannels {
 		var err error
-		switch item.Type {
-		case "webitel":
+		switch {
+		case item.Type == "webitel":
 			{
-				err = e.sendEventToWebitelUser(channel, item, events.CloseConversationEventType, body)
+				err = e.sendEventToWebitelUser(tx, channel, item, events.CloseConversationEventType, body)
 			}
-		case "telegram", "infobip-whatsapp":
+		case isBotChannel(item):
 			{
 				reqMessage := &pb.Message{
 					Type: "text",
@@ -86,89 +97,117 @@ func (e *eventRouter) RouteCloseConversation(channel *pg.Channel, cause string)
 						Text: cause,
 					},
 				}
-				err = e.sendMessageToBotUser(channel, item, reqMessage)
+				err = e.sendMessageToBotUser(tx, item, reqMessage)
 			}
 		default:
 		}
 		if err != nil {
-			e.log.Warn().
-				Str("channel_id", item.ID).
-				Bool("internal", item.Internal).
-				Int64("user_id", item.UserID).
-				Str("conversation_id", item.ConversationID).
-				Str("type", item.Type).
-				Str("connection", item.Connection.String).
-				Msg("failed to send close conversation event to channel")
+			return err
 		}
 	}
 	return nil
 }
 
-func (e *eventRouter) RouteCloseConversationFromFlow(conversationID *string, cause string) error {
-	otherChannels, err := e.repo.GetChannels(context.Background(), nil, conversationID, nil, nil, nil)
+// RouteCloseConversationFromFlow notifies all the members about the conversation closed by the flow,
+// bot users receive the cause as a text message.
+func (e *eventRouter) RouteCloseConversationFromFlow(tx *sqlx.Tx, conversationID *string, cause string) error {
+	text := "Conversation closed"
+	if cause != "" {
+		text = cause
+	}
+	return e.routeClose(tx, conversationID, cause, text)
+}
+
+// RouteCloseIdleConversation notifies all the members about the conversation closed by the server,
+// bot users receive the cause as a text message.
+func (e *eventRouter) RouteCloseIdleConversation(tx *sqlx.Tx, conversationID *string, cause string) error {
+	return e.routeClose(tx, conversationID, cause, cause)
+}
+
+// routeClose sends the close event with the cause to all the members, bot users receive the text
+func (e *eventRouter) routeClose(tx *sqlx.Tx, conversationID *string, cause, text string) error {
+	otherChannels, err := e.repo.GetChannelsTx(context.Background(), tx, nil, conversationID, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	if len(otherChannels) == 0 {
+		return nil
+	}
+	base, err := e.newConversationEvent(tx, *conversationID)
 	if err != nil {
 		return err
 	}
+	body, err := e.encode(events.CloseConversationEventType, otherChannels[0].DomainID, events.CloseConversationEvent{
+		BaseEvent: base,
+		Cause:     cause,
+	})
+	if err != nil {
+		return err
+	}
+	if err := e.saveConversationEvent(tx, base, events.CloseConversationEventType, body); err != nil {
+		return err
+	}
+	if err := e.notifyWebhooks(tx, events.CloseConversationEventType, otherChannels[0].DomainID, body); err != nil {
+		return err
+	}
 	for _, item := range otherChannels {
-		switch item.Type {
-		case "telegram", "infobip-whatsapp":
+		var err error
+		switch {
+		case item.Type == "webitel":
+			{
+				err = e.sendEventToWebitelUser(tx, nil, item, events.CloseConversationEventType, body)
+			}
+		case isBotChannel(item):
 			{
-				text := "Conversation closed"
-				if cause != "" {
-					text = cause
-				}
 				reqMessage := &pb.Message{
 					Type: "text",
 					Value: &pb.Message_Text{
 						Text: text,
 					},
 				}
-				if err := e.sendMessageToBotUser(nil, item, reqMessage); err != nil {
-					e.log.Warn().
-						Str("channel_id", item.ID).
-						Bool("internal", item.Internal).
-						Int64("user_id", item.UserID).
-						Str("conversation_id", item.ConversationID).
-						Str("type", item.Type).
-						Str("connection", item.Connection.String).
-						Msg("failed to send close conversation event to channel")
-				}
+				err = e.sendMessageToBotUser(tx, item, reqMessage)
 			}
 		default:
 		}
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func (e *eventRouter) RouteDeclineInvite(userID *int64, conversationID *string) error {
-	otherChannels, err := e.repo.GetChannels(context.Background(), nil, conversationID, nil, nil, nil)
+func (e *eventRouter) RouteDeclineInvite(tx *sqlx.Tx, userID *int64, conversationID *string) error {
+	otherChannels, err := e.repo.GetChannelsTx(context.Background(), tx, nil, conversationID, nil, nil, nil)
 	if err != nil {
 		return err
 	}
 	if otherChannels == nil {
 		return nil
 	}
-	body, _ := json.Marshal(events.DeclineInvitationEvent{
-		BaseEvent: events.BaseEvent{
-			ConversationID: *conversationID,
-			Timestamp:      time.Now().Unix() * 1000,
-		},
-		UserID: *userID,
+	base, err := e.newConversationEvent(tx, *conversationID)
+	if err != nil {
+		return err
+	}
+	body, err := e.encode(events.DeclineInvitationEventType, otherChannels[0].DomainID, events.DeclineInvitationEvent{
+		BaseEvent: base,
+		UserID:    *userID,
 	})
+	if err != nil {
+		return err
+	}
+	if err := e.saveConversationEvent(tx, base, events.DeclineInvitationEventType, body); err != nil {
+		return err
+	}
+	if err := e.notifyWebhooks(tx, events.DeclineInvitationEventType, otherChannels[0].DomainID, body); err != nil {
+		return err
+	}
 	// TO DO declineInvitationToFlow??
 	for _, item := range otherChannels {
 		switch item.Type {
 		case "webitel":
 			{
-				if err := e.sendEventToWebitelUser(nil, item, events.DeclineInvitationEventType, body); err != nil {
-					e.log.Warn().
-						Str("channel_id", item.ID).
-						Bool("internal", item.Internal).
-						Int64("user_id", item.UserID).
-						Str("conversation_id", item.ConversationID).
-						Str("type", item.Type).
-						Str("connection", item.Connection.String).
-						Msg("failed to send invite conversation event to channel")
+				if err := e.sendEventToWebitelUser(tx, nil, item, events.DeclineInvitationEventType, body); err != nil {
+					return err
 				}
 			}
 		default:
@@ -177,8 +216,8 @@ func (e *eventRouter) RouteDeclineInvite(userID *int64, conversationID *string)
 	return nil
 }
 
-func (e *eventRouter) RouteInvite(conversationID *string, userID *int64) error {
-	otherChannels, err := e.repo.GetChannels(context.Background(), nil, conversationID, nil, nil, nil)
+func (e *eventRouter) RouteInvite(tx *sqlx.Tx, conversationID *string, userID *int64) error {
+	otherChannels, err := e.repo.GetChannelsTx(context.Background(), tx, nil, conversationID, nil, nil, nil)
 	if err != nil {
 		return err
 	}
@@ -188,26 +227,29 @@ func (e *eventRouter) RouteInvite(conversationID *string, userID *int64) error {
 	// if err := e.sendInviteToWebitelUser(&otherChannels[0].DomainID, conversationID, userID); err != nil {
 	// 	return err
 	// }
-	body, _ := json.Marshal(events.InviteConversationEvent{
-		BaseEvent: events.BaseEvent{
-			ConversationID: *conversationID,
-			Timestamp:      time.Now().Unix() * 1000,
-		},
-		UserID: *userID,
+	base, err := e.newConversationEvent(tx, *conversationID)
+	if err != nil {
+		return err
+	}
+	body, err := e.encode(events.InviteConversationEventType, otherChannels[0].DomainID, events.InviteConversationEvent{
+		BaseEvent: base,
+		UserID:    *userID,
 	})
+	if err != nil {
+		return err
+	}
+	if err := e.saveConversationEvent(tx, base, events.InviteConversationEventType, body); err != nil {
+		return err
+	}
+	if err := e.notifyWebhooks(tx, events.InviteConversationEventType, otherChannels[0].DomainID, body); err != nil {
+		return err
+	}
 	for _, item := range otherChannels {
 		switch item.Type {
 		case "webitel":
 			{
-				if err := e.sendEventToWebitelUser(nil, item, events.InviteConversationEventType, body); err != nil {
-					e.log.Warn().
-						Str("channel_id", item.ID).
-						Bool("internal", item.Internal).
-						Int64("user_id", item.UserID).
-						Str("conversation_id", item.ConversationID).
-						Str("type", item.Type).
-						Str("connection", item.Connection.String).
-						Msg("failed to send invite conversation event to channel")
+				if err := e.sendEventToWebitelUser(tx, nil, item, events.InviteConversationEventType, body); err != nil {
+					return err
 				}
 			}
 		default:
@@ -216,13 +258,10 @@ func (e *eventRouter) RouteInvite(conversationID *string, userID *int64) error {
 	return nil
 }
 
-func (e *eventRouter) SendInviteToWebitelUser(conversation *pb.Conversation, domainID *int64, conversationID *string, userID *int64, inviteID *string) error {
+func (e *eventRouter) SendInviteToWebitelUser(tx *sqlx.Tx, conversation *pb.Conversation, domainID *int64, conversationID *string, userID *int64, inviteID *string) error {
 	mes := events.UserInvitationEvent{
-		BaseEvent: events.BaseEvent{
-			ConversationID: *conversationID,
-			Timestamp:      time.Now().Unix() * 1000,
-		},
-		InviteID: *inviteID,
+		BaseEvent: newBaseEvent(*conversationID),
+		InviteID:  *inviteID,
 		Conversation: events.Conversation{
 			ID:        conversation.Id,
 			DomainID:  conversation.DomainId,
@@ -256,42 +295,45 @@ func (e *eventRouter) SendInviteToWebitelUser(conversation *pb.Conversation, dom
 			})
 		}
 	}
-	body, _ := json.Marshal(mes)
-	msg := &broker.Message{
-		Header: map[string]string{
-			"content_type": "text/json",
-		},
-		Body: body,
+	body, err := e.encode(events.UserInvitationEventType, *domainID, mes)
+	if err != nil {
+		return err
 	}
-	if err := e.broker.Publish(fmt.Sprintf("event.%s.%v.%v", events.UserInvitationEventType, *domainID, *userID), msg); err != nil {
+	if err := e.notifyWebhooks(tx, events.UserInvitationEventType, *domainID, body); err != nil {
 		return err
 	}
-	return nil
+	return e.publish(tx, events.Topic(events.UserInvitationEventType, *domainID, *userID), body)
 }
 
-func (e *eventRouter) SendDeclineInviteToWebitelUser(domainID *int64, conversationID *string, userID *int64, inviteID *string) error {
-	body, _ := json.Marshal(events.DeclineInvitationEvent{
-		BaseEvent: events.BaseEvent{
-			ConversationID: *conversationID,
-			Timestamp:      time.Now().Unix() * 1000,
-		},
-		InviteID: *inviteID,
-		UserID:   *userID,
+func (e *eventRouter) SendDeclineInviteToWebitelUser(tx *sqlx.Tx, domainID *int64, conversationID *string, userID *int64, inviteID *string) error {
+	body, err := e.encode(events.DeclineInvitationEventType, *domainID, events.DeclineInvitationEvent{
+		BaseEvent: newBaseEvent(*conversationID),
+		InviteID:  *inviteID,
+		UserID:    *userID,
 	})
-	msg := &broker.Message{
-		Header: map[string]string{
-			"content_type": "text/json",
-		},
-		Body: body,
+	if err != nil {
+		return err
 	}
-	if err := e.broker.Publish(fmt.Sprintf("event.%s.%v.%v", events.DeclineInvitationEventType, *domainID, *userID), msg); err != nil {
+	return e.publish(tx, events.Topic(events.DeclineInvitationEventType, *domainID, *userID), body)
+}
+
+func (e *eventRouter) SendExpireInviteToWebitelUser(tx *sqlx.Tx, domainID *int64, conversationID *string, userID *int64, inviteID *string) error {
+	body, err := e.encode(events.ExpireInvitationEventType, *domainID, events.ExpireInvitationEvent{
+		BaseEvent: newBaseEvent(*conversationID),
+		InviteID:  *inviteID,
+		UserID:    *userID,
+	})
+	if err != nil {
 		return err
 	}
-	return nil
+	if err := e.notifyWebhooks(tx, events.ExpireInvitationEventType, *domainID, body); err != nil {
+		return err
+	}
+	return e.publish(tx, events.Topic(events.ExpireInvitationEventType, *domainID, *userID), body)
 }
 
-func (e *eventRouter) RouteJoinConversation(channel *pg.Channel, conversationID *string) error {
-	otherChannels, err := e.repo.GetChannels(context.Background(), nil, conversationID, nil, nil, &channel.ID)
+func (e *eventRouter) RouteJoinConversation(tx *sqlx.Tx, channel *pg.Channel, conversationID *string) error {
+	otherChannels, err := e.repo.GetChannelsTx(context.Background(), tx, nil, conversationID, nil, nil, &channel.ID)
 	if err != nil {
 		return err
 	}
@@ -307,17 +349,21 @@ func (e *eventRouter) RouteJoinConversation(channel *pg.Channel, conversationID
 	if channel.UpdatedAt.Valid {
 		member.UpdatedAt = channel.UpdatedAt.Time.Unix() * 1000
 	}
+	base, err := e.newConversationEvent(tx, *conversationID)
+	if err != nil {
+		return err
+	}
 	selfEvent := events.JoinConversationEvent{
-		BaseEvent: events.BaseEvent{
-			ConversationID: *conversationID,
-			Timestamp:      time.Now().Unix() * 1000,
-		},
+		BaseEvent:     base,
 		JoinedUserID:  channel.UserID,
 		Member:        member,
 		SelfChannelID: channel.ID,
 	}
-	selfBody, _ := json.Marshal(selfEvent)
-	if err := e.sendEventToWebitelUser(nil, channel, events.JoinConversationEventType, selfBody); err != nil {
+	selfBody, err := e.encode(events.JoinConversationEventType, channel.DomainID, selfEvent)
+	if err != nil {
+		return err
+	}
+	if err := e.sendEventToWebitelUser(tx, nil, channel, events.JoinConversationEventType, selfBody); err != nil {
 		e.log.Error().
 			Str("channel_id", channel.ID).
 			Bool("internal", channel.Internal).
@@ -329,20 +375,22 @@ func (e *eventRouter) RouteJoinConversation(channel *pg.Channel, conversationID
 		return err
 	}
 	selfEvent.SelfChannelID = ""
-	body, _ := json.Marshal(selfEvent)
+	body, err := e.encode(events.JoinConversationEventType, channel.DomainID, selfEvent)
+	if err != nil {
+		return err
+	}
+	if err := e.saveConversationEvent(tx, base, events.JoinConversationEventType, body); err != nil {
+		return err
+	}
+	if err := e.notifyWebhooks(tx, events.JoinConversationEventType, channel.DomainID, body); err != nil {
+		return err
+	}
 	for _, item := range otherChannels {
 		switch item.Type {
 		case "webitel":
 			{
-				if err := e.sendEventToWebitelUser(nil, item, events.JoinConversationEventType, body); err != nil {
-					e.log.Warn().
-						Str("channel_id", item.ID).
-						Bool("internal", item.Internal).
-						Int64("user_id", item.UserID).
-						Str("conversation_id", item.ConversationID).
-						Str("type", item.Type).
-						Str("connection", item.Connection.String).
-						Msgf("failed to send join conversation event to channel: %s", err.Error())
+				if err := e.sendEventToWebitelUser(tx, nil, item, events.JoinConversationEventType, body); err != nil {
+					return err
 				}
 			}
 		default:
@@ -351,34 +399,37 @@ func (e *eventRouter) RouteJoinConversation(channel *pg.Channel, conversationID
 	return nil
 }
 
-func (e *eventRouter) RouteLeaveConversation(channel *pg.Channel, conversationID *string) error {
-	otherChannels, err := e.repo.GetChannels(context.Background(), nil, conversationID, nil, nil, nil) //channelID)
+func (e *eventRouter) RouteLeaveConversation(tx *sqlx.Tx, channel *pg.Channel, conversationID *string) error {
+	otherChannels, err := e.repo.GetChannelsTx(context.Background(), tx, nil, conversationID, nil, nil, nil) //channelID)
 	if err != nil {
 		return err
 	}
 	if otherChannels == nil {
 		return nil
 	}
-	body, _ := json.Marshal(events.LeaveConversationEvent{
-		BaseEvent: events.BaseEvent{
-			ConversationID: *conversationID,
-			Timestamp:      time.Now().Unix() * 1000,
-		},
+	base, err := e.newConversationEvent(tx, *conversationID)
+	if err != nil {
+		return err
+	}
+	body, err := e.encode(events.LeaveConversationEventType, channel.DomainID, events.LeaveConversationEvent{
+		BaseEvent:    base,
 		LeavedUserID: channel.UserID,
 	})
+	if err != nil {
+		return err
+	}
+	if err := e.saveConversationEvent(tx, base, events.LeaveConversationEventType, body); err != nil {
+		return err
+	}
+	if err := e.notifyWebhooks(tx, events.LeaveConversationEventType, channel.DomainID, body); err != nil {
+		return err
+	}
 	for _, item := range otherChannels {
 		switch item.Type {
 		case "webitel":
 			{
-				if err := e.sendEventToWebitelUser(nil, item, events.LeaveConversationEventType, body); err != nil {
-					e.log.Warn().
-						Str("channel_id", item.ID).
-						Bool("internal", item.Internal).
-						Int64("user_id", item.UserID).
-						Str("conversation_id", item.ConversationID).
-						Str("type", item.Type).
-						Str("connection", item.Connection.String).
-						Msg("failed to send leave conversation event to channel")
+				if err := e.sendEventToWebitelUser(tx, nil, item, events.LeaveConversationEventType, body); err != nil {
+					return err
 				}
 			}
 		default:
@@ -387,8 +438,8 @@ func (e *eventRouter) RouteLeaveConversation(channel *pg.Channel, conversationID
 	return nil
 }
 
-func (e *eventRouter) RouteMessage(channel *pg.Channel, message *pb.Message) (bool, error) {
-	otherChannels, err := e.repo.GetChannels(context.Background(), nil, &channel.ConversationID, nil, nil, nil) //&channel.ID)
+func (e *eventRouter) RouteMessage(tx *sqlx.Tx, channel *pg.Channel, message *pb.Message) (bool, error) {
+	otherChannels, err := e.repo.GetChannelsTx(context.Background(), tx, nil, &channel.ConversationID, nil, nil, nil) //&channel.ID)
 	if err != nil {
 		return false, err
 	}
@@ -398,77 +449,239 @@ func (e *eventRouter) RouteMessage(channel *pg.Channel, message *pb.Message) (bo
 		// }
 		return false, nil
 	}
-	body, _ := json.Marshal(events.MessageEvent{
-		BaseEvent: events.BaseEvent{
-			ConversationID: channel.ConversationID,
-			Timestamp:      time.Now().Unix() * 1000,
-		},
-		FromUserID:   channel.UserID,
-		FromUserType: channel.Type,
-		// ToChannelID:    item.ID,
-		MessageID: message.Id,
-		Type:      message.Type,
-		Value:     message.GetText(),
-	})
+	base, err := e.newConversationEvent(tx, channel.ConversationID)
+	if err != nil {
+		return false, err
+	}
+	body, err := e.encode(events.MessageEventType, channel.DomainID, newMessageEvent(base, channel.UserID, channel.Type, message))
+	if err != nil {
+		return false, err
+	}
+	if err := e.saveConversationEvent(tx, base, events.MessageEventType, body); err != nil {
+		return false, err
+	}
+	if err := e.notifyWebhooks(tx, events.MessageEventType, channel.DomainID, body); err != nil {
+		return false, err
+	}
 	flag := false
 	for _, item := range otherChannels {
 		var err error
-		switch item.Type {
-		case "webitel":
+		switch {
+		case item.Type == "webitel":
 			{
 				flag = true
-				err = e.sendEventToWebitelUser(channel, item, events.MessageEventType, body)
+				err = e.sendEventToWebitelUser(tx, channel, item, events.MessageEventType, body)
+				if err == nil && item.ID != channel.ID {
+					err = e.repo.CreateMessageStatusTx(context.Background(), tx, &pg.MessageStatus{
+						MessageID: message.Id,
+						ChannelID: item.ID,
+						Status:    pg.MessageStatusSent,
+					})
+				}
 			}
-		case "telegram", "infobip-whatsapp":
+		case isBotChannel(item):
 			{
 				if channel.ID == item.ID {
 					continue
 				}
-				err = e.sendMessageToBotUser(channel, item, message)
+				err = e.sendMessageToBotUser(tx, item, message)
 			}
 		default:
 		}
 		if err != nil {
-			e.log.Warn().
-				Str("channel_id", item.ID).
-				Bool("internal", item.Internal).
-				Int64("user_id", item.UserID).
-				Str("conversation_id", item.ConversationID).
-				Str("type", item.Type).
-				Str("connection", item.Connection.String).
-				Msg("failed to send message to channel")
+			return false, err
 		}
 	}
 	return flag, nil
 }
 
-func (e *eventRouter) RouteMessageFromFlow(conversationID *string, message *pb.Message) error {
-	otherChannels, err := e.repo.GetChannels(context.Background(), nil, conversationID, nil, nil, nil)
+// RouteMessageFromFlow delivers the message of the flow to the members of the conversation
+func (e *eventRouter) RouteMessageFromFlow(tx *sqlx.Tx, conversationID *string, message *pb.Message) error {
+	otherChannels, err := e.repo.GetChannelsTx(context.Background(), tx, nil, conversationID, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	if len(otherChannels) == 0 {
+		return nil
+	}
+	domainID := otherChannels[0].DomainID
+	base, err := e.newConversationEvent(tx, *conversationID)
 	if err != nil {
 		return err
 	}
+	body, err := e.encode(events.MessageEventType, domainID, newMessageEvent(base, 0, flowUserType, message))
+	if err != nil {
+		return err
+	}
+	if err := e.saveConversationEvent(tx, base, events.MessageEventType, body); err != nil {
+		return err
+	}
+	if err := e.notifyWebhooks(tx, events.MessageEventType, domainID, body); err != nil {
+		return err
+	}
 	for _, item := range otherChannels {
 		var err error
-		switch item.Type {
-		// case "webitel":
-		// 	{
-		// 		e.sendToWebitelUser(channel, item, reqMessage)
-		// 	}
-		case "telegram", "infobip-whatsapp":
+		switch {
+		case item.Type == "webitel":
+			{
+				err = e.sendEventToWebitelUser(tx, nil, item, events.MessageEventType, body)
+				if err == nil && message.Id != 0 {
+					err = e.repo.CreateMessageStatusTx(context.Background(), tx, &pg.MessageStatus{
+						MessageID: message.Id,
+						ChannelID: item.ID,
+						Status:    pg.MessageStatusSent,
+					})
+				}
+			}
+		case isBotChannel(item):
+			{
+				err = e.sendMessageToBotUser(tx, item, message)
+			}
+		default:
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RouteEditMessage notifies the members about the edited message of the channel,
+// the copies in the external messengers are changed where the bot supports it
+func (e *eventRouter) RouteEditMessage(tx *sqlx.Tx, channel *pg.Channel, message *pg.Message) error {
+	otherChannels, err := e.repo.GetChannelsTx(context.Background(), tx, nil, &channel.ConversationID, nil, nil, &channel.ID)
+	if err != nil {
+		return err
+	}
+	base, err := e.newConversationEvent(tx, channel.ConversationID)
+	if err != nil {
+		return err
+	}
+	body, err := e.encode(events.MessageEditedEventType, channel.DomainID, events.MessageEditedEvent{
+		BaseEvent:    base,
+		FromUserID:   channel.UserID,
+		FromUserType: channel.Type,
+		MessageID:    message.ID,
+		Value:        message.Text.String,
+		EditedAt:     message.EditedAt.Time.Unix() * 1000,
+	})
+	if err != nil {
+		return err
+	}
+	if err := e.saveConversationEvent(tx, base, events.MessageEditedEventType, body); err != nil {
+		return err
+	}
+	if err := e.notifyWebhooks(tx, events.MessageEditedEventType, channel.DomainID, body); err != nil {
+		return err
+	}
+	reqMessage := &pb.Message{
+		Id:   message.ID,
+		Type: "text",
+		Value: &pb.Message_Text{
+			Text: message.Text.String,
+		},
+	}
+	for _, item := range otherChannels {
+		var err error
+		switch {
+		case item.Type == "webitel":
+			{
+				err = e.sendEventToWebitelUser(tx, channel, item, events.MessageEditedEventType, body)
+			}
+		case isBotChannel(item):
+			{
+				err = e.editMessageInBot(tx, item, reqMessage)
+			}
+		default:
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RouteDeleteMessage notifies the members about the deleted message of the channel,
+// the copies in the external messengers are removed where the bot supports it
+func (e *eventRouter) RouteDeleteMessage(tx *sqlx.Tx, channel *pg.Channel, message *pg.Message) error {
+	otherChannels, err := e.repo.GetChannelsTx(context.Background(), tx, nil, &channel.ConversationID, nil, nil, &channel.ID)
+	if err != nil {
+		return err
+	}
+	base, err := e.newConversationEvent(tx, channel.ConversationID)
+	if err != nil {
+		return err
+	}
+	body, err := e.encode(events.MessageDeletedEventType, channel.DomainID, events.MessageDeletedEvent{
+		BaseEvent:    base,
+		FromUserID:   channel.UserID,
+		FromUserType: channel.Type,
+		MessageID:    message.ID,
+		DeletedAt:    message.DeletedAt.Time.Unix() * 1000,
+	})
+	if err != nil {
+		return err
+	}
+	if err := e.saveConversationEvent(tx, base, events.MessageDeletedEventType, body); err != nil {
+		return err
+	}
+	if err := e.notifyWebhooks(tx, events.MessageDeletedEventType, channel.DomainID, body); err != nil {
+		return err
+	}
+	for _, item := range otherChannels {
+		var err error
+		switch {
+		case item.Type == "webitel":
 			{
-				err = e.sendMessageToBotUser(nil, item, message)
+				err = e.sendEventToWebitelUser(tx, channel, item, events.MessageDeletedEventType, body)
+			}
+		case isBotChannel(item):
+			{
+				err = e.deleteMessageInBot(tx, item, message.ID)
 			}
 		default:
 		}
 		if err != nil {
-			e.log.Error().
-				Str("channel_id", item.ID).
-				Bool("internal", item.Internal).
-				Int64("user_id", item.UserID).
-				Str("conversation_id", item.ConversationID).
-				Str("type", item.Type).
-				Str("connection", item.Connection.String).
-				Msg(err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+// RouteMessageStatus notifies the members about the new delivery state of the message for the recipient channel
+func (e *eventRouter) RouteMessageStatus(tx *sqlx.Tx, channel *pg.Channel, status *pg.MessageStatus) error {
+	otherChannels, err := e.repo.GetChannelsTx(context.Background(), tx, nil, &channel.ConversationID, nil, nil, &channel.ID)
+	if err != nil {
+		return err
+	}
+	base, err := e.newConversationEvent(tx, channel.ConversationID)
+	if err != nil {
+		return err
+	}
+	body, err := e.encode(events.MessageStatusEventType, channel.DomainID, events.MessageStatusEvent{
+		BaseEvent: base,
+		UserID:    channel.UserID,
+		UserType:  channel.Type,
+		MessageID: status.MessageID,
+		Status:    status.Status,
+		Cause:     status.Cause.String,
+		UpdatedAt: status.UpdatedAt.Unix() * 1000,
+	})
+	if err != nil {
+		return err
+	}
+	if err := e.saveConversationEvent(tx, base, events.MessageStatusEventType, body); err != nil {
+		return err
+	}
+	if err := e.notifyWebhooks(tx, events.MessageStatusEventType, channel.DomainID, body); err != nil {
+		return err
+	}
+	for _, item := range otherChannels {
+		if item.Type != "webitel" {
+			continue
+		}
+		if err := e.sendEventToWebitelUser(tx, channel, item, events.MessageStatusEventType, body); err != nil {
+			return err
 		}
 	}
 	return nil
@@ -2,49 +2,192 @@ package event_router
 
 import (
 	"context"
-	"fmt"
+	"database/sql"
 	"strconv"
+	"time"
 
 	pbbot "github.com/matvoy/chat_server/api/proto/bot"
 	pb "github.com/matvoy/chat_server/api/proto/chat"
 	pg "github.com/matvoy/chat_server/internal/repo/sqlx"
+	"github.com/matvoy/chat_server/pkg/events"
 
-	"github.com/micro/go-micro/v2/broker"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 )
 
-func (e *eventRouter) sendEventToWebitelUser(from *pg.Channel, to *pg.Channel, eventType string, body []byte) error {
-	msg := &broker.Message{
-		Header: map[string]string{
-			"content_type": "text/json",
-		},
-		Body: body,
+// flowUserType is the sender type of the messages from the flow
+const flowUserType = "flow"
+
+// isBotChannel reports whether the channel belongs to the external user of the bot service
+func isBotChannel(channel *pg.Channel) bool {
+	return !channel.Internal
+}
+
+// newBaseEvent creates the event header with the new idempotency key
+func newBaseEvent(conversationID string) events.BaseEvent {
+	return events.BaseEvent{
+		IdempotencyKey: uuid.New().String(),
+		ConversationID: conversationID,
+		Timestamp:      time.Now().Unix() * 1000,
 	}
-	if err := e.broker.Publish(fmt.Sprintf("event.%s.%v.%v", eventType, to.DomainID, to.UserID), msg); err != nil {
-		return err
+}
+
+// newMessageEvent describes the message of the sender for the members
+func newMessageEvent(base events.BaseEvent, fromUserID int64, fromUserType string, message *pb.Message) events.MessageEvent {
+	messageEvent := events.MessageEvent{
+		BaseEvent:    base,
+		FromUserID:   fromUserID,
+		FromUserType: fromUserType,
+		MessageID:    message.Id,
+		Type:         message.Type,
+		Value:        message.GetText(),
+	}
+	if postback := message.GetPostback(); postback != nil {
+		messageEvent.Value = postback.GetText()
 	}
-	return nil
+	if file := message.GetFile(); file != nil {
+		messageEvent.File = &events.File{
+			ID:       file.Id,
+			URL:      file.Url,
+			MimeType: file.MimeType,
+			Name:     file.Name,
+		}
+	}
+	return messageEvent
 }
 
-func (e *eventRouter) sendMessageToBotUser(from *pg.Channel, to *pg.Channel, message *pb.Message) error {
-	profileID, err := strconv.ParseInt(to.Connection.String, 10, 64)
+// encode serializes the event in the configured format
+func (e *eventRouter) encode(eventType string, domainID int64, event interface{}) ([]byte, error) {
+	return events.Encode(e.format, eventType, domainID, event)
+}
+
+// newConversationEvent creates the header of the event sent to all the conversation members
+// with the next sequence number of the conversation
+func (e *eventRouter) newConversationEvent(tx *sqlx.Tx, conversationID string) (events.BaseEvent, error) {
+	base := newBaseEvent(conversationID)
+	seq, err := e.repo.NextConversationEventSeqTx(context.Background(), tx, conversationID)
+	if err != nil {
+		return base, err
+	}
+	base.Seq = seq
+	return base, nil
+}
+
+// saveConversationEvent keeps the event for the members replaying the missed ones
+func (e *eventRouter) saveConversationEvent(tx *sqlx.Tx, base events.BaseEvent, eventType string, body []byte) error {
+	return e.repo.CreateConversationEventTx(context.Background(), tx, &pg.ConversationEvent{
+		ConversationID: base.ConversationID,
+		Seq:            base.Seq,
+		Type:           eventType,
+		Body:           body,
+		ContentType:    e.format.ContentType(),
+	})
+}
+
+// publish writes the broker message to the outbox of the transaction
+func (e *eventRouter) publish(tx *sqlx.Tx, topic string, body []byte) error {
+	return e.repo.CreateOutboxEventTx(context.Background(), tx, &pg.OutboxEvent{
+		Topic:       topic,
+		Body:        body,
+		ContentType: e.format.ContentType(),
+	})
+}
+
+// notifyWebhooks queues the event for the webhooks of the domain,
+// they always receive the envelope in the protobuf json mapping whatever the broker format is
+func (e *eventRouter) notifyWebhooks(tx *sqlx.Tx, eventType string, domainID int64, body []byte) error {
+	envelope, err := events.Decode(e.format.ContentType(), eventType, domainID, body)
 	if err != nil {
 		return err
 	}
-	client, err := e.repo.GetClientByID(context.Background(), to.UserID)
+	payload, err := protojson.Marshal(envelope)
 	if err != nil {
 		return err
 	}
-	if client == nil || client.ExternalID.Valid == false {
-		return fmt.Errorf("client not found. id: %v", to.UserID)
+	return e.repo.CreateWebhookDeliveriesTx(context.Background(), tx, domainID, eventType, payload)
+}
+
+func (e *eventRouter) sendEventToWebitelUser(tx *sqlx.Tx, from *pg.Channel, to *pg.Channel, eventType string, body []byte) error {
+	return e.publish(tx, events.Topic(eventType, to.DomainID, to.UserID), body)
+}
+
+// sendMessageToBotUser queues the message for the external user of the channel,
+// the task relay sends it after the commit and records the delivery
+func (e *eventRouter) sendMessageToBotUser(tx *sqlx.Tx, to *pg.Channel, message *pb.Message) error {
+	profileID, client, err := e.botUser(to)
+	if err != nil || client == nil {
+		return err
 	}
+	return e.queueBotTask(tx, pg.OutboxTaskBotSendMessage, to, message.GetId(), &pbbot.SendMessageRequest{
+		ProfileId:      profileID,
+		ExternalUserId: client.ExternalID.String,
+		Message:        message,
+	})
+}
 
-	botMessage := &pbbot.SendMessageRequest{
+// editMessageInBot queues the change of the sent message in the external messenger of the channel
+func (e *eventRouter) editMessageInBot(tx *sqlx.Tx, to *pg.Channel, message *pb.Message) error {
+	profileID, client, err := e.botUser(to)
+	if err != nil || client == nil {
+		return err
+	}
+	return e.queueBotTask(tx, pg.OutboxTaskBotEditMessage, to, message.GetId(), &pbbot.EditMessageRequest{
 		ProfileId:      profileID,
 		ExternalUserId: client.ExternalID.String,
 		Message:        message,
+	})
+}
+
+func (e *eventRouter) deleteMessageInBot(tx *sqlx.Tx, to *pg.Channel, messageID int64) error {
+	profileID, client, err := e.botUser(to)
+	if err != nil || client == nil {
+		return err
 	}
-	if _, err := e.botClient.SendMessage(context.Background(), botMessage); err != nil {
+	return e.queueBotTask(tx, pg.OutboxTaskBotDeleteMessage, to, messageID, &pbbot.DeleteMessageRequest{
+		ProfileId:      profileID,
+		ExternalUserId: client.ExternalID.String,
+	})
+}
+
+// botUser returns the bot profile and the external user of the channel,
+// the channel of the removed client is skipped since nothing can be delivered to it
+func (e *eventRouter) botUser(to *pg.Channel) (int64, *pg.Client, error) {
+	profileID, err := strconv.ParseInt(to.Connection.String, 10, 64)
+	if err != nil {
+		return 0, nil, err
+	}
+	client, err := e.repo.GetClientByID(context.Background(), to.UserID)
+	if err != nil {
+		return 0, nil, err
+	}
+	if client == nil || client.ExternalID.Valid == false {
+		e.log.Warn().
+			Str("channel_id", to.ID).
+			Int64("user_id", to.UserID).
+			Msg("client not found")
+		return 0, nil, nil
+	}
+	return profileID, client, nil
+}
+
+func (e *eventRouter) queueBotTask(tx *sqlx.Tx, kind string, to *pg.Channel, messageID int64, req proto.Message) error {
+	body, err := proto.Marshal(req)
+	if err != nil {
 		return err
 	}
-	return nil
+	return e.repo.CreateOutboxTaskTx(context.Background(), tx, &pg.OutboxTask{
+		Kind:           kind,
+		ConversationID: to.ConversationID,
+		ChannelID: sql.NullString{
+			to.ID,
+			true,
+		},
+		MessageID: sql.NullInt64{
+			messageID,
+			messageID != 0,
+		},
+		Body: body,
+	})
 }
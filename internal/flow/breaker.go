@@ -0,0 +1,97 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+// ErrCircuitOpen is returned without calling the flow while the workflow service keeps failing
+var ErrCircuitOpen = errors.New("flow circuit breaker is open")
+
+const (
+	// breakerThreshold is the number of the consecutive failed calls opening the circuit
+	breakerThreshold = 5
+	// breakerCooldown is the time the circuit stays open before the trial call
+	breakerCooldown = 30 * time.Second
+
+	callAttempts = 3
+)
+
+// circuitBreaker stops calling the workflow service after breakerThreshold failures in a row.
+// After breakerCooldown one trial call is let through, its success closes the circuit.
+type circuitBreaker struct {
+	mx       sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+func (b *circuitBreaker) allow() bool {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	if b.failures < breakerThreshold {
+		return true
+	}
+	if b.trial || time.Since(b.openedAt) < breakerCooldown {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+func (b *circuitBreaker) done(err error) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	b.trial = false
+	if err == nil {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= breakerThreshold {
+		b.openedAt = time.Now()
+	}
+}
+
+// call repeats the failed call at once, without waiting in the request.
+// The call is repeated after any transport error only if it is idempotent,
+// otherwise only if the request did not reach the flow, so the flow does not receive it twice.
+// The call must pass the options to the client, they mark the request as sent when a flow node is selected.
+// The errors returned by the flow in the response are not retried, the call should return them as nil
+// and check the response itself.
+func (b *circuitBreaker) call(idempotent bool, call func(opts ...client.CallOption) error) error {
+	var err error
+	for attempt := 0; attempt < callAttempts; attempt++ {
+		if !b.allow() {
+			return ErrCircuitOpen
+		}
+		var sent int32
+		err = call(client.WithCallWrapper(markSent(&sent)))
+		b.done(err)
+		if err == nil {
+			return nil
+		}
+		if !idempotent && atomic.LoadInt32(&sent) != 0 {
+			return err
+		}
+	}
+	return err
+}
+
+// markSent sets the flag when the client passes the request to the selected node.
+// The client fails before it if no workflow node is found or the context is done,
+// the request may reach the flow after that even if the connection fails.
+func markSent(sent *int32) client.CallWrapper {
+	return func(next client.CallFunc) client.CallFunc {
+		return func(ctx context.Context, node *registry.Node, req client.Request, rsp interface{}, opts client.CallOptions) error {
+			atomic.StoreInt32(sent, 1)
+			return next(ctx, node, req, rsp, opts)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package flow
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/errors"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+// fakeCall fails like the client: before the node is selected or in the call made through the wrappers
+func fakeCall(selected bool, calls *int) func(opts ...client.CallOption) error {
+	return func(opts ...client.CallOption) error {
+		*calls++
+		if !selected {
+			return errors.InternalServerError("go.micro.client", "service workflow: not found")
+		}
+		var callOpts client.CallOptions
+		for _, o := range opts {
+			o(&callOpts)
+		}
+		var call client.CallFunc = func(ctx context.Context, node *registry.Node, req client.Request, rsp interface{}, opts client.CallOptions) error {
+			return errors.InternalServerError("go.micro.client", "transport is closing")
+		}
+		for i := len(callOpts.CallWrappers); i > 0; i-- {
+			call = callOpts.CallWrappers[i-1](call)
+		}
+		return call(context.Background(), &registry.Node{}, nil, nil, callOpts)
+	}
+}
+
+func TestCircuitBreakerCall(t *testing.T) {
+	tests := []struct {
+		name       string
+		idempotent bool
+		selected   bool
+		calls      int
+	}{
+		{
+			name:     "not sent request is repeated",
+			selected: false,
+			calls:    callAttempts,
+		},
+		{
+			name:     "sent request is not repeated",
+			selected: true,
+			calls:    1,
+		},
+		{
+			name:       "sent idempotent request is repeated",
+			idempotent: true,
+			selected:   true,
+			calls:      callAttempts,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := &circuitBreaker{}
+			calls := 0
+			if err := b.call(test.idempotent, fakeCall(test.selected, &calls)); err == nil {
+				t.Fatal("expected the call error")
+			}
+			if calls != test.calls {
+				t.Errorf("expected %v calls, got %v", test.calls, calls)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerOpen(t *testing.T) {
+	b := &circuitBreaker{}
+	calls := 0
+	for i := 0; i < breakerThreshold; i++ {
+		b.call(false, fakeCall(true, &calls))
+	}
+	if err := b.call(false, fakeCall(true, &calls)); err != ErrCircuitOpen {
+		t.Fatalf("expected the open circuit, got %v", err)
+	}
+	if calls != breakerThreshold {
+		t.Errorf("expected %v calls, got %v", breakerThreshold, calls)
+	}
+}
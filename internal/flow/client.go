@@ -3,15 +3,25 @@ package flow
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
 	pb "github.com/matvoy/chat_server/api/proto/chat"
 	pbmanager "github.com/matvoy/chat_server/api/proto/flow_manager"
 	cache "github.com/matvoy/chat_server/internal/chat_cache"
 
+	"github.com/google/uuid"
 	"github.com/micro/go-micro/v2/client"
 	"github.com/micro/go-micro/v2/client/selector"
 	"github.com/micro/go-micro/v2/registry"
 	"github.com/rs/zerolog"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// failoverLockExpiry must cover the start of the conversation on the new node
+	failoverLockExpiry = 10 * time.Second
+	failoverLockPoll   = 100 * time.Millisecond
 )
 
 type BreakBridgeCause int32
@@ -22,17 +32,29 @@ const (
 	TimeoutCause
 )
 
+var breakBridgeCauses = [...]string{
+	"DECLINE_INVITATION",
+	"LEAVE_CONVERSATION",
+	"TIMEOUT",
+}
+
 func (c BreakBridgeCause) String() string {
-	return [...]string{
-		"DECLINE_INVITATION",
-		"LEAVE_CONVERSATION",
-		"TIMEOUT",
-	}[c]
+	return breakBridgeCauses[c]
+}
+
+// ParseBreakBridgeCause returns the cause by its name
+func ParseBreakBridgeCause(name string) (BreakBridgeCause, error) {
+	for c, causeName := range breakBridgeCauses {
+		if causeName == name {
+			return BreakBridgeCause(c), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown break bridge cause: %s", name)
 }
 
 type Client interface {
 	SendMessage(conversationID string, message *pb.Message) error
-	Init(conversationID string, profileID, domainID int64, message *pb.Message) error
+	Init(conversationID string, profileID, domainID int64, message *pb.Message, variables map[string]string) error
 	BreakBridge(conversationID string, cause BreakBridgeCause) error
 	CloseConversation(conversationID string) error
 }
@@ -41,122 +63,142 @@ type flowClient struct {
 	log       *zerolog.Logger
 	client    pbmanager.FlowChatServerService
 	chatCache cache.ChatCache
+	registry  registry.Registry
+	breaker   *circuitBreaker
 }
 
 func NewClient(
 	log *zerolog.Logger,
 	client pbmanager.FlowChatServerService,
 	chatCache cache.ChatCache,
+	registry registry.Registry,
 ) *flowClient {
 	return &flowClient{
 		log,
 		client,
 		chatCache,
+		registry,
+		&circuitBreaker{},
 	}
 }
 
+// SendMessage passes the message to the flow if it waits for one,
+// otherwise the message is buffered until the next WaitMessage
 func (s *flowClient) SendMessage(conversationID string, message *pb.Message) error {
-	confirmationID, err := s.chatCache.ReadConfirmation(conversationID)
+	// the confirmation is dropped if the conversation moves to another node
+	nodeID, err := s.conversationNode(conversationID)
+	if err != nil {
+		return err
+	}
+	// the confirmation is taken or the message is buffered atomically,
+	// so the message is not passed by WaitMessage as well
+	confirmationID, err := s.chatCache.ConfirmMessage(conversationID, message)
 	if err != nil {
 		return err
 	}
 	if confirmationID == nil {
+		s.log.Debug().
+			Str("conversation_id", conversationID).
+			Int64("message_id", message.GetId()).
+			Msg("cache message for confirmation")
 		return nil
 	}
+	return s.sendConfirmedMessages(conversationID, nodeID, string(confirmationID), []*pb.Message{message})
+}
+
+func (s *flowClient) sendConfirmedMessages(conversationID, nodeID, confirmationID string, messages []*pb.Message) error {
 	s.log.Debug().
 		Str("conversation_id", conversationID).
-		Str("confirmation_id", string(confirmationID)).
+		Str("node_id", nodeID).
+		Str("confirmation_id", confirmationID).
+		Int("count", len(messages)).
 		Msg("send confirmed messages")
-	messages := []*pbmanager.Message{
-		{
-			Id:   message.GetId(),
-			Type: message.GetType(),
-			Value: &pbmanager.Message_Text{
-				Text: message.GetText(),
-			},
-		},
-	}
 	messageReq := &pbmanager.ConfirmationMessageRequest{
 		ConversationId: conversationID,
-		ConfirmationId: string(confirmationID),
-		Messages:       messages,
+		ConfirmationId: confirmationID,
+		Messages:       make([]*pbmanager.Message, 0, len(messages)),
 	}
-	nodeID, err := s.chatCache.ReadConversationNode(conversationID)
-	if err != nil {
-		return err
+	for _, m := range messages {
+		messageReq.Messages = append(messageReq.Messages, transformMessage(m))
 	}
-	if res, err := s.client.ConfirmationMessage(
-		context.Background(),
-		messageReq,
-		client.WithSelectOption(
-			selector.WithFilter(
-				FilterNodes(string(nodeID)),
-			),
-		),
-	); err != nil || res.Error != nil {
-		if res != nil {
-			return errors.New(res.Error.Message)
-		}
+	var res *pbmanager.ConfirmationMessageResponse
+	if err := s.breaker.call(false, func(opts ...client.CallOption) (err error) {
+		res, err = s.client.ConfirmationMessage(
+			context.Background(),
+			messageReq,
+			append(
+				opts,
+				client.WithSelectOption(
+					selector.WithFilter(
+						FilterNodes(nodeID),
+					),
+				),
+			)...,
+		)
+		return err
+	}); err != nil {
 		return err
 	}
-	s.chatCache.DeleteConfirmation(conversationID)
+	if res.Error != nil {
+		return errors.New(res.Error.Message)
+	}
 	return nil
-
-	// s.log.Debug().
-	// 	Int64("conversation_id", conversationID).
-	// 	Msg("cache messages for confirmation")
-	// cacheMessage := &pb.Message{
-	// 	Id:   message.GetId(),
-	// 	Type: message.GetType(),
-	// 	Value: &pb.Message_TextMessage_{
-	// 		TextMessage: &pb.Message_TextMessage{
-	// 			Text: message.GetTextMessage().GetText(),
-	// 		},
-	// 	},
-	// }
-	// messageBytes, err := proto.Marshal(cacheMessage)
-	// if err != nil {
-	// 	s.log.Error().Msg(err.Error())
-	// 	return nil
-	// }
-	// if err := s.chatCache.WriteCachedMessage(conversationID, message.GetId(), messageBytes); err != nil {
-	// 	s.log.Error().Msg(err.Error())
-	// }
-	// return nil
 }
 
-func (s *flowClient) Init(conversationID string, profileID, domainID int64, message *pb.Message) error {
+// Init starts the flow schema of the profile with the first message of the conversation and its variables.
+// The flow receives the "start" text if the conversation was started without a message.
+// The start request is kept to restart the conversation if its node leaves.
+func (s *flowClient) Init(conversationID string, profileID, domainID int64, message *pb.Message, variables map[string]string) error {
 	s.log.Debug().
 		Str("conversation_id", conversationID).
 		Int64("profile_id", profileID).
 		Int64("domain_id", domainID).
+		Int64("message_id", message.GetId()).
+		Int("variables", len(variables)).
 		Msg("init conversation")
 	start := &pbmanager.StartRequest{
 		ConversationId: conversationID,
 		ProfileId:      profileID,
 		DomainId:       domainID,
-		Message: &pbmanager.Message{
-			Id:   message.GetId(),
-			Type: message.GetType(),
-			Value: &pbmanager.Message_Text{
-				Text: "start", //req.GetMessage().GetTextMessage().GetText(),
-			},
-		},
+		Variables:      variables,
 	}
-	if res, err := s.client.Start(
-		context.Background(),
-		start,
-		client.WithCallWrapper(
-			s.initCallWrapper(conversationID),
-		),
-	); err != nil ||
-		res.Error != nil {
-		if res != nil {
-			s.log.Error().Msg(res.Error.Message)
-		} else {
-			s.log.Error().Msg(err.Error())
-		}
-		return nil
+	if message != nil {
+		start.Message = transformMessage(message)
+	} else {
+		start.Message = startMessage()
+	}
+	startBytes, err := proto.Marshal(start)
+	if err != nil {
+		return err
+	}
+	if err := s.chatCache.WriteConversationStart(conversationID, startBytes); err != nil {
+		return err
+	}
+	if err := s.start(start); err != nil {
+		s.log.Error().Msg(err.Error())
+	}
+	return nil
+}
+
+func (s *flowClient) start(start *pbmanager.StartRequest) error {
+	var res *pbmanager.StartResponse
+	if err := s.breaker.call(false, func(opts ...client.CallOption) (err error) {
+		res, err = s.client.Start(
+			context.Background(),
+			start,
+			append(
+				opts,
+				client.WithCallWrapper(
+					s.initCallWrapper(start.ConversationId),
+				),
+			)...,
+		)
+		return err
+	}); err != nil {
+		return err
+	}
+	if res.Error != nil {
+		return errors.New(res.Error.Message)
 	}
 	return nil
 }
@@ -166,51 +208,177 @@ func (s *flowClient) CloseConversation(conversationID string) error {
 	if err != nil {
 		return err
 	}
-	if res, err := s.client.Break(
-		context.Background(),
-		&pbmanager.BreakRequest{
-			ConversationId: conversationID,
-		},
-		client.WithSelectOption(
-			selector.WithFilter(
-				FilterNodes(string(nodeID)),
-			),
-		),
-	); err != nil {
-		return err
-	} else if res != nil && res.Error != nil {
-		return errors.New(res.Error.Message)
+	// there is nothing to break on the node which left
+	if s.nodeAlive(string(nodeID)) {
+		var res *pbmanager.BreakResponse
+		if err := s.breaker.call(true, func(opts ...client.CallOption) (err error) {
+			res, err = s.client.Break(
+				context.Background(),
+				&pbmanager.BreakRequest{
+					ConversationId: conversationID,
+				},
+				append(
+					opts,
+					client.WithSelectOption(
+						selector.WithFilter(
+							FilterNodes(string(nodeID)),
+						),
+					),
+				)...,
+			)
+			return err
+		}); err != nil {
+			return err
+		}
+		if res.Error != nil {
+			return errors.New(res.Error.Message)
+		}
 	}
 	s.chatCache.DeleteCachedMessages(conversationID)
 	s.chatCache.DeleteConfirmation(conversationID)
 	s.chatCache.DeleteConversationNode(conversationID)
+	s.chatCache.DeleteConversationStart(conversationID)
 	return nil
 }
 
 func (s *flowClient) BreakBridge(conversationID string, cause BreakBridgeCause) error {
-	nodeID, err := s.chatCache.ReadConversationNode(conversationID)
+	nodeID, err := s.conversationNode(conversationID)
 	if err != nil {
 		return err
 	}
-	if res, err := s.client.BreakBridge(
-		context.Background(),
-		&pbmanager.BreakBridgeRequest{
-			ConversationId: conversationID,
-			Cause:          cause.String(),
-		},
-		client.WithSelectOption(
-			selector.WithFilter(
-				FilterNodes(string(nodeID)),
-			),
-		),
-	); err != nil {
+	var res *pbmanager.BreakBridgeResponse
+	if err := s.breaker.call(true, func(opts ...client.CallOption) (err error) {
+		res, err = s.client.BreakBridge(
+			context.Background(),
+			&pbmanager.BreakBridgeRequest{
+				ConversationId: conversationID,
+				Cause:          cause.String(),
+			},
+			append(
+				opts,
+				client.WithSelectOption(
+					selector.WithFilter(
+						FilterNodes(nodeID),
+					),
+				),
+			)...,
+		)
 		return err
-	} else if res != nil && res.Error != nil {
+	}); err != nil {
+		return err
+	}
+	if res.Error != nil {
 		return errors.New(res.Error.Message)
 	}
 	return nil
 }
 
+// conversationNode returns the workflow node of the conversation.
+// If the node left the registry, the conversation is restarted on a healthy node.
+func (s *flowClient) conversationNode(conversationID string) (string, error) {
+	nodeID, err := s.chatCache.ReadConversationNode(conversationID)
+	if err != nil {
+		return "", err
+	}
+	if s.nodeAlive(string(nodeID)) {
+		return string(nodeID), nil
+	}
+	return s.failover(conversationID, string(nodeID))
+}
+
+// nodeAlive reports whether the workflow node is registered.
+// The node is considered alive if the registry is not available, so the calls are not rerouted by mistake.
+func (s *flowClient) nodeAlive(nodeID string) bool {
+	if nodeID == "" {
+		return false
+	}
+	services, err := s.registry.GetService("workflow")
+	if err != nil {
+		s.log.Warn().Msg(err.Error())
+		return true
+	}
+	for _, service := range services {
+		for _, node := range service.Nodes {
+			if node.Id == nodeID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// failover restarts the conversation under its lock, so the replicas do not start it twice.
+// The replica which waited for the lock uses the node started by the other one.
+func (s *flowClient) failover(conversationID, lostNodeID string) (string, error) {
+	owner := uuid.New().String()
+	for waited := time.Duration(0); ; waited += failoverLockPoll {
+		locked, err := s.chatCache.LockConversation(conversationID, owner, failoverLockExpiry)
+		if err != nil {
+			return "", err
+		}
+		if locked {
+			break
+		}
+		if waited >= failoverLockExpiry {
+			return "", errors.New("conversation restart is in progress")
+		}
+		time.Sleep(failoverLockPoll)
+	}
+	defer func() {
+		if err := s.chatCache.UnlockConversation(conversationID, owner); err != nil {
+			s.log.Warn().
+				Str("conversation_id", conversationID).
+				Msg(err.Error())
+		}
+	}()
+	nodeID, err := s.chatCache.ReadConversationNode(conversationID)
+	if err != nil {
+		return "", err
+	}
+	if string(nodeID) != lostNodeID && s.nodeAlive(string(nodeID)) {
+		return string(nodeID), nil
+	}
+	return s.restart(conversationID, lostNodeID)
+}
+
+// restart starts the conversation again with the stored start request.
+// The flow receives the "failover" variable and the "start" text instead of the first message,
+// the messages buffered for the lost node are passed on the next WaitMessage.
+func (s *flowClient) restart(conversationID, lostNodeID string) (string, error) {
+	startBytes, err := s.chatCache.ReadConversationStart(conversationID)
+	if err != nil {
+		return "", err
+	}
+	if len(startBytes) == 0 {
+		return "", errors.New("flow node not found")
+	}
+	start := &pbmanager.StartRequest{}
+	if err := proto.Unmarshal(startBytes, start); err != nil {
+		return "", err
+	}
+	if start.Variables == nil {
+		start.Variables = make(map[string]string)
+	}
+	start.Variables["failover"] = "true"
+	start.Message = startMessage()
+	s.log.Warn().
+		Str("conversation_id", conversationID).
+		Str("node_id", lostNodeID).
+		Msg("flow node not found, restart conversation")
+	// the confirmation was issued by the lost node
+	if err := s.chatCache.DeleteConfirmation(conversationID); err != nil {
+		return "", err
+	}
+	if err := s.start(start); err != nil {
+		return "", err
+	}
+	nodeID, err := s.chatCache.ReadConversationNode(conversationID)
+	if err != nil {
+		return "", err
+	}
+	return string(nodeID), nil
+}
+
 func (s *flowClient) initCallWrapper(conversationID string) func(client.CallFunc) client.CallFunc {
 	return func(next client.CallFunc) client.CallFunc {
 		return func(ctx context.Context, node *registry.Node, req client.Request, rsp interface{}, opts client.CallOptions) error {
@@ -231,6 +399,92 @@ func (s *flowClient) initCallWrapper(conversationID string) func(client.CallFunc
 	}
 }
 
+// startMessage is sent to the flow started without a message of the user
+func startMessage() *pbmanager.Message {
+	return &pbmanager.Message{
+		Type: "text",
+		Value: &pbmanager.Message_Text{
+			Text: "start",
+		},
+	}
+}
+
+func transformMessage(message *pb.Message) *pbmanager.Message {
+	result := &pbmanager.Message{
+		Id:           message.GetId(),
+		Type:         message.GetType(),
+		Buttons:      transformButtonRows(message.GetButtons()),
+		QuickReplies: message.GetQuickReplies(),
+		Cards:        transformCards(message.GetCards()),
+	}
+	if file := message.GetFile(); file != nil {
+		result.Value = &pbmanager.Message_File_{
+			File: &pbmanager.Message_File{
+				Id:       file.GetId(),
+				Url:      file.GetUrl(),
+				MimeType: file.GetMimeType(),
+			},
+		}
+	} else if postback := message.GetPostback(); postback != nil {
+		result.Value = &pbmanager.Message_Postback_{
+			Postback: &pbmanager.Message_Postback{
+				Payload: postback.GetPayload(),
+				Text:    postback.GetText(),
+			},
+		}
+	} else {
+		result.Value = &pbmanager.Message_Text{
+			Text: message.GetText(),
+		}
+	}
+	return result
+}
+
+func transformButtons(buttons []*pb.Message_Button) []*pbmanager.Message_Button {
+	if len(buttons) == 0 {
+		return nil
+	}
+	result := make([]*pbmanager.Message_Button, 0, len(buttons))
+	for _, button := range buttons {
+		result = append(result, &pbmanager.Message_Button{
+			Text:    button.GetText(),
+			Type:    button.GetType(),
+			Payload: button.GetPayload(),
+			Url:     button.GetUrl(),
+		})
+	}
+	return result
+}
+
+func transformButtonRows(rows []*pb.Message_ButtonRow) []*pbmanager.Message_ButtonRow {
+	if len(rows) == 0 {
+		return nil
+	}
+	result := make([]*pbmanager.Message_ButtonRow, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, &pbmanager.Message_ButtonRow{
+			Buttons: transformButtons(row.GetButtons()),
+		})
+	}
+	return result
+}
+
+func transformCards(cards []*pb.Message_Card) []*pbmanager.Message_Card {
+	if len(cards) == 0 {
+		return nil
+	}
+	result := make([]*pbmanager.Message_Card, 0, len(cards))
+	for _, card := range cards {
+		result = append(result, &pbmanager.Message_Card{
+			Title:    card.GetTitle(),
+			Subtitle: card.GetSubtitle(),
+			ImageUrl: card.GetImageUrl(),
+			Buttons:  transformButtons(card.GetButtons()),
+		})
+	}
+	return result
+}
+
 func FilterNodes(id string) selector.Filter {
 	return func(old []*registry.Service) []*registry.Service {
 		var services []*registry.Service
@@ -0,0 +1,266 @@
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog"
+)
+
+// advisoryLockID serializes migrations run by several replicas at once
+const advisoryLockID = 7041817
+
+const createMigrationTable = `create schema if not exists chat;
+create table if not exists chat.schema_migration
+(
+    version    bigint primary key,
+    name       varchar not null,
+    applied_at timestamptz not null default now()
+)`
+
+//go:embed sql/*.sql
+var files embed.FS
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Migrator interface {
+	// Up applies all the pending migrations
+	Up(ctx context.Context) error
+	// Down rolls back the last applied migrations
+	Down(ctx context.Context, steps int) error
+	// Version returns the version of the last applied migration, 0 for the empty schema
+	Version(ctx context.Context) (int64, error)
+	// Check returns an error if the schema is behind the embedded migrations
+	Check(ctx context.Context) error
+	// Latest returns the version of the last embedded migration
+	Latest() int64
+}
+
+type migrator struct {
+	db         *sqlx.DB
+	log        *zerolog.Logger
+	migrations []*Migration
+}
+
+func NewMigrator(db *sqlx.DB, log *zerolog.Logger) (Migrator, error) {
+	migrations, err := load()
+	if err != nil {
+		return nil, err
+	}
+	return &migrator{
+		db,
+		log,
+		migrations,
+	}, nil
+}
+
+// load reads embedded files named {version}_{name}.up.sql and {version}_{name}.down.sql
+func load() ([]*Migration, error) {
+	entries, err := files.ReadDir("sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("unknown migration file: %s", fileName)
+		}
+		base := strings.TrimSuffix(fileName, "."+direction+".sql")
+		parts := strings.SplitN(base, "_", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("wrong migration file name: %s", fileName)
+		}
+		version, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("wrong migration version: %s", fileName)
+		}
+		data, err := files.ReadFile(path.Join("sql", fileName))
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{
+				Version: version,
+				Name:    parts[1],
+			}
+			byVersion[version] = m
+		} else if m.Name != parts[1] {
+			return nil, fmt.Errorf("duplicate migration version: %v", version)
+		}
+		if direction == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %v_%s must have up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func (m *migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+func (m *migrator) Version(ctx context.Context) (int64, error) {
+	var exists bool
+	if err := m.db.GetContext(ctx, &exists, "select to_regclass('chat.schema_migration') is not null"); err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, nil
+	}
+	var version int64
+	err := m.db.GetContext(ctx, &version, "select coalesce(max(version), 0) from chat.schema_migration")
+	return version, err
+}
+
+func (m *migrator) Check(ctx context.Context) error {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if version < m.Latest() {
+		return fmt.Errorf("database schema version %v is outdated, expected %v: run migrate up", version, m.Latest())
+	}
+	if version > m.Latest() {
+		return fmt.Errorf("database schema version %v is newer than expected %v", version, m.Latest())
+	}
+	return nil
+}
+
+func (m *migrator) Up(ctx context.Context) error {
+	if _, err := m.db.ExecContext(ctx, createMigrationTable); err != nil {
+		return err
+	}
+	for _, migration := range m.migrations {
+		applied, err := m.apply(ctx, migration)
+		if err != nil {
+			return fmt.Errorf("migration %v_%s: %s", migration.Version, migration.Name, err)
+		}
+		if applied {
+			m.log.Info().
+				Int64("version", migration.Version).
+				Str("name", migration.Name).
+				Msg("migration applied")
+		}
+	}
+	return nil
+}
+
+// apply runs the migration if it is not applied yet, the lock makes it safe for concurrent runs
+func (m *migrator) apply(ctx context.Context, migration *Migration) (applied bool, err error) {
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+	if _, err = tx.ExecContext(ctx, "select pg_advisory_xact_lock($1)", advisoryLockID); err != nil {
+		return false, err
+	}
+	var exists bool
+	if err = tx.GetContext(ctx, &exists, "select exists(select 1 from chat.schema_migration where version=$1)", migration.Version); err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+	if _, err = tx.ExecContext(ctx, migration.Up); err != nil {
+		return false, err
+	}
+	if _, err = tx.ExecContext(ctx, "insert into chat.schema_migration (version, name) values ($1, $2)", migration.Version, migration.Name); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (m *migrator) Down(ctx context.Context, steps int) error {
+	for i := 0; i < steps; i++ {
+		version, err := m.Version(ctx)
+		if err != nil {
+			return err
+		}
+		if version == 0 {
+			return nil
+		}
+		migration := m.find(version)
+		if migration == nil {
+			return fmt.Errorf("unknown migration version: %v", version)
+		}
+		if err := m.revert(ctx, migration); err != nil {
+			return fmt.Errorf("migration %v_%s: %s", migration.Version, migration.Name, err)
+		}
+		m.log.Info().
+			Int64("version", migration.Version).
+			Str("name", migration.Name).
+			Msg("migration reverted")
+	}
+	return nil
+}
+
+func (m *migrator) revert(ctx context.Context, migration *Migration) (err error) {
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+	if _, err = tx.ExecContext(ctx, "select pg_advisory_xact_lock($1)", advisoryLockID); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, migration.Down); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "delete from chat.schema_migration where version=$1", migration.Version)
+	return err
+}
+
+func (m *migrator) find(version int64) *Migration {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration
+		}
+	}
+	return nil
+}
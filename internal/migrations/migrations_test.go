@@ -0,0 +1,110 @@
+package migrations
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog"
+)
+
+func TestLoad(t *testing.T) {
+	migrations, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, migration := range migrations {
+		if migration.Version != int64(i+1) {
+			t.Errorf("expected version %v, got %v_%s", i+1, migration.Version, migration.Name)
+		}
+		if migration.Up == "" || migration.Down == "" {
+			t.Errorf("migration %v_%s has no up or down", migration.Version, migration.Name)
+		}
+	}
+}
+
+func newTestMigrator(t *testing.T) (*migrator, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	log := zerolog.Nop()
+	return &migrator{
+		sqlx.NewDb(db, "postgres"),
+		&log,
+		[]*Migration{
+			{
+				Version: 1,
+				Name:    "init",
+				Up:      "create table chat.a (id bigint)",
+				Down:    "drop table chat.a",
+			},
+			{
+				Version: 2,
+				Name:    "b",
+				Up:      "create table chat.b (id bigint)",
+				Down:    "drop table chat.b",
+			},
+		},
+	}, mock
+}
+
+func TestUp(t *testing.T) {
+	m, mock := newTestMigrator(t)
+	mock.ExpectExec(createMigrationTable).WillReturnResult(sqlmock.NewResult(0, 0))
+	// the first migration is applied by another replica
+	mock.ExpectBegin()
+	mock.ExpectExec("select pg_advisory_xact_lock($1)").WithArgs(advisoryLockID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("select exists(select 1 from chat.schema_migration where version=$1)").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("select pg_advisory_xact_lock($1)").WithArgs(advisoryLockID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("select exists(select 1 from chat.schema_migration where version=$1)").WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec("create table chat.b (id bigint)").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into chat.schema_migration (version, name) values ($1, $2)").WithArgs(2, "b").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDown(t *testing.T) {
+	m, mock := newTestMigrator(t)
+	for _, migration := range []*Migration{m.migrations[1], m.migrations[0]} {
+		mock.ExpectQuery("select to_regclass('chat.schema_migration') is not null").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery("select coalesce(max(version), 0) from chat.schema_migration").
+			WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(migration.Version))
+		mock.ExpectBegin()
+		mock.ExpectExec("select pg_advisory_xact_lock($1)").WithArgs(advisoryLockID).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(migration.Down).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("delete from chat.schema_migration where version=$1").WithArgs(migration.Version).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+	// the schema is empty after the steps
+	mock.ExpectQuery("select to_regclass('chat.schema_migration') is not null").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery("select coalesce(max(version), 0) from chat.schema_migration").
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(0))
+	if err := m.Down(context.Background(), 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,6 @@
+drop table if exists chat.message;
+drop table if exists chat.invite;
+drop table if exists chat.channel;
+drop table if exists chat.conversation;
+drop table if exists chat.profile;
+drop table if exists chat.client;
@@ -0,0 +1,85 @@
+create schema if not exists chat;
+
+create table if not exists chat.client
+(
+    id          bigserial primary key,
+    name        varchar,
+    number      varchar,
+    created_at  timestamptz default now(),
+    activity_at timestamptz,
+    external_id varchar,
+    first_name  varchar,
+    last_name   varchar
+);
+
+create index if not exists client_external_id_index on chat.client (external_id);
+
+create table if not exists chat.profile
+(
+    id         bigserial primary key,
+    name       varchar not null,
+    schema_id  bigint,
+    type       varchar not null,
+    variables  jsonb   not null default '{}',
+    domain_id  bigint  not null,
+    created_at timestamptz default now()
+);
+
+create index if not exists profile_domain_id_index on chat.profile (domain_id);
+
+create table if not exists chat.conversation
+(
+    id         varchar primary key,
+    title      varchar,
+    created_at timestamptz,
+    closed_at  timestamptz,
+    updated_at timestamptz,
+    domain_id  bigint not null
+);
+
+create index if not exists conversation_domain_id_index on chat.conversation (domain_id);
+
+create table if not exists chat.channel
+(
+    id              varchar primary key,
+    type            varchar not null,
+    conversation_id varchar not null references chat.conversation (id) on delete cascade,
+    user_id         bigint  not null,
+    connection      varchar,
+    created_at      timestamptz,
+    internal        boolean not null default false,
+    closed_at       timestamptz,
+    updated_at      timestamptz,
+    domain_id       bigint  not null,
+    flow_bridge     boolean not null default false,
+    name            varchar not null default ''
+);
+
+create index if not exists channel_conversation_id_index on chat.channel (conversation_id);
+create index if not exists channel_user_id_index on chat.channel (user_id);
+
+create table if not exists chat.invite
+(
+    id                 varchar primary key,
+    conversation_id    varchar not null references chat.conversation (id) on delete cascade,
+    user_id            bigint  not null,
+    title              varchar,
+    timeout_sec        bigint  not null default 0,
+    inviter_channel_id varchar,
+    closed_at          timestamptz,
+    created_at         timestamptz,
+    domain_id          bigint  not null
+);
+
+create table if not exists chat.message
+(
+    id              bigserial primary key,
+    channel_id      varchar,
+    conversation_id varchar not null references chat.conversation (id) on delete cascade,
+    text            varchar,
+    created_at      timestamptz,
+    updated_at      timestamptz,
+    type            varchar not null
+);
+
+create index if not exists message_conversation_id_index on chat.message (conversation_id);
@@ -0,0 +1,5 @@
+alter table chat.message
+    drop column if exists file_id,
+    drop column if exists file_url,
+    drop column if exists file_mime_type,
+    drop column if exists file_name;
@@ -0,0 +1,5 @@
+alter table chat.message
+    add column if not exists file_id        bigint,
+    add column if not exists file_url       varchar,
+    add column if not exists file_mime_type varchar,
+    add column if not exists file_name      varchar;
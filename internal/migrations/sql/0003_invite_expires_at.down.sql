@@ -0,0 +1,4 @@
+drop index if exists chat.invite_expires_at_index;
+
+alter table chat.invite
+    drop column if exists expires_at;
@@ -0,0 +1,10 @@
+alter table chat.invite
+    add column if not exists expires_at timestamptz;
+
+update chat.invite
+set expires_at = created_at + timeout_sec * interval '1 second'
+where closed_at is null
+  and timeout_sec > 0;
+
+create index if not exists invite_expires_at_index on chat.invite (expires_at)
+    where closed_at is null and expires_at is not null;
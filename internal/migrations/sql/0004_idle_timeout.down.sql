@@ -0,0 +1,7 @@
+drop index if exists chat.conversation_idle_index;
+
+drop table if exists chat.domain_setting;
+
+alter table chat.profile
+    drop column if exists idle_timeout_sec,
+    drop column if exists closing_message;
@@ -0,0 +1,13 @@
+alter table chat.profile
+    add column if not exists idle_timeout_sec bigint  not null default 0,
+    add column if not exists closing_message  varchar not null default '';
+
+create table if not exists chat.domain_setting
+(
+    domain_id        bigint primary key,
+    idle_timeout_sec bigint  not null default 0,
+    closing_message  varchar not null default ''
+);
+
+create index if not exists conversation_idle_index on chat.conversation (updated_at)
+    where closed_at is null;
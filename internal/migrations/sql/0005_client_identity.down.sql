@@ -0,0 +1,7 @@
+drop index if exists chat.client_identity_index;
+
+create index if not exists client_external_id_index on chat.client (external_id);
+
+alter table chat.client
+    drop column if exists type,
+    drop column if exists profile_id;
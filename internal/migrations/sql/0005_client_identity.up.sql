@@ -0,0 +1,75 @@
+alter table chat.client
+    add column if not exists type       varchar,
+    add column if not exists profile_id bigint;
+
+-- the client identity is (type, profile_id, external_id),
+-- clients that talked to several bots are split into one client per bot
+do
+$$
+    declare
+        r      record;
+        new_id bigint;
+    begin
+        for r in
+            select i.client_id, i.type, i.profile_id, i.rn
+            from (select distinct_channel.*,
+                         row_number() over (partition by client_id order by profile_id, type) as rn
+                  from (select distinct ch.user_id                as client_id,
+                                        ch.type,
+                                        ch.connection::bigint     as profile_id
+                        from chat.channel ch
+                                 join chat.client c on c.id = ch.user_id
+                        where not ch.internal
+                          and ch.connection ~ '^[0-9]+$') distinct_channel) i
+            loop
+                if r.rn = 1 then
+                    update chat.client
+                    set type       = r.type,
+                        profile_id = r.profile_id
+                    where id = r.client_id;
+                    continue;
+                end if;
+                insert into chat.client (name, number, created_at, activity_at, external_id, first_name, last_name,
+                                         type, profile_id)
+                select name, number, created_at, activity_at, external_id, first_name, last_name, r.type, r.profile_id
+                from chat.client
+                where id = r.client_id
+                returning id into new_id;
+                update chat.channel
+                set user_id = new_id
+                where user_id = r.client_id
+                  and not internal
+                  and type = r.type
+                  and connection = r.profile_id::varchar;
+            end loop;
+    end
+$$;
+
+-- duplicates of the same identity are merged into the oldest client
+with duplicate as (
+    select id,
+           min(id) over (partition by type, profile_id, external_id) as keep_id
+    from chat.client
+    where type is not null
+      and profile_id is not null
+      and external_id is not null
+)
+update chat.channel ch
+set user_id = d.keep_id
+from duplicate d
+where ch.user_id = d.id
+  and d.id <> d.keep_id
+  and not ch.internal;
+
+delete
+from chat.client c
+where exists(select 1
+             from chat.client k
+             where k.type = c.type
+               and k.profile_id = c.profile_id
+               and k.external_id = c.external_id
+               and k.id < c.id);
+
+drop index if exists chat.client_external_id_index;
+
+create unique index if not exists client_identity_index on chat.client (type, profile_id, external_id);
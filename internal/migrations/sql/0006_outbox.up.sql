@@ -0,0 +1,14 @@
+create table if not exists chat.outbox
+(
+    id              bigserial primary key,
+    topic           varchar     not null,
+    body            bytea       not null,
+    created_at      timestamptz not null default now(),
+    attempts        integer     not null default 0,
+    next_attempt_at timestamptz not null default now(),
+    sent_at         timestamptz,
+    last_error      varchar
+);
+
+create index if not exists outbox_pending_index on chat.outbox (next_attempt_at)
+    where sent_at is null;
@@ -0,0 +1,4 @@
+drop table if exists chat.conversation_event;
+
+alter table chat.conversation
+    drop column if exists last_event_seq;
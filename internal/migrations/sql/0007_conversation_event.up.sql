@@ -0,0 +1,12 @@
+alter table chat.conversation
+    add column if not exists last_event_seq bigint not null default 0;
+
+create table if not exists chat.conversation_event
+(
+    conversation_id varchar     not null references chat.conversation (id) on delete cascade,
+    seq             bigint      not null,
+    type            varchar     not null,
+    body            bytea       not null,
+    created_at      timestamptz not null default now(),
+    primary key (conversation_id, seq)
+);
@@ -0,0 +1,5 @@
+alter table chat.conversation_event
+    drop column if exists content_type;
+
+alter table chat.outbox
+    drop column if exists content_type;
@@ -0,0 +1,5 @@
+alter table chat.outbox
+    add column if not exists content_type varchar not null default 'text/json';
+
+alter table chat.conversation_event
+    add column if not exists content_type varchar not null default 'text/json';
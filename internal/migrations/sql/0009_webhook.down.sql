@@ -0,0 +1,5 @@
+drop table if exists chat.webhook_delivery_log;
+
+drop table if exists chat.webhook_delivery;
+
+drop table if exists chat.webhook;
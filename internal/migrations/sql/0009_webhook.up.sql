@@ -0,0 +1,45 @@
+create table if not exists chat.webhook
+(
+    id          bigserial primary key,
+    domain_id   bigint      not null,
+    url         varchar     not null,
+    event_types varchar[]   not null default '{}',
+    secret      varchar     not null,
+    enabled     boolean     not null default true,
+    created_at  timestamptz not null default now(),
+    updated_at  timestamptz not null default now()
+);
+
+create index if not exists webhook_domain_id_index on chat.webhook (domain_id);
+
+create table if not exists chat.webhook_delivery
+(
+    id               bigserial primary key,
+    webhook_id       bigint      not null references chat.webhook (id) on delete cascade,
+    event_type       varchar     not null,
+    body             bytea       not null,
+    status           varchar     not null default 'pending',
+    attempts         integer     not null default 0,
+    last_status_code integer     not null default 0,
+    last_error       varchar     not null default '',
+    created_at       timestamptz not null default now(),
+    next_attempt_at  timestamptz not null default now(),
+    sent_at          timestamptz
+);
+
+create index if not exists webhook_delivery_pending_index on chat.webhook_delivery (next_attempt_at)
+    where status = 'pending';
+create index if not exists webhook_delivery_webhook_id_index on chat.webhook_delivery (webhook_id, id);
+
+create table if not exists chat.webhook_delivery_log
+(
+    id          bigserial primary key,
+    delivery_id bigint      not null references chat.webhook_delivery (id) on delete cascade,
+    attempt     integer     not null,
+    status_code integer     not null default 0,
+    error       varchar     not null default '',
+    duration_ms bigint      not null default 0,
+    created_at  timestamptz not null default now()
+);
+
+create index if not exists webhook_delivery_log_delivery_id_index on chat.webhook_delivery_log (delivery_id);
@@ -0,0 +1,2 @@
+alter table chat.conversation
+    drop column if exists variables;
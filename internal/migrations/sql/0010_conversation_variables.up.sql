@@ -0,0 +1,2 @@
+alter table chat.conversation
+    add column if not exists variables jsonb not null default '{}';
@@ -0,0 +1,2 @@
+alter table chat.message
+    drop column if exists interactive;
@@ -0,0 +1,2 @@
+alter table chat.message
+    add column if not exists interactive jsonb;
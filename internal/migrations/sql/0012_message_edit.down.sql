@@ -0,0 +1,7 @@
+drop table if exists chat.message_edit;
+
+drop table if exists chat.message_external;
+
+alter table chat.message
+    drop column if exists edited_at,
+    drop column if exists deleted_at;
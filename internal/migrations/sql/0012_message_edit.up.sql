@@ -0,0 +1,26 @@
+alter table chat.message
+    add column if not exists edited_at  timestamptz,
+    add column if not exists deleted_at timestamptz;
+
+-- ids of the message in the external messengers: the received one in the channel of the author
+-- and the sent ones in the channels of the recipients
+create table if not exists chat.message_external
+(
+    message_id  bigint  not null references chat.message (id) on delete cascade,
+    channel_id  varchar not null,
+    external_id varchar not null,
+    primary key (message_id, channel_id)
+);
+
+create index if not exists message_external_channel_index on chat.message_external (channel_id, external_id);
+
+-- the text of the message before every edit
+create table if not exists chat.message_edit
+(
+    id         bigserial primary key,
+    message_id bigint      not null references chat.message (id) on delete cascade,
+    text       varchar,
+    edited_at  timestamptz not null default now()
+);
+
+create index if not exists message_edit_message_id_index on chat.message_edit (message_id);
@@ -0,0 +1,12 @@
+-- delivery state of the message for every recipient channel
+create table if not exists chat.message_status
+(
+    message_id bigint      not null references chat.message (id) on delete cascade,
+    channel_id varchar     not null,
+    status     varchar     not null,
+    cause      varchar,
+    updated_at timestamptz not null default now(),
+    primary key (message_id, channel_id)
+);
+
+create index if not exists message_status_channel_index on chat.message_status (channel_id, status);
@@ -0,0 +1,21 @@
+-- calls to the bot and flow services queued in the transaction of the change,
+-- the tasks of the same channel are run in order of creation
+create table if not exists chat.outbox_task
+(
+    id              bigserial primary key,
+    kind            varchar     not null,
+    conversation_id varchar     not null,
+    channel_id      varchar,
+    message_id      bigint,
+    body            bytea       not null,
+    created_at      timestamptz not null default now(),
+    attempts        integer     not null default 0,
+    next_attempt_at timestamptz not null default now(),
+    done_at         timestamptz,
+    last_error      varchar
+);
+
+create index if not exists outbox_task_pending_index on chat.outbox_task (next_attempt_at)
+    where done_at is null;
+create index if not exists outbox_task_channel_index on chat.outbox_task (channel_id, id)
+    where done_at is null;
@@ -35,29 +35,29 @@ func (repo *sqlxRepository) GetChannels(
 	queryStrings := make([]string, 0, 5)
 	queryArgs := make([]interface{}, 0, 5)
 	if userID != nil {
-		queryStrings = append(queryStrings, "user_id")
+		queryStrings = append(queryStrings, "user_id=")
 		queryArgs = append(queryArgs, *userID)
 	}
 	if conversationID != nil {
-		queryStrings = append(queryStrings, "conversation_id")
+		queryStrings = append(queryStrings, "conversation_id=")
 		queryArgs = append(queryArgs, *conversationID)
 	}
 	if connection != nil {
-		queryStrings = append(queryStrings, "connection")
+		queryStrings = append(queryStrings, "connection=")
 		queryArgs = append(queryArgs, *connection)
 	}
 	if internal != nil {
-		queryStrings = append(queryStrings, "internal")
+		queryStrings = append(queryStrings, "internal=")
 		queryArgs = append(queryArgs, *internal)
 	}
 	if exceptID != nil {
-		queryStrings = append(queryStrings, "except_id")
+		queryStrings = append(queryStrings, "id<>")
 		queryArgs = append(queryArgs, *exceptID)
 	}
 	if len(queryArgs) > 0 {
 		where := " closed_at is null and"
 		for i, _ := range queryArgs {
-			where = where + fmt.Sprintf(" %s=$%v and", queryStrings[i], i+1)
+			where = where + fmt.Sprintf(" %s$%v and", queryStrings[i], i+1)
 		}
 		where = strings.TrimRight(where, " and")
 		err := repo.db.SelectContext(ctx, &result, fmt.Sprintf("SELECT * FROM chat.channel where%s", where), queryArgs...)
@@ -19,9 +19,11 @@ func (repo *sqlxRepository) GetClientByID(ctx context.Context, id int64) (*Clien
 	return result, nil
 }
 
-func (repo *sqlxRepository) GetClientByExternalID(ctx context.Context, externalID string) (*Client, error) {
+// GetClientByExternalID finds the client by its identity: the same external id
+// on the other channel type or bot profile belongs to the other client
+func (repo *sqlxRepository) GetClientByExternalID(ctx context.Context, channelType string, profileID int64, externalID string) (*Client, error) {
 	result := &Client{}
-	err := repo.db.GetContext(ctx, result, "SELECT * FROM chat.client WHERE external_id=$1", externalID)
+	err := repo.db.GetContext(ctx, result, "SELECT * FROM chat.client WHERE type=$1 and profile_id=$2 and external_id=$3", channelType, profileID, externalID)
 	if err != nil {
 		repo.log.Warn().Msg(err.Error())
 		if err == sql.ErrNoRows {
@@ -38,8 +40,10 @@ func (repo *sqlxRepository) CreateClient(ctx context.Context, c *Client) error {
 		time.Now(),
 		true,
 	}
-	stmt, err := repo.db.PrepareNamed(`insert into chat.client (name, number, created_at, external_id, first_name, last_name)
-	values (:name, :number, :created_at, :external_id, :first_name, :last_name)`)
+	stmt, err := repo.db.PrepareNamed(`insert into chat.client (name, number, created_at, external_id, first_name, last_name, type, profile_id)
+	values (:name, :number, :created_at, :external_id, :first_name, :last_name, :type, :profile_id)
+	on conflict (type, profile_id, external_id) do update set name = excluded.name
+	returning id`)
 	if err != nil {
 		return err
 	}
@@ -5,8 +5,11 @@ import (
 	"database/sql"
 	"time"
 
-	"github.com/google/uuid"
 	pb "github.com/matvoy/chat_server/api/proto/chat"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/lib/pq"
 )
 
 func (repo *sqlxRepository) GetConversationByID(ctx context.Context, id string) (*pb.Conversation, error) {
@@ -19,43 +22,12 @@ func (repo *sqlxRepository) GetConversationByID(ctx context.Context, id string)
 		}
 		return nil, err
 	}
-	channels := []*Channel{}
-	err = repo.db.SelectContext(ctx, &channels, "SELECT * FROM chat.channel where conversation_id=$1", id)
+	channels, err := repo.getConversationChannels(ctx, []string{id})
 	if err != nil {
 		repo.log.Warn().Msg(err.Error())
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
 		return nil, err
 	}
-	members := make([]*pb.Member, 0, len(channels))
-	for _, ch := range channels {
-		tmp := &pb.Member{
-			// ChannelId: ch.ID,
-			UserId:   ch.UserID,
-			Type:     ch.Type,
-			Username: ch.Name,
-			Internal: ch.Internal,
-		}
-		if ch.UpdatedAt.Valid {
-			tmp.UpdatedAt = ch.UpdatedAt.Time.Unix() * 1000
-		}
-		members = append(members, tmp)
-	}
-	result := &pb.Conversation{
-		Id:        conversation.ID,
-		Title:     conversation.Title.String,
-		CreatedAt: conversation.CreatedAt.Time.Unix() * 1000,
-		DomainId:  conversation.DomainID,
-		Members:   members,
-	}
-	if conversation.ClosedAt != (sql.NullTime{}) {
-		result.ClosedAt = conversation.ClosedAt.Time.Unix() * 1000
-	}
-	if conversation.UpdatedAt != (sql.NullTime{}) {
-		result.UpdatedAt = conversation.UpdatedAt.Time.Unix() * 1000
-	}
-	return result, nil
+	return transformConversationFromRepoModel(conversation, channels[id], 0), nil
 }
 
 func (repo *sqlxRepository) CreateConversation(ctx context.Context, c *Conversation) error {
@@ -66,8 +38,11 @@ func (repo *sqlxRepository) CreateConversation(ctx context.Context, c *Conversat
 	}
 	c.CreatedAt = tmp
 	c.UpdatedAt = tmp
-	_, err := repo.db.NamedExecContext(ctx, `insert into chat.conversation (id, title, created_at, closed_at, updated_at, domain_id)
-	values (:id, :title, :created_at, :closed_at, :updated_at, :domain_id)`, *c)
+	if len(c.Variables) == 0 {
+		c.Variables = types.JSONText("{}")
+	}
+	_, err := repo.db.NamedExecContext(ctx, `insert into chat.conversation (id, title, created_at, closed_at, updated_at, domain_id, variables)
+	values (:id, :title, :created_at, :closed_at, :updated_at, :domain_id, :variables)`, *c)
 	return err
 }
 
@@ -89,64 +64,111 @@ func (repo *sqlxRepository) GetConversations(
 	domainID int64,
 	active bool,
 	userID int64,
-) ([]*pb.Conversation, error) {
-	// TO DO FILTERS
+) ([]*pb.Conversation, bool, error) {
+	columns, err := selectColumns(fields, conversationAllColumns, "c.", "id")
+	if err != nil {
+		return nil, false, err
+	}
+	order, err := orderBy(sort, conversationAllColumns, "c.", "created_at")
+	if err != nil {
+		return nil, false, err
+	}
+	filter := &where{}
+	if id != "" {
+		filter.add("c.id=$%v", id)
+	}
+	if domainID != 0 {
+		filter.add("c.domain_id=$%v", domainID)
+	}
+	if active {
+		filter.addRaw("c.closed_at is null")
+	}
+	if userID != 0 {
+		filter.add("exists (select 1 from chat.channel ch where ch.conversation_id=c.id and ch.user_id=$%v and ch.type='webitel')", userID)
+	}
 	conversations := []*Conversation{}
-	err := repo.db.SelectContext(ctx, &conversations, "SELECT * FROM chat.conversation")
+	err = repo.db.SelectContext(ctx, &conversations,
+		"SELECT "+columns+" FROM chat.conversation c"+filter.String()+order+paginate(size, page),
+		filter.args...)
 	if err != nil {
 		repo.log.Warn().Msg(err.Error())
 		if err == sql.ErrNoRows {
-			return nil, nil
+			return nil, false, nil
 		}
-		return nil, err
+		return nil, false, err
+	}
+	next := hasNext(len(conversations), size)
+	if next {
+		conversations = conversations[:len(conversations)-1]
+	}
+	ids := make([]string, 0, len(conversations))
+	for _, c := range conversations {
+		ids = append(ids, c.ID)
+	}
+	channels, err := repo.getConversationChannels(ctx, ids)
+	if err != nil {
+		repo.log.Warn().Msg(err.Error())
+		return nil, false, err
 	}
 	result := make([]*pb.Conversation, 0, len(conversations))
 	for _, c := range conversations {
-		channels := []*Channel{}
-		selfChannelID := ""
-		err := repo.db.SelectContext(ctx, &channels, "SELECT * FROM chat.channel where conversation_id=$1", c.ID)
-		if err != nil {
-			repo.log.Warn().Msg(err.Error())
-			if err == sql.ErrNoRows {
-				continue
-			}
-			return nil, err
-		}
-		if len(channels) == 0 {
-			continue
-		}
-		members := make([]*pb.Member, 0, len(channels))
-		for _, ch := range channels {
-			if ch.UserID == userID && ch.Type == "webitel" {
-				selfChannelID = ch.ID
-			}
-			tmp := &pb.Member{
-				// ChannelId: ch.ID,
-				UserId:   ch.UserID,
-				Type:     ch.Type,
-				Username: ch.Name,
-				Internal: ch.Internal,
-			}
-			if ch.UpdatedAt.Valid {
-				tmp.UpdatedAt = ch.UpdatedAt.Time.Unix() * 1000
-			}
-			members = append(members, tmp)
-		}
-		conv := &pb.Conversation{
-			Id:            c.ID,
-			Title:         c.Title.String,
-			CreatedAt:     c.CreatedAt.Time.Unix() * 1000,
-			DomainId:      c.DomainID,
-			Members:       members,
-			SelfChannelId: selfChannelID,
+		result = append(result, transformConversationFromRepoModel(c, channels[c.ID], userID))
+	}
+	return result, next, nil
+}
+
+// getConversationChannels loads channels of all the conversations in one query, grouped by conversation id
+func (repo *sqlxRepository) getConversationChannels(ctx context.Context, conversationIDs []string) (map[string][]*Channel, error) {
+	result := make(map[string][]*Channel, len(conversationIDs))
+	if len(conversationIDs) == 0 {
+		return result, nil
+	}
+	channels := []*Channel{}
+	err := repo.db.SelectContext(ctx, &channels, "SELECT * FROM chat.channel where conversation_id = any($1)", pq.Array(conversationIDs))
+	if err != nil {
+		return nil, err
+	}
+	for _, ch := range channels {
+		result[ch.ConversationID] = append(result[ch.ConversationID], ch)
+	}
+	return result, nil
+}
+
+func transformConversationFromRepoModel(c *Conversation, channels []*Channel, userID int64) *pb.Conversation {
+	selfChannelID := ""
+	members := make([]*pb.Member, 0, len(channels))
+	for _, ch := range channels {
+		if userID != 0 && ch.UserID == userID && ch.Type == "webitel" {
+			selfChannelID = ch.ID
 		}
-		if c.ClosedAt != (sql.NullTime{}) {
-			conv.ClosedAt = c.ClosedAt.Time.Unix() * 1000
+		tmp := &pb.Member{
+			// ChannelId: ch.ID,
+			UserId:   ch.UserID,
+			Type:     ch.Type,
+			Username: ch.Name,
+			Internal: ch.Internal,
 		}
-		if c.UpdatedAt != (sql.NullTime{}) {
-			conv.UpdatedAt = c.UpdatedAt.Time.Unix() * 1000
+		if ch.UpdatedAt.Valid {
+			tmp.UpdatedAt = ch.UpdatedAt.Time.Unix() * 1000
 		}
-		result = append(result, conv)
+		members = append(members, tmp)
 	}
-	return result, nil
+	result := &pb.Conversation{
+		Id:            c.ID,
+		Title:         c.Title.String,
+		CreatedAt:     c.CreatedAt.Time.Unix() * 1000,
+		DomainId:      c.DomainID,
+		Members:       members,
+		SelfChannelId: selfChannelID,
+	}
+	if c.ClosedAt != (sql.NullTime{}) {
+		result.ClosedAt = c.ClosedAt.Time.Unix() * 1000
+	}
+	if c.UpdatedAt != (sql.NullTime{}) {
+		result.UpdatedAt = c.UpdatedAt.Time.Unix() * 1000
+	}
+	if len(c.Variables) > 0 {
+		c.Variables.Unmarshal(&result.Variables)
+	}
+	return result
 }
@@ -0,0 +1,21 @@
+package sqlxrepo
+
+import (
+	"context"
+)
+
+// GetConversationEvents returns the events of the conversation numbered after afterSeq in order
+func (repo *sqlxRepository) GetConversationEvents(ctx context.Context, conversationID string, afterSeq int64, size int32) ([]*ConversationEvent, bool, error) {
+	result := []*ConversationEvent{}
+	err := repo.db.SelectContext(ctx, &result, `SELECT * FROM chat.conversation_event
+	where conversation_id=$1 and seq>$2
+	order by seq`+paginate(size, 1), conversationID, afterSeq)
+	if err != nil {
+		return nil, false, err
+	}
+	next := hasNext(len(result), size)
+	if next {
+		result = result[:len(result)-1]
+	}
+	return result, next, nil
+}
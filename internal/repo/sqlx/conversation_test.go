@@ -0,0 +1,120 @@
+package sqlxrepo
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	pb "github.com/matvoy/chat_server/api/proto/chat"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// benchQueryLatency is the round trip to the database simulated for every query
+	benchQueryLatency   = 200 * time.Microsecond
+	benchChannelsPerRow = 3
+)
+
+// BenchmarkGetConversations compares loading the members of the page in one query
+// with the former query per conversation
+func BenchmarkGetConversations(b *testing.B) {
+	for _, size := range []int{10, 50, 100} {
+		size := size
+		b.Run(fmt.Sprintf("batched/%d", size), func(b *testing.B) {
+			benchmarkGetConversations(b, size, false)
+		})
+		b.Run(fmt.Sprintf("n+1/%d", size), func(b *testing.B) {
+			benchmarkGetConversations(b, size, true)
+		})
+	}
+}
+
+func benchmarkGetConversations(b *testing.B, size int, nPlusOne bool) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+	log := zerolog.Nop()
+	repo := &sqlxRepository{
+		sqlx.NewDb(db, "postgres"),
+		&log,
+	}
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		expectConversations(mock, size, nPlusOne)
+		b.StartTimer()
+		var conversations []*pb.Conversation
+		if nPlusOne {
+			conversations, err = getConversationsNPlusOne(ctx, repo, size)
+		} else {
+			conversations, _, err = repo.GetConversations(ctx, "", int32(size), 1, nil, nil, 1, false, 0)
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(conversations) != size {
+			b.Fatalf("expected %v conversations, got %v", size, len(conversations))
+		}
+	}
+	b.StopTimer()
+	if err := mock.ExpectationsWereMet(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// getConversationsNPlusOne loads the page the way GetConversations did before the members were batched
+func getConversationsNPlusOne(ctx context.Context, repo *sqlxRepository, size int) ([]*pb.Conversation, error) {
+	conversations := []*Conversation{}
+	err := repo.db.SelectContext(ctx, &conversations,
+		"SELECT * FROM chat.conversation c where c.domain_id=$1 order by c.created_at limit $2", 1, size+1)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*pb.Conversation, 0, len(conversations))
+	for _, c := range conversations {
+		channels, err := repo.GetChannels(ctx, nil, &c.ID, nil, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, transformConversationFromRepoModel(c, channels, 0))
+	}
+	return result, nil
+}
+
+func expectConversations(mock sqlmock.Sqlmock, size int, nPlusOne bool) {
+	now := time.Now()
+	conversations := sqlmock.NewRows(conversationAllColumns)
+	for i := 0; i < size; i++ {
+		conversations.AddRow(fmt.Sprintf("conversation-%v", i), "title", now, nil, now, 1, []byte("{}"))
+	}
+	mock.ExpectQuery("FROM chat.conversation").WillReturnRows(conversations).WillDelayFor(benchQueryLatency)
+	channels := sqlmock.NewRows(channelBenchColumns)
+	for i := 0; i < size; i++ {
+		if nPlusOne {
+			channels = sqlmock.NewRows(channelBenchColumns)
+		}
+		conversationID := fmt.Sprintf("conversation-%v", i)
+		for j := 0; j < benchChannelsPerRow; j++ {
+			channels.AddRow(fmt.Sprintf("channel-%v-%v", i, j), "webitel", conversationID, j, nil, now, true, nil, now, 1, false, "user")
+		}
+		if nPlusOne {
+			mock.ExpectQuery("FROM chat.channel").WillReturnRows(channels).WillDelayFor(benchQueryLatency)
+		}
+	}
+	if !nPlusOne {
+		mock.ExpectQuery("FROM chat.channel").WillReturnRows(channels).WillDelayFor(benchQueryLatency)
+	}
+}
+
+var channelBenchColumns = []string{
+	"id", "type", "conversation_id", "user_id", "connection", "created_at",
+	"internal", "closed_at", "updated_at", "domain_id", "flow_bridge", "name",
+}
@@ -0,0 +1,31 @@
+package sqlxrepo
+
+import (
+	"context"
+	"database/sql"
+)
+
+// GetDomainSetting returns the defaults of the domain, the domain without the row has the zero values
+func (repo *sqlxRepository) GetDomainSetting(ctx context.Context, domainID int64) (*DomainSetting, error) {
+	result := &DomainSetting{}
+	err := repo.db.GetContext(ctx, result, "SELECT * FROM chat.domain_setting WHERE domain_id=$1", domainID)
+	if err == sql.ErrNoRows {
+		return &DomainSetting{
+			DomainID: domainID,
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// UpdateDomainSetting creates the row of the domain on the first update
+func (repo *sqlxRepository) UpdateDomainSetting(ctx context.Context, d *DomainSetting) error {
+	_, err := repo.db.NamedExecContext(ctx, `insert into chat.domain_setting (domain_id, idle_timeout_sec, closing_message)
+	values (:domain_id, :idle_timeout_sec, :closing_message)
+	on conflict (domain_id) do update set
+		idle_timeout_sec=excluded.idle_timeout_sec,
+		closing_message=excluded.closing_message`, *d)
+	return err
+}
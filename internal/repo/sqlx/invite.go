@@ -33,8 +33,14 @@ func (repo *sqlxRepository) CreateInvite(ctx context.Context, m *Invite) error {
 		time.Now(),
 		true,
 	}
-	_, err := repo.db.NamedExecContext(ctx, `insert into chat.invite (id, conversation_id, user_id, title, timeout_sec, inviter_channel_id, created_at, domain_id)
-	values (:id, :conversation_id, :user_id, :title, :timeout_sec, :inviter_channel_id, :created_at, :domain_id)`, *m)
+	if m.TimeoutSec > 0 {
+		m.ExpiresAt = sql.NullTime{
+			m.CreatedAt.Time.Add(time.Duration(m.TimeoutSec) * time.Second),
+			true,
+		}
+	}
+	_, err := repo.db.NamedExecContext(ctx, `insert into chat.invite (id, conversation_id, user_id, title, timeout_sec, inviter_channel_id, created_at, domain_id, expires_at)
+	values (:id, :conversation_id, :user_id, :title, :timeout_sec, :inviter_channel_id, :created_at, :domain_id, :expires_at)`, *m)
 	if err != nil {
 		return err
 	}
@@ -42,7 +48,7 @@ func (repo *sqlxRepository) CreateInvite(ctx context.Context, m *Invite) error {
 }
 
 func (repo *sqlxRepository) CloseInvite(ctx context.Context, inviteID string) error {
-	_, err := repo.db.ExecContext(ctx, `update chat.invite set closed_at=$1 where id=$2`, sql.NullTime{
+	_, err := repo.db.ExecContext(ctx, `update chat.invite set closed_at=$1 where id=$2 and closed_at is null`, sql.NullTime{
 		Valid: true,
 		Time:  time.Now(),
 	}, inviteID)
@@ -3,6 +3,7 @@ package sqlxrepo
 import (
 	"context"
 	"database/sql"
+	"strconv"
 	"time"
 )
 
@@ -14,8 +15,8 @@ func (repo *sqlxRepository) CreateMessage(ctx context.Context, m *Message) error
 	}
 	m.CreatedAt = tmp
 	m.UpdatedAt = tmp
-	stmt, err := repo.db.PrepareNamed(`insert into chat.message (channel_id, conversation_id, text, created_at, updated_at, type)
-	values (:channel_id, :conversation_id, :text, :created_at, :updated_at, :type) RETURNING id`)
+	stmt, err := repo.db.PrepareNamed(`insert into chat.message (channel_id, conversation_id, text, created_at, updated_at, type, file_id, file_url, file_mime_type, file_name, interactive)
+	values (:channel_id, :conversation_id, :text, :created_at, :updated_at, :type, :file_id, :file_url, :file_mime_type, :file_name, :interactive) RETURNING id`)
 	if err != nil {
 		return err
 	}
@@ -33,35 +34,122 @@ func (repo *sqlxRepository) CreateMessage(ctx context.Context, m *Message) error
 	return err
 }
 
-func (repo *sqlxRepository) GetMessages(ctx context.Context, id int64, size, page int32, fields, sort []string, conversationID string) ([]*Message, error) {
+func (repo *sqlxRepository) GetMessages(ctx context.Context, id int64, size, page int32, fields, sort []string, conversationID string, domainID int64) ([]*Message, bool, error) {
+	columns, err := selectColumns(fields, messageAllColumns, "m.", "id")
+	if err != nil {
+		return nil, false, err
+	}
+	order, err := orderBy(sort, messageAllColumns, "m.", "created_at")
+	if err != nil {
+		return nil, false, err
+	}
+	filter := &where{}
+	if id != 0 {
+		filter.add("m.id=$%v", id)
+	}
+	if conversationID != "" {
+		filter.add("m.conversation_id=$%v", conversationID)
+	}
+	if domainID != 0 {
+		filter.add("exists (select 1 from chat.conversation cv where cv.id=m.conversation_id and cv.domain_id=$%v)", domainID)
+	}
 	result := []*Message{}
-	// TO DO FILTERS
-	err := repo.db.SelectContext(ctx, &result, "SELECT m.*, c.user_id, c.type as user_type FROM chat.message m left join chat.channels c on m.channel_id = c.id")
+	err = repo.db.SelectContext(ctx, &result,
+		"SELECT "+columns+", c.user_id, c.type as user_type FROM chat.message m left join chat.channel c on m.channel_id = c.id"+
+			filter.String()+order+paginate(size, page),
+		filter.args...)
+	if err != nil {
+		return nil, false, err
+	}
+	next := hasNext(len(result), size)
+	if next {
+		result = result[:len(result)-1]
+	}
+	return result, next, nil
+}
+
+func (repo *sqlxRepository) GetMessageByID(ctx context.Context, id int64) (*Message, error) {
+	result := &Message{}
+	err := repo.db.GetContext(ctx, result, `SELECT m.*, c.user_id, c.type as user_type
+	FROM chat.message m left join chat.channel c on m.channel_id = c.id
+	WHERE m.id=$1`, id)
+	if err != nil {
+		repo.log.Warn().Msg(err.Error())
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetMessageByExternalID finds the message by its id in the external messenger of the channel
+func (repo *sqlxRepository) GetMessageByExternalID(ctx context.Context, channelID, externalID string) (*Message, error) {
+	result := &Message{}
+	err := repo.db.GetContext(ctx, result, `SELECT m.*, c.user_id, c.type as user_type
+	FROM chat.message m
+	join chat.message_external e on e.message_id = m.id
+	left join chat.channel c on m.channel_id = c.id
+	WHERE e.channel_id=$1 and e.external_id=$2`, channelID, externalID)
+	if err != nil {
+		repo.log.Warn().Msg(err.Error())
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetMessageExternalID returns the id of the message in the external messenger of the channel, empty if it is unknown
+func (repo *sqlxRepository) GetMessageExternalID(ctx context.Context, messageID int64, channelID string) (string, error) {
+	var result string
+	err := repo.db.GetContext(ctx, &result, `SELECT external_id FROM chat.message_external WHERE message_id=$1 and channel_id=$2`, messageID, channelID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return result, err
+}
+
+func (repo *sqlxRepository) CreateMessageExternalID(ctx context.Context, messageID int64, channelID, externalID string) error {
+	_, err := repo.db.ExecContext(ctx, `insert into chat.message_external (message_id, channel_id, external_id)
+	values ($1, $2, $3)
+	on conflict (message_id, channel_id) do update set external_id = excluded.external_id`, messageID, channelID, externalID)
+	return err
+}
+
+// GetMessageEdits returns the previous texts of the message, the oldest first
+func (repo *sqlxRepository) GetMessageEdits(ctx context.Context, messageID int64) ([]*MessageEdit, error) {
+	result := []*MessageEdit{}
+	err := repo.db.SelectContext(ctx, &result, `SELECT * FROM chat.message_edit WHERE message_id=$1 order by id`, messageID)
+	return result, err
+}
+
+// GetMessageExternalByBot finds the message sent by the bot of the profile to the external user
+func (repo *sqlxRepository) GetMessageExternalByBot(ctx context.Context, profileID int64, externalUserID, externalMessageID string) (*MessageExternal, error) {
+	result := &MessageExternal{}
+	err := repo.db.GetContext(ctx, result, `SELECT e.*
+	FROM chat.message_external e
+	join chat.channel c on c.id = e.channel_id
+	join chat.client cl on cl.id = c.user_id
+	WHERE c.connection=$1 and c.internal=false and cl.external_id=$2 and e.external_id=$3`,
+		strconv.FormatInt(profileID, 10), externalUserID, externalMessageID)
+	if err != nil {
+		repo.log.Warn().Msg(err.Error())
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetMessageStatuses returns the delivery states of the message for all the recipients
+func (repo *sqlxRepository) GetMessageStatuses(ctx context.Context, messageID int64) ([]*MessageStatus, error) {
+	result := []*MessageStatus{}
+	err := repo.db.SelectContext(ctx, &result, `SELECT s.*, c.user_id, c.type as user_type
+	FROM chat.message_status s left join chat.channel c on s.channel_id = c.id
+	WHERE s.message_id=$1
+	order by s.updated_at`, messageID)
 	return result, err
-	// query := make([]qm.QueryMod, 0, 6)
-	// if size != 0 {
-	// 	query = append(query, qm.Limit(int(size)))
-	// } else {
-	// 	query = append(query, qm.Limit(15))
-	// }
-	// if page != 0 {
-	// 	query = append(query, qm.Offset(int((page-1)*size)))
-	// }
-	// if id != 0 {
-	// 	query = append(query, models.MessageWhere.ID.EQ(id))
-	// }
-	// if fields != nil && len(fields) > 0 {
-	// 	query = append(query, qm.Select(fields...))
-	// }
-	// if sort != nil && len(sort) > 0 {
-	// 	for _, item := range sort {
-	// 		query = append(query, qm.OrderBy(item))
-	// 	}
-	// } else {
-	// 	query = append(query, qm.OrderBy("created_at"))
-	// }
-	// if conversationID != "" {
-	// 	query = append(query, models.MessageWhere.ConversationID.EQ(conversationID))
-	// }
-	// return models.Messages(query...).All(ctx, repo.db)
 }
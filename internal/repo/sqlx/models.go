@@ -2,17 +2,20 @@ package sqlxrepo
 
 import (
 	"database/sql"
+	"time"
 
 	"github.com/jmoiron/sqlx/types"
+	"github.com/lib/pq"
 )
 
 var (
 	channelAllColumns      = []string{"id", "type", "conversation_id", "user_id", "connection", "created_at", "internal", "closed_at", "updated_at", "domain_id", "flow_bridge", "name"}
-	clientAllColumns       = []string{"id", "name", "number", "created_at", "activity_at", "external_id", "first_name", "last_name"}
-	conversationAllColumns = []string{"id", "title", "created_at", "closed_at", "updated_at", "domain_id"}
-	inviteAllColumns       = []string{"id", "conversation_id", "user_id", "title", "timeout_sec", "inviter_channel_id", "closed_at", "created_at", "domain_id"}
-	messageAllColumns      = []string{"id", "channel_id", "conversation_id", "text", "created_at", "updated_at", "type"}
-	profileAllColumns      = []string{"id", "name", "schema_id", "type", "variables", "domain_id"}
+	clientAllColumns       = []string{"id", "name", "number", "created_at", "activity_at", "external_id", "first_name", "last_name", "type", "profile_id"}
+	conversationAllColumns = []string{"id", "title", "created_at", "closed_at", "updated_at", "domain_id", "variables"}
+	inviteAllColumns       = []string{"id", "conversation_id", "user_id", "title", "timeout_sec", "inviter_channel_id", "closed_at", "created_at", "domain_id", "expires_at"}
+	messageAllColumns      = []string{"id", "channel_id", "conversation_id", "text", "created_at", "updated_at", "type", "file_id", "file_url", "file_mime_type", "file_name", "interactive", "edited_at", "deleted_at"}
+	webhookAllColumns      = []string{"id", "domain_id", "url", "event_types", "enabled", "created_at", "updated_at"}
+	profileAllColumns      = []string{"id", "name", "schema_id", "type", "variables", "domain_id", "idle_timeout_sec", "closing_message"}
 )
 
 type Channel struct {
@@ -39,15 +42,19 @@ type Client struct {
 	ExternalID sql.NullString `db:"external_id" json:"external_id,omitempty"`
 	FirstName  sql.NullString `db:"first_name" json:"first_name,omitempty"`
 	LastName   sql.NullString `db:"last_name" json:"last_name,omitempty"`
+	Type       sql.NullString `db:"type" json:"type,omitempty"`
+	ProfileID  sql.NullInt64  `db:"profile_id" json:"profile_id,omitempty"`
 }
 
 type Conversation struct {
-	ID        string         `db:"id" json:"id"`
-	Title     sql.NullString `db:"title" json:"title,omitempty"`
-	CreatedAt sql.NullTime   `db:"created_at" json:"created_at,omitempty"`
-	ClosedAt  sql.NullTime   `db:"closed_at" json:"closed_at,omitempty"`
-	UpdatedAt sql.NullTime   `db:"updated_at" json:"updated_at,omitempty"`
-	DomainID  int64          `db:"domain_id" json:"domain_id"`
+	ID           string         `db:"id" json:"id"`
+	Title        sql.NullString `db:"title" json:"title,omitempty"`
+	CreatedAt    sql.NullTime   `db:"created_at" json:"created_at,omitempty"`
+	ClosedAt     sql.NullTime   `db:"closed_at" json:"closed_at,omitempty"`
+	UpdatedAt    sql.NullTime   `db:"updated_at" json:"updated_at,omitempty"`
+	DomainID     int64          `db:"domain_id" json:"domain_id"`
+	LastEventSeq int64          `db:"last_event_seq" json:"last_event_seq"`
+	Variables    types.JSONText `db:"variables" json:"variables"`
 }
 
 type Invite struct {
@@ -60,6 +67,7 @@ type Invite struct {
 	ClosedAt         sql.NullTime   `db:"closed_at" json:"closed_at,omitempty"`
 	CreatedAt        sql.NullTime   `db:"created_at" json:"created_at,omitempty"`
 	DomainID         int64          `db:"domain_id" json:"domain_id"`
+	ExpiresAt        sql.NullTime   `db:"expires_at" json:"expires_at,omitempty"`
 }
 
 type Message struct {
@@ -72,19 +80,178 @@ type Message struct {
 	CreatedAt      sql.NullTime   `db:"created_at" json:"created_at,omitempty"`
 	UpdatedAt      sql.NullTime   `db:"updated_at" json:"updated_at,omitempty"`
 	Type           string         `db:"type" json:"type"`
+	FileID         sql.NullInt64  `db:"file_id" json:"file_id,omitempty"`
+	FileURL        sql.NullString `db:"file_url" json:"file_url,omitempty"`
+	FileMimeType   sql.NullString `db:"file_mime_type" json:"file_mime_type,omitempty"`
+	FileName       sql.NullString `db:"file_name" json:"file_name,omitempty"`
+	// Interactive keeps the buttons, quick replies, cards and postback of the message
+	Interactive types.NullJSONText `db:"interactive" json:"interactive,omitempty"`
+	EditedAt    sql.NullTime       `db:"edited_at" json:"edited_at,omitempty"`
+	DeletedAt   sql.NullTime       `db:"deleted_at" json:"deleted_at,omitempty"`
 }
 
-type Profile struct {
+// MessageEdit is the text of the message before the edit
+type MessageEdit struct {
 	ID        int64          `db:"id" json:"id"`
-	Name      string         `db:"name" json:"name"`
-	SchemaID  sql.NullInt64  `db:"schema_id" json:"schema_id,omitempty"`
-	Type      string         `db:"type" json:"type"`
-	Variables types.JSONText `db:"variables" json:"variables"`
-	DomainID  int64          `db:"domain_id" json:"domain_id"`
-	CreatedAt sql.NullTime   `db:"created_at" json:"created_at,omitempty"`
+	MessageID int64          `db:"message_id" json:"message_id"`
+	Text      sql.NullString `db:"text" json:"text,omitempty"`
+	EditedAt  time.Time      `db:"edited_at" json:"edited_at"`
+}
+
+// MessageExternal links the message to its id in the external messenger of the channel
+type MessageExternal struct {
+	MessageID  int64  `db:"message_id" json:"message_id"`
+	ChannelID  string `db:"channel_id" json:"channel_id"`
+	ExternalID string `db:"external_id" json:"external_id"`
+}
+
+// MessageStatus is the delivery state of the message for the recipient channel
+type MessageStatus struct {
+	MessageID int64          `db:"message_id" json:"message_id"`
+	ChannelID string         `db:"channel_id" json:"channel_id"`
+	Status    string         `db:"status" json:"status"`
+	Cause     sql.NullString `db:"cause" json:"cause,omitempty"`
+	UpdatedAt time.Time      `db:"updated_at" json:"updated_at"`
+	UserID    int64          `db:"user_id" json:"user_id"`
+	UserType  string         `db:"user_type" json:"user_type"`
+}
+
+// Message statuses, the status only moves forward: sent, delivered, read.
+// Failed may replace only sent.
+const (
+	MessageStatusSent      = "sent"
+	MessageStatusDelivered = "delivered"
+	MessageStatusRead      = "read"
+	MessageStatusFailed    = "failed"
+)
+
+type Profile struct {
+	ID             int64          `db:"id" json:"id"`
+	Name           string         `db:"name" json:"name"`
+	SchemaID       sql.NullInt64  `db:"schema_id" json:"schema_id,omitempty"`
+	Type           string         `db:"type" json:"type"`
+	Variables      types.JSONText `db:"variables" json:"variables"`
+	DomainID       int64          `db:"domain_id" json:"domain_id"`
+	CreatedAt      sql.NullTime   `db:"created_at" json:"created_at,omitempty"`
+	IdleTimeoutSec int64          `db:"idle_timeout_sec" json:"idle_timeout_sec"`
+	ClosingMessage string         `db:"closing_message" json:"closing_message"`
+}
+
+// IdleConversation is a conversation closed by inactivity with the message for its clients
+type IdleConversation struct {
+	ID             string `db:"id" json:"id"`
+	DomainID       int64  `db:"domain_id" json:"domain_id"`
+	ClosingMessage string `db:"closing_message" json:"closing_message"`
+}
+
+// DomainSetting is the default of the profiles of the domain
+type DomainSetting struct {
+	DomainID       int64  `db:"domain_id" json:"domain_id"`
+	IdleTimeoutSec int64  `db:"idle_timeout_sec" json:"idle_timeout_sec"`
+	ClosingMessage string `db:"closing_message" json:"closing_message"`
 }
 
 type WebitelUser struct {
 	ID   int64  `db:"id" json:"id"`
 	Name string `db:"name" json:"name"`
 }
+
+// OutboxEvent is a broker message stored in the transaction of the change it describes
+type OutboxEvent struct {
+	ID            int64          `db:"id" json:"id"`
+	Topic         string         `db:"topic" json:"topic"`
+	Body          []byte         `db:"body" json:"body"`
+	ContentType   string         `db:"content_type" json:"content_type"`
+	CreatedAt     time.Time      `db:"created_at" json:"created_at"`
+	Attempts      int            `db:"attempts" json:"attempts"`
+	NextAttemptAt time.Time      `db:"next_attempt_at" json:"next_attempt_at"`
+	SentAt        sql.NullTime   `db:"sent_at" json:"sent_at,omitempty"`
+	LastError     sql.NullString `db:"last_error" json:"last_error,omitempty"`
+}
+
+// OutboxTask is the call to the bot or flow service made by the task relay after the commit
+type OutboxTask struct {
+	ID             int64          `db:"id" json:"id"`
+	Kind           string         `db:"kind" json:"kind"`
+	ConversationID string         `db:"conversation_id" json:"conversation_id"`
+	ChannelID      sql.NullString `db:"channel_id" json:"channel_id,omitempty"`
+	MessageID      sql.NullInt64  `db:"message_id" json:"message_id,omitempty"`
+	Body           []byte         `db:"body" json:"body"`
+	CreatedAt      time.Time      `db:"created_at" json:"created_at"`
+	Attempts       int            `db:"attempts" json:"attempts"`
+	NextAttemptAt  time.Time      `db:"next_attempt_at" json:"next_attempt_at"`
+	DoneAt         sql.NullTime   `db:"done_at" json:"done_at,omitempty"`
+	LastError      sql.NullString `db:"last_error" json:"last_error,omitempty"`
+}
+
+// Kinds of the outbox tasks, the body is the encoded request of the call
+const (
+	OutboxTaskBotSendMessage   = "bot_send_message"
+	OutboxTaskBotEditMessage   = "bot_edit_message"
+	OutboxTaskBotDeleteMessage = "bot_delete_message"
+	// OutboxTaskFlowBreakBridge returns the conversation to the flow, it is retried until the flow accepts it
+	OutboxTaskFlowBreakBridge = "flow_break_bridge"
+	// OutboxTaskFlowCloseConversation stops the flow of the conversation closed by the server, it is retried until done
+	OutboxTaskFlowCloseConversation = "flow_close_conversation"
+)
+
+// ConversationEvent is the event published to the conversation members, kept for the replay
+type ConversationEvent struct {
+	ConversationID string    `db:"conversation_id" json:"conversation_id"`
+	Seq            int64     `db:"seq" json:"seq"`
+	Type           string    `db:"type" json:"type"`
+	Body           []byte    `db:"body" json:"body"`
+	ContentType    string    `db:"content_type" json:"content_type"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+}
+
+type Webhook struct {
+	ID         int64          `db:"id" json:"id"`
+	DomainID   int64          `db:"domain_id" json:"domain_id"`
+	URL        string         `db:"url" json:"url"`
+	EventTypes pq.StringArray `db:"event_types" json:"event_types"`
+	Secret     string         `db:"secret" json:"-"`
+	Enabled    bool           `db:"enabled" json:"enabled"`
+	CreatedAt  time.Time      `db:"created_at" json:"created_at"`
+	UpdatedAt  time.Time      `db:"updated_at" json:"updated_at"`
+}
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending = "pending"
+	WebhookDeliverySent    = "sent"
+	// WebhookDeliveryDead is set when all the attempts failed
+	WebhookDeliveryDead = "dead"
+)
+
+type WebhookDelivery struct {
+	ID             int64        `db:"id" json:"id"`
+	WebhookID      int64        `db:"webhook_id" json:"webhook_id"`
+	EventType      string       `db:"event_type" json:"event_type"`
+	Body           []byte       `db:"body" json:"body,omitempty"`
+	Status         string       `db:"status" json:"status"`
+	Attempts       int          `db:"attempts" json:"attempts"`
+	LastStatusCode int          `db:"last_status_code" json:"last_status_code"`
+	LastError      string       `db:"last_error" json:"last_error"`
+	CreatedAt      time.Time    `db:"created_at" json:"created_at"`
+	NextAttemptAt  time.Time    `db:"next_attempt_at" json:"next_attempt_at"`
+	SentAt         sql.NullTime `db:"sent_at" json:"sent_at,omitempty"`
+}
+
+// WebhookDispatch is the claimed delivery with the target of its webhook
+type WebhookDispatch struct {
+	WebhookDelivery
+	URL    string `db:"url"`
+	Secret string `db:"secret"`
+}
+
+// WebhookDeliveryLog is the result of one delivery attempt
+type WebhookDeliveryLog struct {
+	ID         int64     `db:"id" json:"id"`
+	DeliveryID int64     `db:"delivery_id" json:"delivery_id"`
+	Attempt    int       `db:"attempt" json:"attempt"`
+	StatusCode int       `db:"status_code" json:"status_code"`
+	Error      string    `db:"error" json:"error"`
+	DurationMs int64     `db:"duration_ms" json:"duration_ms"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,119 @@
+package sqlxrepo
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// CreateOutboxEventTx stores the broker message in the transaction of the change,
+// the message is published by the outbox relay after the commit
+func (repo *sqlxRepository) CreateOutboxEventTx(ctx context.Context, tx *sqlx.Tx, e *OutboxEvent) error {
+	stmt, err := tx.PrepareNamed(`insert into chat.outbox (topic, body, content_type)
+	values (:topic, :body, :content_type)
+	returning id`)
+	if err != nil {
+		return err
+	}
+	var id int64
+	err = stmt.GetContext(ctx, &id, *e)
+	if err != nil {
+		return err
+	}
+	e.ID = id
+	return nil
+}
+
+// ClaimOutboxEvents returns the pending events in order of creation and postpones them for the lease time,
+// so another replica does not publish them while they are in progress
+func (repo *sqlxRepository) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*OutboxEvent, error) {
+	result := []*OutboxEvent{}
+	err := repo.db.SelectContext(ctx, &result, `update chat.outbox
+	set attempts = attempts + 1,
+		next_attempt_at = now() + $2 * interval '1 millisecond'
+	where id in (
+		select id from chat.outbox
+		where sent_at is null and next_attempt_at <= now()
+		order by id
+		limit $1
+		for update skip locked
+	)
+	returning *`, limit, lease.Milliseconds())
+	return result, err
+}
+
+func (repo *sqlxRepository) MarkOutboxEventSent(ctx context.Context, id int64) error {
+	_, err := repo.db.ExecContext(ctx, `update chat.outbox set sent_at=now(), last_error=null where id=$1`, id)
+	return err
+}
+
+// RetryOutboxEvent schedules the next publish attempt after the failure
+func (repo *sqlxRepository) RetryOutboxEvent(ctx context.Context, id int64, retryAt time.Time, cause string) error {
+	_, err := repo.db.ExecContext(ctx, `update chat.outbox set next_attempt_at=$1, last_error=$2 where id=$3`, retryAt, cause, id)
+	return err
+}
+
+// DeleteSentOutboxEvents removes the events published before the time
+func (repo *sqlxRepository) DeleteSentOutboxEvents(ctx context.Context, before time.Time) error {
+	_, err := repo.db.ExecContext(ctx, `delete from chat.outbox where sent_at < $1`, before)
+	return err
+}
+
+// CreateOutboxTaskTx stores the call in the transaction of the change,
+// the call is made by the task relay after the commit
+func (repo *sqlxRepository) CreateOutboxTaskTx(ctx context.Context, tx *sqlx.Tx, t *OutboxTask) error {
+	stmt, err := tx.PrepareNamed(`insert into chat.outbox_task (kind, conversation_id, channel_id, message_id, body)
+	values (:kind, :conversation_id, :channel_id, :message_id, :body)
+	returning id`)
+	if err != nil {
+		return err
+	}
+	var id int64
+	err = stmt.GetContext(ctx, &id, *t)
+	if err != nil {
+		return err
+	}
+	t.ID = id
+	return nil
+}
+
+// ClaimOutboxTasks returns the pending tasks and postpones them for the lease time.
+// A task waits until the earlier tasks of its channel are done, so a batch holds one task per channel.
+func (repo *sqlxRepository) ClaimOutboxTasks(ctx context.Context, limit int, lease time.Duration) ([]*OutboxTask, error) {
+	result := []*OutboxTask{}
+	err := repo.db.SelectContext(ctx, &result, `update chat.outbox_task
+	set attempts = attempts + 1,
+		next_attempt_at = now() + $2 * interval '1 millisecond'
+	where id in (
+		select t.id from chat.outbox_task t
+		where t.done_at is null and t.next_attempt_at <= now()
+			and not exists (
+				select 1 from chat.outbox_task p
+				where p.channel_id = t.channel_id and p.done_at is null and p.id < t.id
+			)
+		order by t.id
+		limit $1
+		for update skip locked
+	)
+	returning *`, limit, lease.Milliseconds())
+	return result, err
+}
+
+// MarkOutboxTaskDone finishes the task, cause is the error of the last attempt if the task failed
+func (repo *sqlxRepository) MarkOutboxTaskDone(ctx context.Context, id int64, cause string) error {
+	_, err := repo.db.ExecContext(ctx, `update chat.outbox_task set done_at=now(), last_error=nullif($1, '') where id=$2`, cause, id)
+	return err
+}
+
+// RetryOutboxTask schedules the next attempt after the failure
+func (repo *sqlxRepository) RetryOutboxTask(ctx context.Context, id int64, retryAt time.Time, cause string) error {
+	_, err := repo.db.ExecContext(ctx, `update chat.outbox_task set next_attempt_at=$1, last_error=$2 where id=$3`, retryAt, cause, id)
+	return err
+}
+
+// DeleteDoneOutboxTasks removes the tasks finished before the time
+func (repo *sqlxRepository) DeleteDoneOutboxTasks(ctx context.Context, before time.Time) error {
+	_, err := repo.db.ExecContext(ctx, `delete from chat.outbox_task where done_at < $1`, before)
+	return err
+}
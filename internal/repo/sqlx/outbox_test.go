@@ -0,0 +1,75 @@
+package sqlxrepo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog"
+)
+
+func newTestRepository(t *testing.T) (*sqlxRepository, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	log := zerolog.Nop()
+	return &sqlxRepository{
+		sqlx.NewDb(db, "postgres"),
+		&log,
+	}, mock
+}
+
+func TestClaimOutboxTasks(t *testing.T) {
+	repo, mock := newTestRepository(t)
+	now := time.Now()
+	// the tasks are postponed for the lease and wait for the earlier ones of the channel
+	mock.ExpectQuery(`update chat.outbox_task\s+set attempts = attempts \+ 1,\s+next_attempt_at = now\(\) \+ \$2 \* interval '1 millisecond'`+
+		`(.|\n)+p.channel_id = t.channel_id and p.done_at is null and p.id < t.id(.|\n)+limit \$1\s+for update skip locked`).
+		WithArgs(50, int64(60000)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "conversation_id", "channel_id", "message_id", "body", "created_at", "attempts", "next_attempt_at", "done_at", "last_error"}).
+			AddRow(1, OutboxTaskBotSendMessage, "conversation", "channel", 10, []byte{}, now, 1, now, nil, nil).
+			AddRow(2, OutboxTaskFlowBreakBridge, "conversation", nil, nil, []byte("TIMEOUT"), now, 3, now, nil, "unavailable"))
+	tasks, err := repo.ClaimOutboxTasks(context.Background(), 50, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 2 {
+		t.Fatalf("expected 2 tasks, got %v", len(tasks))
+	}
+	if task := tasks[0]; task.ChannelID.String != "channel" || task.MessageID.Int64 != 10 || task.Attempts != 1 {
+		t.Errorf("unexpected bot task: %+v", task)
+	}
+	if task := tasks[1]; task.ChannelID.Valid || task.Attempts != 3 || task.LastError.String != "unavailable" {
+		t.Errorf("unexpected flow task: %+v", task)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClaimOutboxEvents(t *testing.T) {
+	repo, mock := newTestRepository(t)
+	now := time.Now()
+	mock.ExpectQuery(`update chat.outbox\s+set attempts = attempts \+ 1,\s+next_attempt_at = now\(\) \+ \$2 \* interval '1 millisecond'`+
+		`(.|\n)+order by id\s+limit \$1\s+for update skip locked`).
+		WithArgs(100, int64(30000)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "topic", "body", "content_type", "created_at", "attempts", "next_attempt_at", "sent_at", "last_error"}).
+			AddRow(1, "topic", []byte("{}"), "application/json", now, 1, now, nil, nil))
+	events, err := repo.ClaimOutboxEvents(context.Background(), 100, 30*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Topic != "topic" {
+		t.Fatalf("unexpected events: %v", events)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
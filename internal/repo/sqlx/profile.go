@@ -18,17 +18,43 @@ func (repo *sqlxRepository) GetProfileByID(ctx context.Context, id int64) (*Prof
 	return result, nil
 }
 
-func (repo *sqlxRepository) GetProfiles(ctx context.Context, id int64, size, page int32, fields, sort []string, profileType string, domainID int64) ([]*Profile, error) {
+func (repo *sqlxRepository) GetProfiles(ctx context.Context, id int64, size, page int32, fields, sort []string, profileType string, domainID int64) ([]*Profile, bool, error) {
+	columns, err := selectColumns(fields, profileAllColumns, "", "id")
+	if err != nil {
+		return nil, false, err
+	}
+	order, err := orderBy(sort, profileAllColumns, "", "id")
+	if err != nil {
+		return nil, false, err
+	}
+	filter := &where{}
+	if id != 0 {
+		filter.add("id=$%v", id)
+	}
+	if profileType != "" {
+		filter.add("type=$%v", profileType)
+	}
+	if domainID != 0 {
+		filter.add("domain_id=$%v", domainID)
+	}
 	result := []*Profile{}
-	// TO DO FILTERS
-	err := repo.db.SelectContext(ctx, &result, "SELECT * FROM chat.profile")
-	return result, err
+	err = repo.db.SelectContext(ctx, &result,
+		"SELECT "+columns+" FROM chat.profile"+filter.String()+order+paginate(size, page),
+		filter.args...)
+	if err != nil {
+		return nil, false, err
+	}
+	next := hasNext(len(result), size)
+	if next {
+		result = result[:len(result)-1]
+	}
+	return result, next, nil
 }
 
 func (repo *sqlxRepository) CreateProfile(ctx context.Context, p *Profile) error {
 	p.ID = 0
-	stmt, err := repo.db.PrepareNamed(`insert into chat.profile (name, schema_id, type, variables, domain_id)
-	values (:name, :schema_id, :type, :variables, :domain_id)`)
+	stmt, err := repo.db.PrepareNamed(`insert into chat.profile (name, schema_id, type, variables, domain_id, idle_timeout_sec, closing_message)
+	values (:name, :schema_id, :type, :variables, :domain_id, :idle_timeout_sec, :closing_message) returning id`)
 	if err != nil {
 		return err
 	}
@@ -47,7 +73,9 @@ func (repo *sqlxRepository) UpdateProfile(ctx context.Context, p *Profile) error
 		schema_id=:schema_id,
 		type=:type,
 		variables=:variables,
-		domain_id=:domain_id
+		domain_id=:domain_id,
+		idle_timeout_sec=:idle_timeout_sec,
+		closing_message=:closing_message
 	where id=:id`, *p)
 	return err
 }
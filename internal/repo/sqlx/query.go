@@ -0,0 +1,111 @@
+package sqlxrepo
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	defaultPageSize = 15
+	// maxPageSize limits the rows scanned and returned for a page
+	maxPageSize = 100
+)
+
+// selectColumns returns the requested fields checked against the allowed columns.
+// All columns are returned if fields are empty, required columns are always selected.
+func selectColumns(fields []string, columns []string, alias string, required ...string) (string, error) {
+	if len(fields) == 0 {
+		fields = columns
+	}
+	selected := make([]string, 0, len(fields)+len(required))
+	seen := make(map[string]bool, len(fields)+len(required))
+	for _, field := range append(required, fields...) {
+		field = strings.TrimSpace(field)
+		if seen[field] {
+			continue
+		}
+		if !containsColumn(columns, field) {
+			return "", fmt.Errorf("unknown field: %s", field)
+		}
+		seen[field] = true
+		selected = append(selected, alias+field)
+	}
+	return strings.Join(selected, ", "), nil
+}
+
+// orderBy builds order by clause from fields like "created_at", "+created_at" or "-created_at" (descending).
+func orderBy(sort []string, columns []string, alias string, defaultOrder string) (string, error) {
+	if len(sort) == 0 {
+		return " order by " + alias + defaultOrder, nil
+	}
+	order := make([]string, 0, len(sort))
+	for _, item := range sort {
+		item = strings.TrimSpace(item)
+		direction := "asc"
+		if strings.HasPrefix(item, "-") {
+			direction = "desc"
+		}
+		item = strings.TrimLeft(item, "+-")
+		if !containsColumn(columns, item) {
+			return "", fmt.Errorf("unknown sort field: %s", item)
+		}
+		order = append(order, fmt.Sprintf("%s%s %s", alias, item, direction))
+	}
+	return " order by " + strings.Join(order, ", "), nil
+}
+
+// pageSize returns the default size if it is not set, the size is limited by maxPageSize
+func pageSize(size int32) int32 {
+	if size <= 0 {
+		return defaultPageSize
+	}
+	if size > maxPageSize {
+		return maxPageSize
+	}
+	return size
+}
+
+// paginate builds limit/offset clause. One extra row is requested to detect the next page.
+func paginate(size, page int32) string {
+	size = pageSize(size)
+	if page <= 0 {
+		page = 1
+	}
+	return fmt.Sprintf(" limit %v offset %v", size+1, (page-1)*size)
+}
+
+// hasNext reports whether the extra row requested by paginate was found
+func hasNext(count int, size int32) bool {
+	return count > int(pageSize(size))
+}
+
+// where joins conditions; conditions use $%v placeholder for the argument number
+type where struct {
+	conditions []string
+	args       []interface{}
+}
+
+func (w *where) add(condition string, arg interface{}) {
+	w.args = append(w.args, arg)
+	w.conditions = append(w.conditions, fmt.Sprintf(condition, len(w.args)))
+}
+
+func (w *where) addRaw(condition string) {
+	w.conditions = append(w.conditions, condition)
+}
+
+func (w *where) String() string {
+	if len(w.conditions) == 0 {
+		return ""
+	}
+	return " where " + strings.Join(w.conditions, " and ")
+}
+
+func containsColumn(columns []string, column string) bool {
+	for _, c := range columns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package sqlxrepo
+
+import "testing"
+
+func TestPaginate(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int32
+		page   int32
+		clause string
+		rows   int
+		next   bool
+	}{
+		{
+			name:   "default size",
+			clause: " limit 16 offset 0",
+			rows:   16,
+			next:   true,
+		},
+		{
+			name:   "requested size",
+			size:   20,
+			page:   3,
+			clause: " limit 21 offset 40",
+			rows:   20,
+		},
+		{
+			name:   "size over the maximum",
+			size:   1000000,
+			page:   2,
+			clause: " limit 101 offset 100",
+			rows:   101,
+			next:   true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if clause := paginate(test.size, test.page); clause != test.clause {
+				t.Errorf("expected %q, got %q", test.clause, clause)
+			}
+			if next := hasNext(test.rows, test.size); next != test.next {
+				t.Errorf("expected next %v, got %v", test.next, next)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package sqlxrepo
 
 import (
 	"context"
+	"time"
 
 	pb "github.com/matvoy/chat_server/api/proto/chat"
 
@@ -16,10 +17,19 @@ type Repository interface {
 	ClientRepository
 	InviteRepository
 	MessageRepository
+	OutboxRepository
+	WebhookRepository
+	DomainSettingRepository
 	GetWebitelUserByID(ctx context.Context, id int64) (*WebitelUser, error)
 	WithTransaction(txFunc func(*sqlx.Tx) error) (err error)
 	CreateConversationTx(ctx context.Context, tx *sqlx.Tx, c *Conversation) error
 	CreateMessageTx(ctx context.Context, tx *sqlx.Tx, m *Message) error
+	CreateMessageExternalIDTx(ctx context.Context, tx *sqlx.Tx, messageID int64, channelID, externalID string) error
+	EditMessageTx(ctx context.Context, tx *sqlx.Tx, m *Message) error
+	DeleteMessageTx(ctx context.Context, tx *sqlx.Tx, m *Message) error
+	CreateMessageStatusTx(ctx context.Context, tx *sqlx.Tx, s *MessageStatus) error
+	UpdateMessageStatusTx(ctx context.Context, tx *sqlx.Tx, s *MessageStatus) (bool, error)
+	MarkReadTx(ctx context.Context, tx *sqlx.Tx, channelID string, messageID int64) ([]*MessageStatus, error)
 	GetChannelByIDTx(ctx context.Context, tx *sqlx.Tx, id string) (*Channel, error)
 	GetChannelsTx(
 		ctx context.Context,
@@ -31,9 +41,18 @@ type Repository interface {
 		exceptID *string,
 	) ([]*Channel, error)
 	CreateChannelTx(ctx context.Context, tx *sqlx.Tx, c *Channel) error
+	CloseChannelTx(ctx context.Context, tx *sqlx.Tx, id string) (*Channel, error)
 	CloseChannelsTx(ctx context.Context, tx *sqlx.Tx, conversationID string) error
+	CreateInviteTx(ctx context.Context, tx *sqlx.Tx, m *Invite) error
 	CloseInviteTx(ctx context.Context, tx *sqlx.Tx, inviteID string) error
+	ExpireInvitesTx(ctx context.Context, tx *sqlx.Tx, limit int) ([]*Invite, error)
 	CloseConversationTx(ctx context.Context, tx *sqlx.Tx, conversationID string) error
+	CloseIdleConversationsTx(ctx context.Context, tx *sqlx.Tx, defaultTimeoutSec int64, limit int) ([]*IdleConversation, error)
+	CreateOutboxEventTx(ctx context.Context, tx *sqlx.Tx, e *OutboxEvent) error
+	CreateOutboxTaskTx(ctx context.Context, tx *sqlx.Tx, t *OutboxTask) error
+	NextConversationEventSeqTx(ctx context.Context, tx *sqlx.Tx, conversationID string) (int64, error)
+	CreateConversationEventTx(ctx context.Context, tx *sqlx.Tx, e *ConversationEvent) error
+	CreateWebhookDeliveriesTx(ctx context.Context, tx *sqlx.Tx, domainID int64, eventType string, body []byte) error
 }
 
 type ProfileRepository interface {
@@ -47,12 +66,17 @@ type ProfileRepository interface {
 		sort []string,
 		profileType string,
 		domainID int64,
-	) ([]*Profile, error)
+	) ([]*Profile, bool, error)
 	CreateProfile(ctx context.Context, p *Profile) error
 	UpdateProfile(ctx context.Context, p *Profile) error
 	DeleteProfile(ctx context.Context, id int64) error
 }
 
+type DomainSettingRepository interface {
+	GetDomainSetting(ctx context.Context, domainID int64) (*DomainSetting, error)
+	UpdateDomainSetting(ctx context.Context, d *DomainSetting) error
+}
+
 type ConversationRepository interface {
 	CloseConversation(ctx context.Context, id string) error
 	GetConversations(
@@ -65,9 +89,10 @@ type ConversationRepository interface {
 		domainID int64,
 		active bool,
 		userID int64,
-	) ([]*pb.Conversation, error)
+	) ([]*pb.Conversation, bool, error)
 	CreateConversation(ctx context.Context, c *Conversation) error
 	GetConversationByID(ctx context.Context, id string) (*pb.Conversation, error)
+	GetConversationEvents(ctx context.Context, conversationID string, afterSeq int64, size int32) ([]*ConversationEvent, bool, error)
 }
 
 type ChannelRepository interface {
@@ -87,7 +112,7 @@ type ChannelRepository interface {
 
 type ClientRepository interface {
 	GetClientByID(ctx context.Context, id int64) (*Client, error)
-	GetClientByExternalID(ctx context.Context, externalID string) (*Client, error)
+	GetClientByExternalID(ctx context.Context, channelType string, profileID int64, externalID string) (*Client, error)
 	CreateClient(ctx context.Context, c *Client) error
 	// GetClients(limit, offset int) ([]*Client, error)
 }
@@ -108,7 +133,46 @@ type MessageRepository interface {
 		fields []string,
 		sort []string,
 		conversationID string,
-	) ([]*Message, error)
+		domainID int64,
+	) ([]*Message, bool, error)
+	GetMessageByID(ctx context.Context, id int64) (*Message, error)
+	GetMessageByExternalID(ctx context.Context, channelID, externalID string) (*Message, error)
+	GetMessageExternalID(ctx context.Context, messageID int64, channelID string) (string, error)
+	CreateMessageExternalID(ctx context.Context, messageID int64, channelID, externalID string) error
+	GetMessageEdits(ctx context.Context, messageID int64) ([]*MessageEdit, error)
+	GetMessageExternalByBot(ctx context.Context, profileID int64, externalUserID, externalMessageID string) (*MessageExternal, error)
+	GetMessageStatuses(ctx context.Context, messageID int64) ([]*MessageStatus, error)
+}
+
+type OutboxRepository interface {
+	ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*OutboxEvent, error)
+	MarkOutboxEventSent(ctx context.Context, id int64) error
+	RetryOutboxEvent(ctx context.Context, id int64, retryAt time.Time, cause string) error
+	DeleteSentOutboxEvents(ctx context.Context, before time.Time) error
+	ClaimOutboxTasks(ctx context.Context, limit int, lease time.Duration) ([]*OutboxTask, error)
+	MarkOutboxTaskDone(ctx context.Context, id int64, cause string) error
+	RetryOutboxTask(ctx context.Context, id int64, retryAt time.Time, cause string) error
+	DeleteDoneOutboxTasks(ctx context.Context, before time.Time) error
+}
+
+type WebhookRepository interface {
+	GetWebhookByID(ctx context.Context, id int64) (*Webhook, error)
+	GetWebhooks(
+		ctx context.Context,
+		id int64,
+		size int32,
+		page int32,
+		fields []string,
+		sort []string,
+		domainID int64,
+	) ([]*Webhook, bool, error)
+	CreateWebhook(ctx context.Context, w *Webhook) error
+	UpdateWebhook(ctx context.Context, w *Webhook) error
+	DeleteWebhook(ctx context.Context, id int64) error
+	GetWebhookDeliveries(ctx context.Context, webhookID int64, status string, size int32, page int32) ([]*WebhookDelivery, bool, error)
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*WebhookDispatch, error)
+	SaveWebhookDeliveryAttempt(ctx context.Context, d *WebhookDelivery, l *WebhookDeliveryLog) error
+	DeleteWebhookDeliveries(ctx context.Context, before time.Time) error
 }
 
 type sqlxRepository struct {
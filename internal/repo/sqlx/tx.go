@@ -9,6 +9,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
 )
 
 func (repo *sqlxRepository) WithTransaction(txFunc func(*sqlx.Tx) error) (err error) {
@@ -37,8 +38,11 @@ func (repo *sqlxRepository) CreateConversationTx(ctx context.Context, tx *sqlx.T
 	}
 	c.CreatedAt = tmp
 	c.UpdatedAt = tmp
-	_, err := tx.NamedExecContext(ctx, `insert into chat.conversation (id, title, created_at, closed_at, updated_at, domain_id)
-	values (:id, :title, :created_at, :closed_at, :updated_at, :domain_id)`, *c)
+	if len(c.Variables) == 0 {
+		c.Variables = types.JSONText("{}")
+	}
+	_, err := tx.NamedExecContext(ctx, `insert into chat.conversation (id, title, created_at, closed_at, updated_at, domain_id, variables)
+	values (:id, :title, :created_at, :closed_at, :updated_at, :domain_id, :variables)`, *c)
 	return err
 }
 
@@ -50,8 +54,8 @@ func (repo *sqlxRepository) CreateMessageTx(ctx context.Context, tx *sqlx.Tx, m
 	}
 	m.CreatedAt = tmp
 	m.UpdatedAt = tmp
-	stmt, err := tx.PrepareNamed(`insert into chat.message (channel_id, conversation_id, text, created_at, updated_at, type)
-	values (:channel_id, :conversation_id, :text, :created_at, :updated_at, :type)`)
+	stmt, err := tx.PrepareNamed(`insert into chat.message (channel_id, conversation_id, text, created_at, updated_at, type, file_id, file_url, file_mime_type, file_name, interactive)
+	values (:channel_id, :conversation_id, :text, :created_at, :updated_at, :type, :file_id, :file_url, :file_mime_type, :file_name, :interactive) RETURNING id`)
 	if err != nil {
 		return err
 	}
@@ -61,7 +65,12 @@ func (repo *sqlxRepository) CreateMessageTx(ctx context.Context, tx *sqlx.Tx, m
 		return err
 	}
 	m.ID = id
-	return nil
+	_, err = tx.ExecContext(ctx, `update chat.conversation set updated_at=$1 where id=$2`, tmp, m.ConversationID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `update chat.channel set updated_at=$1 where id=$2`, tmp, m.ChannelID)
+	return err
 }
 
 func (repo *sqlxRepository) GetChannelByIDTx(ctx context.Context, tx *sqlx.Tx, id string) (*Channel, error) {
@@ -90,29 +99,29 @@ func (repo *sqlxRepository) GetChannelsTx(
 	queryStrings := make([]string, 0, 5)
 	queryArgs := make([]interface{}, 0, 5)
 	if userID != nil {
-		queryStrings = append(queryStrings, "user_id")
+		queryStrings = append(queryStrings, "user_id=")
 		queryArgs = append(queryArgs, *userID)
 	}
 	if conversationID != nil {
-		queryStrings = append(queryStrings, "conversation_id")
+		queryStrings = append(queryStrings, "conversation_id=")
 		queryArgs = append(queryArgs, *conversationID)
 	}
 	if connection != nil {
-		queryStrings = append(queryStrings, "connection")
+		queryStrings = append(queryStrings, "connection=")
 		queryArgs = append(queryArgs, *connection)
 	}
 	if internal != nil {
-		queryStrings = append(queryStrings, "internal")
+		queryStrings = append(queryStrings, "internal=")
 		queryArgs = append(queryArgs, *internal)
 	}
 	if exceptID != nil {
-		queryStrings = append(queryStrings, "except_id")
+		queryStrings = append(queryStrings, "id<>")
 		queryArgs = append(queryArgs, *exceptID)
 	}
 	if len(queryArgs) > 0 {
 		where := " closed_at is null and"
 		for i, _ := range queryArgs {
-			where = where + fmt.Sprintf(" %s=$%v and", queryStrings[i], i+1)
+			where = where + fmt.Sprintf(" %s$%v and", queryStrings[i], i+1)
 		}
 		where = strings.TrimRight(where, " and")
 		err := tx.SelectContext(ctx, &result, fmt.Sprintf("SELECT * FROM chat.channel where%s", where), queryArgs...)
@@ -164,6 +173,28 @@ func (repo *sqlxRepository) CreateChannelTx(
 	return err
 }
 
+func (repo *sqlxRepository) CloseChannelTx(ctx context.Context, tx *sqlx.Tx, id string) (*Channel, error) {
+	result := &Channel{}
+	err := tx.GetContext(ctx, result, "SELECT * FROM chat.channel WHERE id=$1", id)
+	if err != nil {
+		repo.log.Warn().Msg(err.Error())
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	tmp := sql.NullTime{
+		Valid: true,
+		Time:  time.Now(),
+	}
+	_, err = tx.ExecContext(ctx, `update chat.channel set closed_at=$1 where id=$2`, tmp, id)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, `update chat.conversation set updated_at=$1 where id=$2`, tmp, result.ConversationID)
+	return result, err
+}
+
 func (repo *sqlxRepository) CloseChannelsTx(ctx context.Context, tx *sqlx.Tx, conversationID string) error {
 	_, err := tx.ExecContext(ctx, `update chat.channel set closed_at=$1 where conversation_id=$2`, sql.NullTime{
 		Valid: true,
@@ -180,10 +211,151 @@ func (repo *sqlxRepository) CloseConversationTx(ctx context.Context, tx *sqlx.Tx
 	return err
 }
 
+func (repo *sqlxRepository) CreateInviteTx(ctx context.Context, tx *sqlx.Tx, m *Invite) error {
+	m.ID = uuid.New().String()
+	m.CreatedAt = sql.NullTime{
+		time.Now(),
+		true,
+	}
+	if m.TimeoutSec > 0 {
+		m.ExpiresAt = sql.NullTime{
+			m.CreatedAt.Time.Add(time.Duration(m.TimeoutSec) * time.Second),
+			true,
+		}
+	}
+	_, err := tx.NamedExecContext(ctx, `insert into chat.invite (id, conversation_id, user_id, title, timeout_sec, inviter_channel_id, created_at, domain_id, expires_at)
+	values (:id, :conversation_id, :user_id, :title, :timeout_sec, :inviter_channel_id, :created_at, :domain_id, :expires_at)`, *m)
+	return err
+}
+
 func (repo *sqlxRepository) CloseInviteTx(ctx context.Context, tx *sqlx.Tx, inviteID string) error {
-	_, err := tx.ExecContext(ctx, `update chat.invite set closed_at=$1 where id=$2`, sql.NullTime{
+	_, err := tx.ExecContext(ctx, `update chat.invite set closed_at=$1 where id=$2 and closed_at is null`, sql.NullTime{
 		Valid: true,
 		Time:  time.Now(),
 	}, inviteID)
 	return err
 }
+
+// ExpireInvitesTx closes the open invites which are due and returns them.
+// Rows locked by another replica are skipped, so every invite is expired only once.
+func (repo *sqlxRepository) ExpireInvitesTx(ctx context.Context, tx *sqlx.Tx, limit int) ([]*Invite, error) {
+	result := []*Invite{}
+	err := tx.SelectContext(ctx, &result, `update chat.invite set closed_at=now()
+	where id in (
+		select id from chat.invite
+		where closed_at is null and expires_at <= now()
+		order by expires_at
+		limit $1
+		for update skip locked
+	)
+	returning *`, limit)
+	return result, err
+}
+
+// CloseIdleConversationsTx marks as closed the open conversations without activity for longer than the timeout.
+// The timeout is taken from the bot profile, then from the domain settings, then defaultTimeoutSec is used; 0 disables closing.
+// Rows locked by another replica are skipped, so every conversation is closed only once.
+func (repo *sqlxRepository) CloseIdleConversationsTx(ctx context.Context, tx *sqlx.Tx, defaultTimeoutSec int64, limit int) ([]*IdleConversation, error) {
+	result := []*IdleConversation{}
+	err := tx.SelectContext(ctx, &result, `update chat.conversation c set closed_at=now()
+	from (
+		select c.id, coalesce(nullif(p.closing_message, ''), d.closing_message, '') as closing_message
+		from chat.conversation c
+		left join lateral (
+			select p.idle_timeout_sec, p.closing_message
+			from chat.channel ch
+			join chat.profile p on p.id::varchar = ch.connection
+			where ch.conversation_id = c.id and not ch.internal
+			limit 1
+		) p on true
+		left join chat.domain_setting d on d.domain_id = c.domain_id
+		where c.closed_at is null
+			and coalesce(nullif(p.idle_timeout_sec, 0), nullif(d.idle_timeout_sec, 0), $1) > 0
+			and c.updated_at < now() - coalesce(nullif(p.idle_timeout_sec, 0), nullif(d.idle_timeout_sec, 0), $1) * interval '1 second'
+		order by c.updated_at
+		limit $2
+		for update of c skip locked
+	) idle
+	where c.id = idle.id
+	returning c.id, c.domain_id, idle.closing_message`, defaultTimeoutSec, limit)
+	return result, err
+}
+
+// NextConversationEventSeqTx increments the event sequence of the conversation.
+// The conversation row stays locked until the end of the transaction, so the events are numbered in commit order.
+func (repo *sqlxRepository) NextConversationEventSeqTx(ctx context.Context, tx *sqlx.Tx, conversationID string) (int64, error) {
+	var seq int64
+	err := tx.GetContext(ctx, &seq, `update chat.conversation set last_event_seq = last_event_seq + 1 where id=$1 returning last_event_seq`, conversationID)
+	return seq, err
+}
+
+func (repo *sqlxRepository) CreateConversationEventTx(ctx context.Context, tx *sqlx.Tx, e *ConversationEvent) error {
+	return tx.GetContext(ctx, &e.CreatedAt, `insert into chat.conversation_event (conversation_id, seq, type, body, content_type)
+	values ($1, $2, $3, $4, $5)
+	returning created_at`, e.ConversationID, e.Seq, e.Type, e.Body, e.ContentType)
+}
+
+// CreateWebhookDeliveriesTx queues the event for every enabled webhook of the domain subscribed to the event type
+func (repo *sqlxRepository) CreateWebhookDeliveriesTx(ctx context.Context, tx *sqlx.Tx, domainID int64, eventType string, body []byte) error {
+	_, err := tx.ExecContext(ctx, `insert into chat.webhook_delivery (webhook_id, event_type, body)
+	select id, $2, $3
+	from chat.webhook
+	where domain_id=$1 and enabled and (cardinality(event_types) = 0 or $2 = any(event_types))`, domainID, eventType, body)
+	return err
+}
+
+func (repo *sqlxRepository) CreateMessageExternalIDTx(ctx context.Context, tx *sqlx.Tx, messageID int64, channelID, externalID string) error {
+	_, err := tx.ExecContext(ctx, `insert into chat.message_external (message_id, channel_id, external_id)
+	values ($1, $2, $3)
+	on conflict (message_id, channel_id) do update set external_id = excluded.external_id`, messageID, channelID, externalID)
+	return err
+}
+
+// EditMessageTx keeps the current text in the edit history and replaces it with m.Text
+func (repo *sqlxRepository) EditMessageTx(ctx context.Context, tx *sqlx.Tx, m *Message) error {
+	if _, err := tx.ExecContext(ctx, `insert into chat.message_edit (message_id, text)
+	select id, text from chat.message where id=$1`, m.ID); err != nil {
+		return err
+	}
+	return tx.GetContext(ctx, &m.EditedAt, `update chat.message set text=$2, edited_at=now(), updated_at=now()
+	where id=$1
+	returning edited_at`, m.ID, m.Text)
+}
+
+func (repo *sqlxRepository) DeleteMessageTx(ctx context.Context, tx *sqlx.Tx, m *Message) error {
+	return tx.GetContext(ctx, &m.DeletedAt, `update chat.message set deleted_at=now(), updated_at=now()
+	where id=$1
+	returning deleted_at`, m.ID)
+}
+
+func (repo *sqlxRepository) CreateMessageStatusTx(ctx context.Context, tx *sqlx.Tx, s *MessageStatus) error {
+	_, err := tx.NamedExecContext(ctx, `insert into chat.message_status (message_id, channel_id, status, cause)
+	values (:message_id, :channel_id, :status, :cause)
+	on conflict (message_id, channel_id) do nothing`, *s)
+	return err
+}
+
+// UpdateMessageStatusTx moves the status forward and reports whether it was changed,
+// the reports arriving out of order are ignored
+func (repo *sqlxRepository) UpdateMessageStatusTx(ctx context.Context, tx *sqlx.Tx, s *MessageStatus) (bool, error) {
+	err := tx.GetContext(ctx, &s.UpdatedAt, `insert into chat.message_status (message_id, channel_id, status, cause)
+	values ($1, $2, $3, $4)
+	on conflict (message_id, channel_id) do update set status = excluded.status, cause = excluded.cause, updated_at = now()
+	where chat.message_status.status = 'sent' and excluded.status <> 'sent'
+		or chat.message_status.status = 'delivered' and excluded.status = 'read'
+	returning updated_at`, s.MessageID, s.ChannelID, s.Status, s.Cause)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// MarkReadTx marks the messages of the conversation up to messageID received by the channel as read
+func (repo *sqlxRepository) MarkReadTx(ctx context.Context, tx *sqlx.Tx, channelID string, messageID int64) ([]*MessageStatus, error) {
+	result := []*MessageStatus{}
+	err := tx.SelectContext(ctx, &result, `update chat.message_status
+	set status = 'read', cause = null, updated_at = now()
+	where channel_id=$1 and message_id<=$2 and status in ('sent', 'delivered')
+	returning *`, channelID, messageID)
+	return result, err
+}
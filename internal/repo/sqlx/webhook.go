@@ -0,0 +1,158 @@
+package sqlxrepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+func (repo *sqlxRepository) GetWebhookByID(ctx context.Context, id int64) (*Webhook, error) {
+	result := &Webhook{}
+	err := repo.db.GetContext(ctx, result, "SELECT * FROM chat.webhook WHERE id=$1", id)
+	if err != nil {
+		repo.log.Warn().Msg(err.Error())
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+func (repo *sqlxRepository) GetWebhooks(ctx context.Context, id int64, size, page int32, fields, sort []string, domainID int64) ([]*Webhook, bool, error) {
+	columns, err := selectColumns(fields, webhookAllColumns, "", "id")
+	if err != nil {
+		return nil, false, err
+	}
+	order, err := orderBy(sort, webhookAllColumns, "", "id")
+	if err != nil {
+		return nil, false, err
+	}
+	filter := &where{}
+	if id != 0 {
+		filter.add("id=$%v", id)
+	}
+	if domainID != 0 {
+		filter.add("domain_id=$%v", domainID)
+	}
+	result := []*Webhook{}
+	err = repo.db.SelectContext(ctx, &result,
+		"SELECT "+columns+" FROM chat.webhook"+filter.String()+order+paginate(size, page),
+		filter.args...)
+	if err != nil {
+		return nil, false, err
+	}
+	next := hasNext(len(result), size)
+	if next {
+		result = result[:len(result)-1]
+	}
+	return result, next, nil
+}
+
+func (repo *sqlxRepository) CreateWebhook(ctx context.Context, w *Webhook) error {
+	stmt, err := repo.db.PrepareNamed(`insert into chat.webhook (domain_id, url, event_types, secret, enabled)
+	values (:domain_id, :url, :event_types, :secret, :enabled)
+	returning id, created_at, updated_at`)
+	if err != nil {
+		return err
+	}
+	return stmt.GetContext(ctx, w, *w)
+}
+
+// UpdateWebhook keeps the current secret if the new one is empty
+func (repo *sqlxRepository) UpdateWebhook(ctx context.Context, w *Webhook) error {
+	stmt, err := repo.db.PrepareNamed(`update chat.webhook set
+		url=:url,
+		event_types=:event_types,
+		secret=coalesce(nullif(:secret, ''), secret),
+		enabled=:enabled,
+		updated_at=now()
+	where id=:id
+	returning *`)
+	if err != nil {
+		return err
+	}
+	return stmt.GetContext(ctx, w, *w)
+}
+
+func (repo *sqlxRepository) DeleteWebhook(ctx context.Context, id int64) error {
+	_, err := repo.db.ExecContext(ctx, "delete from chat.webhook where id=$1", id)
+	return err
+}
+
+// GetWebhookDeliveries returns the delivery log of the webhook, the newest first, without the bodies
+func (repo *sqlxRepository) GetWebhookDeliveries(ctx context.Context, webhookID int64, status string, size, page int32) ([]*WebhookDelivery, bool, error) {
+	filter := &where{}
+	filter.add("webhook_id=$%v", webhookID)
+	if status != "" {
+		filter.add("status=$%v", status)
+	}
+	result := []*WebhookDelivery{}
+	err := repo.db.SelectContext(ctx, &result,
+		`SELECT id, webhook_id, event_type, status, attempts, last_status_code, last_error, created_at, next_attempt_at, sent_at
+		FROM chat.webhook_delivery`+filter.String()+" order by id desc"+paginate(size, page),
+		filter.args...)
+	if err != nil {
+		return nil, false, err
+	}
+	next := hasNext(len(result), size)
+	if next {
+		result = result[:len(result)-1]
+	}
+	return result, next, nil
+}
+
+// ClaimWebhookDeliveries returns the pending deliveries of the enabled webhooks and postpones them for the lease time,
+// so another replica does not send them while they are in progress
+func (repo *sqlxRepository) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*WebhookDispatch, error) {
+	result := []*WebhookDispatch{}
+	err := repo.db.SelectContext(ctx, &result, `with claimed as (
+		update chat.webhook_delivery
+		set attempts = attempts + 1,
+			next_attempt_at = now() + $2 * interval '1 millisecond'
+		where id in (
+			select d.id from chat.webhook_delivery d
+			join chat.webhook w on w.id = d.webhook_id
+			where d.status = 'pending' and d.next_attempt_at <= now() and w.enabled
+			order by d.id
+			limit $1
+			for update of d skip locked
+		)
+		returning *
+	)
+	select c.*, w.url, w.secret
+	from claimed c
+	join chat.webhook w on w.id = c.webhook_id
+	order by c.id`, limit, lease.Milliseconds())
+	return result, err
+}
+
+// SaveWebhookDeliveryAttempt stores the state of the delivery after the attempt together with its log
+func (repo *sqlxRepository) SaveWebhookDeliveryAttempt(ctx context.Context, d *WebhookDelivery, l *WebhookDeliveryLog) error {
+	tx, err := repo.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.NamedExecContext(ctx, `update chat.webhook_delivery set
+		status=:status,
+		last_status_code=:last_status_code,
+		last_error=:last_error,
+		next_attempt_at=:next_attempt_at,
+		sent_at=:sent_at
+	where id=:id`, *d); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.NamedExecContext(ctx, `insert into chat.webhook_delivery_log (delivery_id, attempt, status_code, error, duration_ms)
+	values (:delivery_id, :attempt, :status_code, :error, :duration_ms)`, *l); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteWebhookDeliveries removes the finished deliveries created before the time with their attempts log
+func (repo *sqlxRepository) DeleteWebhookDeliveries(ctx context.Context, before time.Time) error {
+	_, err := repo.db.ExecContext(ctx, `delete from chat.webhook_delivery where status<>$1 and created_at<$2`, WebhookDeliveryPending, before)
+	return err
+}
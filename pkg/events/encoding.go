@@ -0,0 +1,273 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	pbevents "github.com/matvoy/chat_server/api/proto/events"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Version is the version of the event schema set in the envelope
+const Version = 1
+
+// Format is the encoding of the published events
+type Format string
+
+const (
+	// FormatJSON is the legacy shape of the structs of this package
+	FormatJSON Format = "json"
+	// FormatProtoJSON is the api/proto/events envelope in the canonical protobuf json mapping
+	FormatProtoJSON Format = "protojson"
+	// FormatProtobuf is the binary api/proto/events envelope
+	FormatProtobuf Format = "protobuf"
+)
+
+// The content_type header of the broker message tells the consumer how to decode the body
+const (
+	ContentTypeJSON      = "text/json"
+	ContentTypeProtoJSON = "application/json"
+	ContentTypeProtobuf  = "application/x-protobuf"
+)
+
+func ParseFormat(value string) (Format, error) {
+	switch format := Format(value); format {
+	case FormatJSON, FormatProtoJSON, FormatProtobuf:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown event format: %s", value)
+	}
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatProtoJSON:
+		return ContentTypeProtoJSON
+	case FormatProtobuf:
+		return ContentTypeProtobuf
+	default:
+		return ContentTypeJSON
+	}
+}
+
+// Encode serializes the event of this package in the format
+func Encode(format Format, eventType string, domainID int64, event interface{}) ([]byte, error) {
+	if format == FormatJSON {
+		return json.Marshal(event)
+	}
+	envelope, err := NewEnvelope(eventType, domainID, event)
+	if err != nil {
+		return nil, err
+	}
+	if format == FormatProtoJSON {
+		return protojson.Marshal(envelope)
+	}
+	return proto.Marshal(envelope)
+}
+
+// Decode parses the body published with the content type into the envelope.
+// The legacy json carries neither the type nor the domain, they are taken from the topic.
+func Decode(contentType string, eventType string, domainID int64, body []byte) (*pbevents.Envelope, error) {
+	switch contentType {
+	case ContentTypeProtobuf:
+		envelope := &pbevents.Envelope{}
+		if err := proto.Unmarshal(body, envelope); err != nil {
+			return nil, err
+		}
+		return envelope, nil
+	case ContentTypeProtoJSON:
+		envelope := &pbevents.Envelope{}
+		if err := protojson.Unmarshal(body, envelope); err != nil {
+			return nil, err
+		}
+		return envelope, nil
+	case ContentTypeJSON, "":
+		newEvent, ok := legacyEvents[eventType]
+		if !ok {
+			return nil, fmt.Errorf("unknown event type: %s", eventType)
+		}
+		event := newEvent()
+		if err := json.Unmarshal(body, event); err != nil {
+			return nil, err
+		}
+		return NewEnvelope(eventType, domainID, event)
+	default:
+		return nil, fmt.Errorf("unknown content type: %s", contentType)
+	}
+}
+
+var legacyEvents = map[string]func() interface{}{
+	MessageEventType:            func() interface{} { return &MessageEvent{} },
+	CloseConversationEventType:  func() interface{} { return &CloseConversationEvent{} },
+	JoinConversationEventType:   func() interface{} { return &JoinConversationEvent{} },
+	LeaveConversationEventType:  func() interface{} { return &LeaveConversationEvent{} },
+	InviteConversationEventType: func() interface{} { return &InviteConversationEvent{} },
+	UserInvitationEventType:     func() interface{} { return &UserInvitationEvent{} },
+	DeclineInvitationEventType:  func() interface{} { return &DeclineInvitationEvent{} },
+	ExpireInvitationEventType:   func() interface{} { return &ExpireInvitationEvent{} },
+	MessageEditedEventType:      func() interface{} { return &MessageEditedEvent{} },
+	MessageDeletedEventType:     func() interface{} { return &MessageDeletedEvent{} },
+	MessageStatusEventType:      func() interface{} { return &MessageStatusEvent{} },
+}
+
+// NewEnvelope converts the event of this package, or the pointer to it, to the protobuf envelope
+func NewEnvelope(eventType string, domainID int64, event interface{}) (*pbevents.Envelope, error) {
+	if v := reflect.ValueOf(event); v.Kind() == reflect.Ptr && !v.IsNil() {
+		event = v.Elem().Interface()
+	}
+	envelope := &pbevents.Envelope{
+		Type:     eventType,
+		Version:  Version,
+		DomainId: domainID,
+	}
+	var base BaseEvent
+	switch e := event.(type) {
+	case MessageEvent:
+		base = e.BaseEvent
+		envelope.Payload = &pbevents.Envelope_Message{
+			Message: &pbevents.MessageEvent{
+				FromUserId:   e.FromUserID,
+				FromUserType: e.FromUserType,
+				MessageId:    e.MessageID,
+				MessageType:  e.Type,
+				MessageValue: e.Value,
+				MessageFile:  fileToProto(e.File),
+			},
+		}
+	case MessageEditedEvent:
+		base = e.BaseEvent
+		envelope.Payload = &pbevents.Envelope_MessageEdited{
+			MessageEdited: &pbevents.MessageEditedEvent{
+				FromUserId:   e.FromUserID,
+				FromUserType: e.FromUserType,
+				MessageId:    e.MessageID,
+				MessageValue: e.Value,
+				EditedAt:     e.EditedAt,
+			},
+		}
+	case MessageDeletedEvent:
+		base = e.BaseEvent
+		envelope.Payload = &pbevents.Envelope_MessageDeleted{
+			MessageDeleted: &pbevents.MessageDeletedEvent{
+				FromUserId:   e.FromUserID,
+				FromUserType: e.FromUserType,
+				MessageId:    e.MessageID,
+				DeletedAt:    e.DeletedAt,
+			},
+		}
+	case MessageStatusEvent:
+		base = e.BaseEvent
+		envelope.Payload = &pbevents.Envelope_MessageStatus{
+			MessageStatus: &pbevents.MessageStatusEvent{
+				UserId:    e.UserID,
+				UserType:  e.UserType,
+				MessageId: e.MessageID,
+				Status:    e.Status,
+				Cause:     e.Cause,
+				UpdatedAt: e.UpdatedAt,
+			},
+		}
+	case CloseConversationEvent:
+		base = e.BaseEvent
+		envelope.Payload = &pbevents.Envelope_CloseConversation{
+			CloseConversation: &pbevents.CloseConversationEvent{
+				FromUserId: e.FromUserID,
+				Cause:      e.Cause,
+			},
+		}
+	case JoinConversationEvent:
+		base = e.BaseEvent
+		envelope.Payload = &pbevents.Envelope_JoinConversation{
+			JoinConversation: &pbevents.JoinConversationEvent{
+				JoinedUserId:  e.JoinedUserID,
+				Member:        memberToProto(&e.Member),
+				SelfChannelId: e.SelfChannelID,
+			},
+		}
+	case LeaveConversationEvent:
+		base = e.BaseEvent
+		envelope.Payload = &pbevents.Envelope_LeaveConversation{
+			LeaveConversation: &pbevents.LeaveConversationEvent{
+				LeavedUserId: e.LeavedUserID,
+			},
+		}
+	case InviteConversationEvent:
+		base = e.BaseEvent
+		envelope.Payload = &pbevents.Envelope_InviteConversation{
+			InviteConversation: &pbevents.InviteConversationEvent{
+				UserId: e.UserID,
+			},
+		}
+	case UserInvitationEvent:
+		base = e.BaseEvent
+		conversation := &pbevents.Conversation{
+			Id:            e.Conversation.ID,
+			Title:         e.Conversation.Title,
+			CreatedAt:     e.Conversation.CreatedAt,
+			ClosedAt:      e.Conversation.ClosedAt,
+			UpdatedAt:     e.Conversation.UpdatedAt,
+			DomainId:      e.Conversation.DomainID,
+			SelfChannelId: e.Conversation.SelfChannelID,
+		}
+		for _, member := range e.Members {
+			conversation.Members = append(conversation.Members, memberToProto(member))
+		}
+		envelope.Payload = &pbevents.Envelope_UserInvite{
+			UserInvite: &pbevents.UserInvitationEvent{
+				InviteId:     e.InviteID,
+				Conversation: conversation,
+			},
+		}
+	case DeclineInvitationEvent:
+		base = e.BaseEvent
+		envelope.Payload = &pbevents.Envelope_DeclineInvite{
+			DeclineInvite: &pbevents.DeclineInvitationEvent{
+				UserId:   e.UserID,
+				InviteId: e.InviteID,
+			},
+		}
+	case ExpireInvitationEvent:
+		base = e.BaseEvent
+		envelope.Payload = &pbevents.Envelope_ExpireInvite{
+			ExpireInvite: &pbevents.ExpireInvitationEvent{
+				UserId:   e.UserID,
+				InviteId: e.InviteID,
+			},
+		}
+	default:
+		return nil, fmt.Errorf("unknown event: %T", event)
+	}
+	envelope.IdempotencyKey = base.IdempotencyKey
+	envelope.ConversationId = base.ConversationID
+	envelope.Seq = base.Seq
+	envelope.Timestamp = base.Timestamp
+	return envelope, nil
+}
+
+func memberToProto(member *Member) *pbevents.Member {
+	if member == nil {
+		return nil
+	}
+	return &pbevents.Member{
+		UserId:    member.UserID,
+		Username:  member.Username,
+		Type:      member.Type,
+		Internal:  member.Internal,
+		UpdatedAt: member.UpdatedAt,
+	}
+}
+
+func fileToProto(file *File) *pbevents.File {
+	if file == nil {
+		return nil
+	}
+	return &pbevents.File{
+		Id:       file.ID,
+		Url:      file.URL,
+		MimeType: file.MimeType,
+		Name:     file.Name,
+	}
+}
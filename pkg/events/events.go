@@ -9,11 +9,19 @@ const (
 	UserInvitationEventType     = "user_invite"
 	ExpireInvitationEventType   = "expire_invite"
 	DeclineInvitationEventType  = "decline_invite"
+	MessageEditedEventType      = "message_edited"
+	MessageDeletedEventType     = "message_deleted"
+	MessageStatusEventType      = "message_status"
 )
 
 type BaseEvent struct {
+	// IdempotencyKey is unique for the change, the event may be delivered more than once
+	IdempotencyKey string `json:"idempotency_key"`
 	ConversationID string `json:"conversation_id"`
-	Timestamp      int64  `json:"timestamp"`
+	// Seq increases by one with every event sent to all the conversation members,
+	// a gap means missed events which are replayed by GetConversationEvents
+	Seq       int64 `json:"seq,omitempty"`
+	Timestamp int64 `json:"timestamp"`
 }
 
 type MessageEvent struct {
@@ -24,6 +32,35 @@ type MessageEvent struct {
 	MessageID int64  `json:"message_id"`
 	Type      string `json:"message_type"`
 	Value     string `json:"message_value"`
+	File      *File  `json:"message_file,omitempty"`
+}
+
+type MessageEditedEvent struct {
+	BaseEvent
+	FromUserID   int64  `json:"from_user_id"`
+	FromUserType string `json:"from_user_type"`
+	MessageID    int64  `json:"message_id"`
+	Value        string `json:"message_value"`
+	EditedAt     int64  `json:"edited_at"`
+}
+
+type MessageDeletedEvent struct {
+	BaseEvent
+	FromUserID   int64  `json:"from_user_id"`
+	FromUserType string `json:"from_user_type"`
+	MessageID    int64  `json:"message_id"`
+	DeletedAt    int64  `json:"deleted_at"`
+}
+
+// MessageStatusEvent is the new delivery state of the message for the recipient user
+type MessageStatusEvent struct {
+	BaseEvent
+	UserID    int64  `json:"user_id"`
+	UserType  string `json:"user_type"`
+	MessageID int64  `json:"message_id"`
+	Status    string `json:"status"`
+	Cause     string `json:"cause,omitempty"`
+	UpdatedAt int64  `json:"updated_at"`
 }
 
 type CloseConversationEvent struct {
@@ -63,11 +100,17 @@ type DeclineInvitationEvent struct {
 	InviteID string `json:"invite_id"`
 }
 
+type ExpireInvitationEvent struct {
+	BaseEvent
+	UserID   int64  `json:"user_id"`
+	InviteID string `json:"invite_id"`
+}
+
 type Conversation struct {
 	ID            string    `json:"id"`
 	Title         string    `json:"title,omitempty"`
 	CreatedAt     int64     `json:"created_at,omitempty"`
-	ClosedAt      int64     `json:"created_at,omitempty"`
+	ClosedAt      int64     `json:"closed_at,omitempty"`
 	UpdatedAt     int64     `json:"updated_at,omitempty"`
 	DomainID      int64     `json:"domain_id"`
 	Members       []*Member `json:"members"`
@@ -84,3 +127,10 @@ type Member struct {
 	// Firstname string `json:"firstname,omitempty"`
 	// Lastname  string `json:"lastname,omitempty"`
 }
+
+type File struct {
+	ID       int64  `json:"id"`
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type"`
+	Name     string `json:"name,omitempty"`
+}
@@ -0,0 +1,174 @@
+package subscriber
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/micro/go-micro/v2/broker"
+)
+
+// memoryBroker is the in-process broker for tests.
+// Unlike the go-micro memory broker it matches the "*" segment of the topic like rabbitmq,
+// and the disconnect drops the subscriptions like a broken connection.
+type memoryBroker struct {
+	opts      broker.Options
+	mu        sync.RWMutex
+	connected bool
+	subs      map[string]*memorySubscriber
+}
+
+type memorySubscriber struct {
+	id      string
+	topic   string
+	handler broker.Handler
+	opts    broker.SubscribeOptions
+	broker  *memoryBroker
+}
+
+type memoryEvent struct {
+	topic   string
+	message *broker.Message
+}
+
+// NewMemoryBroker returns the in-process broker for tests, the subscriber may be bound to Any domain or user
+func NewMemoryBroker(opts ...broker.Option) broker.Broker {
+	b := &memoryBroker{
+		subs: make(map[string]*memorySubscriber),
+	}
+	b.Init(opts...)
+	return b
+}
+
+func (b *memoryBroker) Init(opts ...broker.Option) error {
+	for _, o := range opts {
+		o(&b.opts)
+	}
+	return nil
+}
+
+func (b *memoryBroker) Options() broker.Options {
+	return b.opts
+}
+
+func (b *memoryBroker) Address() string {
+	return "memory"
+}
+
+func (b *memoryBroker) Connect() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.connected = true
+	return nil
+}
+
+func (b *memoryBroker) Disconnect() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.connected = false
+	b.subs = make(map[string]*memorySubscriber)
+	return nil
+}
+
+// Publish calls the handlers of the matching topics, the subscribers of a queue receive the message once
+func (b *memoryBroker) Publish(topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	b.mu.RLock()
+	if !b.connected {
+		b.mu.RUnlock()
+		return errors.New("not connected")
+	}
+	queues := make(map[string]bool)
+	handlers := []broker.Handler{}
+	for _, sub := range b.subs {
+		if !topicMatch(sub.topic, topic) {
+			continue
+		}
+		if queue := sub.opts.Queue; queue != "" {
+			if queues[queue] {
+				continue
+			}
+			queues[queue] = true
+		}
+		handlers = append(handlers, sub.handler)
+	}
+	b.mu.RUnlock()
+	event := &memoryEvent{
+		topic:   topic,
+		message: msg,
+	}
+	for _, handler := range handlers {
+		if err := handler(event); err != nil && b.opts.ErrorHandler != nil {
+			b.opts.ErrorHandler(event)
+		}
+	}
+	return nil
+}
+
+func (b *memoryBroker) Subscribe(topic string, handler broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.connected {
+		return nil, errors.New("not connected")
+	}
+	options := broker.NewSubscribeOptions(opts...)
+	sub := &memorySubscriber{
+		id:      uuid.New().String(),
+		topic:   topic,
+		handler: handler,
+		opts:    options,
+		broker:  b,
+	}
+	b.subs[sub.id] = sub
+	return sub, nil
+}
+
+func (b *memoryBroker) String() string {
+	return "memory"
+}
+
+// topicMatch compares the topics by the dot separated segments, "*" of the pattern matches any segment
+func topicMatch(pattern, topic string) bool {
+	patternParts := strings.Split(pattern, ".")
+	topicParts := strings.Split(topic, ".")
+	if len(patternParts) != len(topicParts) {
+		return false
+	}
+	for i, part := range patternParts {
+		if part != "*" && part != topicParts[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *memorySubscriber) Options() broker.SubscribeOptions {
+	return s.opts
+}
+
+func (s *memorySubscriber) Topic() string {
+	return s.topic
+}
+
+func (s *memorySubscriber) Unsubscribe() error {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	delete(s.broker.subs, s.id)
+	return nil
+}
+
+func (e *memoryEvent) Topic() string {
+	return e.topic
+}
+
+func (e *memoryEvent) Message() *broker.Message {
+	return e.message
+}
+
+func (e *memoryEvent) Ack() error {
+	return nil
+}
+
+func (e *memoryEvent) Error() error {
+	return nil
+}
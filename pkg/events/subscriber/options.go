@@ -0,0 +1,71 @@
+package subscriber
+
+import (
+	"time"
+
+	"github.com/micro/go-micro/v2/broker"
+)
+
+type Options struct {
+	// DomainID and UserID limit the topics, Any subscribes to all of them
+	DomainID int64
+	UserID   int64
+	// ReconnectInterval is the first delay before connecting again, it doubles up to MaxReconnectDelay
+	ReconnectInterval time.Duration
+	MaxReconnectDelay time.Duration
+	// HealthCheckInterval is the period of the probe which finds the dropped subscriptions, zero disables it.
+	// The probe is published to the own topic of the subscriber, so it needs the publish permission.
+	HealthCheckInterval time.Duration
+	HealthCheckTimeout  time.Duration
+	// ErrorHandler receives the connection, decoding and handler errors
+	ErrorHandler     func(error)
+	SubscribeOptions []broker.SubscribeOption
+}
+
+type Option func(*Options)
+
+func Domain(domainID int64) Option {
+	return func(o *Options) {
+		o.DomainID = domainID
+	}
+}
+
+func User(userID int64) Option {
+	return func(o *Options) {
+		o.UserID = userID
+	}
+}
+
+// Queue shares the events between the subscribers with the same queue name
+func Queue(name string) Option {
+	return func(o *Options) {
+		o.SubscribeOptions = append(o.SubscribeOptions, broker.Queue(name))
+	}
+}
+
+func Reconnect(interval, maxDelay time.Duration) Option {
+	return func(o *Options) {
+		o.ReconnectInterval = interval
+		o.MaxReconnectDelay = maxDelay
+	}
+}
+
+func HealthCheck(interval, timeout time.Duration) Option {
+	return func(o *Options) {
+		o.HealthCheckInterval = interval
+		o.HealthCheckTimeout = timeout
+	}
+}
+
+func ErrorHandler(handler func(error)) Option {
+	return func(o *Options) {
+		o.ErrorHandler = handler
+	}
+}
+
+// SubscribeOptions passes the broker specific options, like rabbitmq.DurableQueue()
+func SubscribeOptions(opts ...broker.SubscribeOption) Option {
+	return func(o *Options) {
+		o.SubscribeOptions = append(o.SubscribeOptions, opts...)
+	}
+}
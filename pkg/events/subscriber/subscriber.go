@@ -0,0 +1,319 @@
+// Package subscriber consumes the chat events published to the broker.
+//
+//	sub := subscriber.New(rabbitmq.NewBroker(rabbitmq.ExchangeName("chat")),
+//		subscriber.Domain(1),
+//		subscriber.Queue("my-service"),
+//	)
+//	sub.OnMessage(func(env *pbevents.Envelope, e *pbevents.MessageEvent) error {
+//		return nil
+//	})
+//	if err := sub.Start(); err != nil {
+//		...
+//	}
+//	defer sub.Stop()
+package subscriber
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	pbevents "github.com/matvoy/chat_server/api/proto/events"
+	"github.com/matvoy/chat_server/pkg/events"
+
+	"github.com/google/uuid"
+	"github.com/micro/go-micro/v2/broker"
+)
+
+// Any matches all the domains or users
+const Any int64 = 0
+
+// Handler receives every decoded event, the typed handlers receive the payload as well
+type Handler func(env *pbevents.Envelope) error
+
+// Subscriber routes the events of the subscribed topics to the handlers
+type Subscriber struct {
+	broker   broker.Broker
+	opts     Options
+	mu       sync.Mutex
+	handlers map[string]Handler
+	subs     []broker.Subscriber
+	stop     chan struct{}
+	wg       sync.WaitGroup
+	// probeTopic is unique for the subscriber, the health check publishes to it
+	probeTopic string
+	probe      chan struct{}
+}
+
+func New(b broker.Broker, opts ...Option) *Subscriber {
+	options := Options{
+		DomainID:            Any,
+		UserID:              Any,
+		ReconnectInterval:   time.Second,
+		MaxReconnectDelay:   time.Minute,
+		HealthCheckInterval: 30 * time.Second,
+		HealthCheckTimeout:  5 * time.Second,
+		ErrorHandler:        func(error) {},
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	return &Subscriber{
+		broker:     b,
+		opts:       options,
+		handlers:   make(map[string]Handler),
+		probeTopic: fmt.Sprintf("subscriber.probe.%s", uuid.New().String()),
+		probe:      make(chan struct{}, 1),
+	}
+}
+
+// Topic returns the topic of the event type for the subscribed domain and user
+func (s *Subscriber) Topic(eventType string) string {
+	return fmt.Sprintf("event.%s.%s.%s", eventType, topicPart(s.opts.DomainID), topicPart(s.opts.UserID))
+}
+
+func topicPart(id int64) string {
+	if id == Any {
+		return "*"
+	}
+	return fmt.Sprintf("%v", id)
+}
+
+// Handle registers the handler of the event type, handlers must be registered before Start
+func (s *Subscriber) Handle(eventType string, handler Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[eventType] = handler
+}
+
+func (s *Subscriber) OnMessage(handler func(env *pbevents.Envelope, e *pbevents.MessageEvent) error) {
+	s.Handle(events.MessageEventType, func(env *pbevents.Envelope) error {
+		return handler(env, env.GetMessage())
+	})
+}
+
+func (s *Subscriber) OnMessageEdited(handler func(env *pbevents.Envelope, e *pbevents.MessageEditedEvent) error) {
+	s.Handle(events.MessageEditedEventType, func(env *pbevents.Envelope) error {
+		return handler(env, env.GetMessageEdited())
+	})
+}
+
+func (s *Subscriber) OnMessageDeleted(handler func(env *pbevents.Envelope, e *pbevents.MessageDeletedEvent) error) {
+	s.Handle(events.MessageDeletedEventType, func(env *pbevents.Envelope) error {
+		return handler(env, env.GetMessageDeleted())
+	})
+}
+
+func (s *Subscriber) OnMessageStatus(handler func(env *pbevents.Envelope, e *pbevents.MessageStatusEvent) error) {
+	s.Handle(events.MessageStatusEventType, func(env *pbevents.Envelope) error {
+		return handler(env, env.GetMessageStatus())
+	})
+}
+
+func (s *Subscriber) OnClose(handler func(env *pbevents.Envelope, e *pbevents.CloseConversationEvent) error) {
+	s.Handle(events.CloseConversationEventType, func(env *pbevents.Envelope) error {
+		return handler(env, env.GetCloseConversation())
+	})
+}
+
+func (s *Subscriber) OnJoin(handler func(env *pbevents.Envelope, e *pbevents.JoinConversationEvent) error) {
+	s.Handle(events.JoinConversationEventType, func(env *pbevents.Envelope) error {
+		return handler(env, env.GetJoinConversation())
+	})
+}
+
+func (s *Subscriber) OnLeave(handler func(env *pbevents.Envelope, e *pbevents.LeaveConversationEvent) error) {
+	s.Handle(events.LeaveConversationEventType, func(env *pbevents.Envelope) error {
+		return handler(env, env.GetLeaveConversation())
+	})
+}
+
+func (s *Subscriber) OnInvite(handler func(env *pbevents.Envelope, e *pbevents.InviteConversationEvent) error) {
+	s.Handle(events.InviteConversationEventType, func(env *pbevents.Envelope) error {
+		return handler(env, env.GetInviteConversation())
+	})
+}
+
+func (s *Subscriber) OnUserInvite(handler func(env *pbevents.Envelope, e *pbevents.UserInvitationEvent) error) {
+	s.Handle(events.UserInvitationEventType, func(env *pbevents.Envelope) error {
+		return handler(env, env.GetUserInvite())
+	})
+}
+
+func (s *Subscriber) OnDeclineInvite(handler func(env *pbevents.Envelope, e *pbevents.DeclineInvitationEvent) error) {
+	s.Handle(events.DeclineInvitationEventType, func(env *pbevents.Envelope) error {
+		return handler(env, env.GetDeclineInvite())
+	})
+}
+
+func (s *Subscriber) OnExpireInvite(handler func(env *pbevents.Envelope, e *pbevents.ExpireInvitationEvent) error) {
+	s.Handle(events.ExpireInvitationEventType, func(env *pbevents.Envelope) error {
+		return handler(env, env.GetExpireInvite())
+	})
+}
+
+// Start connects to the broker and subscribes to the topics of the registered handlers.
+// The subscriptions are checked by the probe message every HealthCheckInterval,
+// when the check or the subscribe fails they are made again with the growing delay until Stop is called.
+func (s *Subscriber) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		return fmt.Errorf("subscriber is started")
+	}
+	if len(s.handlers) == 0 {
+		return fmt.Errorf("no handlers registered")
+	}
+	if err := s.broker.Init(); err != nil {
+		return err
+	}
+	s.stop = make(chan struct{})
+	err := s.subscribe()
+	if err != nil {
+		s.opts.ErrorHandler(err)
+	}
+	s.wg.Add(1)
+	go s.supervise(s.stop, err == nil)
+	return nil
+}
+
+// supervise checks the subscriptions and makes them again after the dropped connection
+func (s *Subscriber) supervise(stop chan struct{}, subscribed bool) {
+	defer s.wg.Done()
+	delay := s.opts.ReconnectInterval
+	for {
+		wait := delay
+		if subscribed {
+			if s.opts.HealthCheckInterval <= 0 {
+				return
+			}
+			wait = s.opts.HealthCheckInterval
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(wait):
+		}
+		if subscribed {
+			err := s.check(stop)
+			if err == nil {
+				continue
+			}
+			s.opts.ErrorHandler(err)
+			subscribed = false
+			delay = s.opts.ReconnectInterval
+		}
+		s.mu.Lock()
+		s.unsubscribe()
+		err := s.subscribe()
+		s.mu.Unlock()
+		if err == nil {
+			subscribed = true
+			continue
+		}
+		s.opts.ErrorHandler(err)
+		if delay *= 2; delay > s.opts.MaxReconnectDelay {
+			delay = s.opts.MaxReconnectDelay
+		}
+	}
+}
+
+// check publishes the probe to the own topic of the subscriber and waits for it
+func (s *Subscriber) check(stop chan struct{}) error {
+	select {
+	case <-s.probe:
+	default:
+	}
+	if err := s.broker.Publish(s.probeTopic, &broker.Message{}); err != nil {
+		return err
+	}
+	select {
+	case <-s.probe:
+		return nil
+	case <-stop:
+		return nil
+	case <-time.After(s.opts.HealthCheckTimeout):
+		return fmt.Errorf("health check probe is not received in %v", s.opts.HealthCheckTimeout)
+	}
+}
+
+func (s *Subscriber) receiveProbe(broker.Event) error {
+	select {
+	case s.probe <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (s *Subscriber) subscribe() error {
+	if err := s.broker.Connect(); err != nil {
+		return err
+	}
+	for eventType := range s.handlers {
+		sub, err := s.broker.Subscribe(s.Topic(eventType), s.handle, s.opts.SubscribeOptions...)
+		if err != nil {
+			s.unsubscribe()
+			return err
+		}
+		s.subs = append(s.subs, sub)
+	}
+	if s.opts.HealthCheckInterval > 0 {
+		sub, err := s.broker.Subscribe(s.probeTopic, s.receiveProbe)
+		if err != nil {
+			s.unsubscribe()
+			return err
+		}
+		s.subs = append(s.subs, sub)
+	}
+	return nil
+}
+
+func (s *Subscriber) unsubscribe() {
+	for _, sub := range s.subs {
+		if err := sub.Unsubscribe(); err != nil {
+			s.opts.ErrorHandler(err)
+		}
+	}
+	s.subs = nil
+}
+
+// Stop unsubscribes from the topics, the broker connection is left to its owner
+func (s *Subscriber) Stop() {
+	s.mu.Lock()
+	if s.stop == nil {
+		s.mu.Unlock()
+		return
+	}
+	close(s.stop)
+	s.stop = nil
+	s.mu.Unlock()
+	s.wg.Wait()
+	s.mu.Lock()
+	s.unsubscribe()
+	s.mu.Unlock()
+}
+
+func (s *Subscriber) handle(p broker.Event) error {
+	eventType, domainID, _, err := events.ParseTopic(p.Topic())
+	if err != nil {
+		s.opts.ErrorHandler(err)
+		return err
+	}
+	s.mu.Lock()
+	handler, ok := s.handlers[eventType]
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	msg := p.Message()
+	env, err := events.Decode(msg.Header["content_type"], eventType, domainID, msg.Body)
+	if err != nil {
+		s.opts.ErrorHandler(err)
+		return err
+	}
+	if err := handler(env); err != nil {
+		s.opts.ErrorHandler(err)
+		return err
+	}
+	return nil
+}
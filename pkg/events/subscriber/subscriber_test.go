@@ -0,0 +1,126 @@
+package subscriber
+
+import (
+	"testing"
+	"time"
+
+	pbevents "github.com/matvoy/chat_server/api/proto/events"
+	"github.com/matvoy/chat_server/pkg/events"
+
+	"github.com/micro/go-micro/v2/broker"
+)
+
+func publishMessage(t *testing.T, b broker.Broker, format events.Format, domainID, userID int64) error {
+	t.Helper()
+	body, err := events.Encode(format, events.MessageEventType, domainID, &events.MessageEvent{
+		BaseEvent: events.BaseEvent{
+			ConversationID: "conversation",
+			Timestamp:      1,
+		},
+		FromUserID: userID,
+		MessageID:  10,
+		Type:       "text",
+		Value:      "hello",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.Publish(events.Topic(events.MessageEventType, domainID, userID), &broker.Message{
+		Header: map[string]string{
+			"content_type": format.ContentType(),
+		},
+		Body: body,
+	})
+}
+
+func startSubscriber(t *testing.T, b broker.Broker, opts ...Option) (*Subscriber, chan *pbevents.Envelope) {
+	t.Helper()
+	received := make(chan *pbevents.Envelope, 10)
+	sub := New(b, opts...)
+	sub.OnMessage(func(env *pbevents.Envelope, e *pbevents.MessageEvent) error {
+		received <- env
+		return nil
+	})
+	if err := sub.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sub.Stop)
+	return sub, received
+}
+
+func TestSubscriberAny(t *testing.T) {
+	for _, format := range []events.Format{events.FormatJSON, events.FormatProtoJSON, events.FormatProtobuf} {
+		t.Run(string(format), func(t *testing.T) {
+			b := NewMemoryBroker()
+			_, received := startSubscriber(t, b)
+			if err := publishMessage(t, b, format, 5, 7); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case env := <-received:
+				if env.GetDomainId() != 5 {
+					t.Errorf("expected domain 5, got %v", env.GetDomainId())
+				}
+				if env.GetConversationId() != "conversation" {
+					t.Errorf("expected conversation, got %v", env.GetConversationId())
+				}
+				if value := env.GetMessage().GetMessageValue(); value != "hello" {
+					t.Errorf("expected hello, got %v", value)
+				}
+			default:
+				t.Fatal("event is not received")
+			}
+		})
+	}
+}
+
+func TestSubscriberDomain(t *testing.T) {
+	b := NewMemoryBroker()
+	_, received := startSubscriber(t, b, Domain(1))
+	if err := publishMessage(t, b, events.FormatProtobuf, 2, 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := publishMessage(t, b, events.FormatProtobuf, 1, 7); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 1 {
+		t.Fatalf("expected 1 event, got %v", len(received))
+	}
+	if env := <-received; env.GetDomainId() != 1 {
+		t.Errorf("expected domain 1, got %v", env.GetDomainId())
+	}
+}
+
+func TestSubscriberQueue(t *testing.T) {
+	b := NewMemoryBroker()
+	_, first := startSubscriber(t, b, Queue("service"))
+	_, second := startSubscriber(t, b, Queue("service"))
+	if err := publishMessage(t, b, events.FormatProtobuf, 1, 7); err != nil {
+		t.Fatal(err)
+	}
+	if total := len(first) + len(second); total != 1 {
+		t.Fatalf("expected 1 event for the queue, got %v", total)
+	}
+}
+
+func TestSubscriberResubscribe(t *testing.T) {
+	b := NewMemoryBroker()
+	_, received := startSubscriber(t, b,
+		HealthCheck(10*time.Millisecond, 10*time.Millisecond),
+		Reconnect(10*time.Millisecond, 20*time.Millisecond),
+	)
+	if err := b.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.After(time.Second)
+	for {
+		if err := publishMessage(t, b, events.FormatProtobuf, 1, 7); err == nil && len(received) > 0 {
+			return
+		}
+		select {
+		case <-deadline:
+			t.Fatal("subscriber is not subscribed again after the dropped connection")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
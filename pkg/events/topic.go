@@ -0,0 +1,29 @@
+package events
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Topic is the broker topic of the event sent to the user: event.<type>.<domain>.<user>
+func Topic(eventType string, domainID, userID int64) string {
+	return fmt.Sprintf("event.%s.%v.%v", eventType, domainID, userID)
+}
+
+// ParseTopic returns the event type, domain and user of the topic built by Topic
+func ParseTopic(topic string) (string, int64, int64, error) {
+	parts := strings.Split(topic, ".")
+	if len(parts) != 4 || parts[0] != "event" {
+		return "", 0, 0, fmt.Errorf("wrong event topic: %s", topic)
+	}
+	domainID, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("wrong event topic domain: %s", topic)
+	}
+	userID, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("wrong event topic user: %s", topic)
+	}
+	return parts[1], domainID, userID, nil
+}
@@ -15,4 +15,7 @@ protoc -I api/proto/auth --go_out=api/proto/auth --micro_out=api/proto/auth api/
 
 protoc -I api/proto/storage --go_out=api/proto/storage --micro_out=api/proto/storage api/proto/storage/file.proto
 mv ./api/proto/storage/github.com/webitel/storage/grpc_api/storage/* ./api/proto/storage/
-rm -rf ./api/proto/storage/github.com
\ No newline at end of file
+rm -rf ./api/proto/storage/github.com
+protoc -I api/proto/events --go_out=api/proto/events api/proto/events/events.proto
+mv ./api/proto/events/github.com/matvoy/chat_server/api/proto/events/* ./api/proto/events/
+rm -rf ./api/proto/events/github.com